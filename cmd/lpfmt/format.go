@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+// format returns the canonical form of the line-protocol entries in src,
+// interpreting timestamps with precision from and writing them
+// with precision to.
+//
+// If an entry can't be decoded, it returns a *lineprotocol.DecodeError.
+func format(src []byte, from, to lineprotocol.Precision) ([]byte, error) {
+	dec := lineprotocol.NewDecoderWithBytes(src)
+	dec.SetComments(true)
+	enc := &lineprotocol.Encoder{}
+	enc.SetPrecision(to)
+	var p lineprotocol.Point
+	for dec.Next() {
+		if comment := dec.Comment(); comment != nil {
+			enc.AddComment(strings.TrimRight(string(comment), " "))
+			continue
+		}
+		if err := dec.DecodePoint(&p, from, time.Time{}); err != nil {
+			return nil, err
+		}
+		enc.EncodePoint(&p)
+		if err := enc.Err(); err != nil {
+			var eerr *lineprotocol.EncodeError
+			if errors.As(err, &eerr) {
+				err = eerr.Err
+			}
+			return nil, fmt.Errorf("cannot format entry for measurement %q: %v", p.Measurement, err)
+		}
+	}
+	return enc.Bytes(), nil
+}
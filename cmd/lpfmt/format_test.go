@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+var formatTests = []struct {
+	testName    string
+	from, to    lineprotocol.Precision
+	src         string
+	expect      string
+	expectError string
+}{{
+	testName: "already-canonical",
+	src:      "m,a=1,b=2 f=1,g=\"x\" 123\n",
+	expect:   "m,a=1,b=2 f=1,g=\"x\" 123\n",
+}, {
+	testName: "sort-tags",
+	src:      "m,c=3,a=1,b=2 f=1i\n",
+	expect:   "m,a=1,b=2,c=3 f=1i\n",
+}, {
+	testName: "white-space",
+	src:      "\n  m   f=1u    123   \r\n\n\nn f=2\n",
+	expect:   "m f=1u 123\nn f=2\n",
+}, {
+	testName: "bools",
+	src:      "m a=t,b=T,c=True,d=TRUE,e=f,f=F,g=False,h=FALSE\n",
+	expect:   "m a=true,b=true,c=true,d=true,e=false,f=false,g=false,h=false\n",
+}, {
+	testName: "numbers",
+	src:      "m a=1.000,b=007i,c=0.10000000000000001,d=1e3,e=-0.0\n",
+	expect:   "m a=1,b=7i,c=0.1,d=1000,e=-0\n",
+}, {
+	testName: "escapes",
+	src:      `m\a\ b,t\k=v\x\=y f\.=1,s="a\b\"c\\" 1` + "\n",
+	expect:   `m\a\ b,t\k=v\x\=y f\.=1,s="a\\b\"c\\" 1` + "\n",
+}, {
+	testName: "comments",
+	src:      "  # leading comment   \nm f=1\n# between \r\nn f=2\n#last",
+	expect:   "# leading comment\nm f=1\n# between\nn f=2\n#last\n",
+}, {
+	testName: "multi-line-string",
+	src:      "m s=\"a\n# not a comment\"\n# comment\n",
+	expect:   "m s=\"a\\n# not a comment\"\n# comment\n",
+}, {
+	testName: "no-final-newline",
+	src:      "m f=1 1",
+	expect:   "m f=1 1\n",
+}, {
+	testName: "precision-conversion",
+	from:     lineprotocol.Second,
+	to:       lineprotocol.Millisecond,
+	src:      "m f=1 1\nm f=2\n",
+	expect:   "m f=1 1000\nm f=2\n",
+}, {
+	testName: "precision-truncation",
+	from:     lineprotocol.Nanosecond,
+	to:       lineprotocol.Second,
+	src:      "m f=1 1999999999\n",
+	expect:   "m f=1 1\n",
+}, {
+	testName:    "syntax-error",
+	src:         "m f=1\nm f=x\n",
+	expectError: `at line 2:5: value for field "f" \("x"\) has unrecognized type`,
+}, {
+	testName:    "syntax-error-after-comment",
+	src:         "# one\n# two\nm f=1\nm f=\n",
+	expectError: `at line 4:5: value for field "f" \(""\) has unrecognized type`,
+}, {
+	testName:    "invalid-comment",
+	src:         "m f=1\n# a\tb\n",
+	expectError: `at line 2:1: invalid character found in comment line`,
+}, {
+	testName:    "duplicate-tag",
+	src:         "m,a=1,a=2 f=1\n",
+	expectError: `cannot format entry for measurement "m": tag key "a" out of order \(previous key "a"\)`,
+}}
+
+func TestFormat(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range formatTests {
+		c.Run(test.testName, func(c *qt.C) {
+			res, err := format([]byte(test.src), test.from, test.to)
+			if test.expectError != "" {
+				c.Assert(err, qt.ErrorMatches, test.expectError)
+				return
+			}
+			c.Assert(err, qt.IsNil)
+			c.Assert(string(res), qt.Equals, test.expect)
+
+			// Formatting should be idempotent.
+			res1, err := format(res, test.to, test.to)
+			c.Assert(err, qt.IsNil)
+			c.Assert(string(res1), qt.Equals, string(res))
+		})
+	}
+}
@@ -0,0 +1,213 @@
+// The lpfmt command formats line-protocol files into a canonical form.
+//
+// Usage:
+//
+//	lpfmt [flags] [file...]
+//
+// Without any file arguments, lpfmt formats its standard input
+// and writes the result to its standard output. Otherwise, by default,
+// it writes the formatted contents of each named file to standard output.
+//
+// The canonical form has:
+//
+//   - tags sorted by key
+//   - the minimum escaping necessary
+//   - float values in their shortest form that round-trips exactly
+//   - boolean values spelled as true or false
+//   - integer and unsigned integer values without leading zeros
+//   - no extraneous white space and no blank lines
+//   - a newline at the end of each entry
+//
+// Comment lines are preserved, with leading and trailing white space removed.
+//
+// The -precision flag specifies the precision of the input timestamps
+// (nanoseconds by default). If -to-precision is specified, timestamps
+// are converted to that precision; converting to a coarser precision
+// truncates the timestamps.
+//
+// The flags are:
+//
+//	-d
+//		Do not print formatted output; instead print a diff
+//		between each file and its formatted form.
+//	-l
+//		Do not print formatted output; instead print the names
+//		of files whose formatting differs from lpfmt's.
+//	-w
+//		Do not print formatted output; instead write the
+//		result back to the original file.
+//
+// If any entry is invalid, lpfmt reports the error and leaves
+// the file unchanged. The exit status is 2 if there were any errors.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+var (
+	diffFlag        = flag.Bool("d", false, "display diffs instead of rewriting files")
+	listFlag        = flag.Bool("l", false, "list files whose formatting differs from lpfmt's")
+	writeFlag       = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	precisionFlag   = flag.String("precision", "ns", "input timestamp precision (ns, us, ms or s)")
+	toPrecisionFlag = flag.String("to-precision", "", "output timestamp precision; defaults to -precision")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: lpfmt [flags] [file...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	from, err := lineprotocol.ParsePrecision(*precisionFlag)
+	if err != nil {
+		fatalf("invalid -precision: %v", err)
+	}
+	to := from
+	if *toPrecisionFlag != "" {
+		to, err = lineprotocol.ParsePrecision(*toPrecisionFlag)
+		if err != nil {
+			fatalf("invalid -to-precision: %v", err)
+		}
+	}
+	f := &formatter{
+		from: from,
+		to:   to,
+	}
+	if flag.NArg() == 0 {
+		if *writeFlag {
+			fatalf("cannot use -w with standard input")
+		}
+		f.processFile("<stdin>", os.Stdin, os.Stdout)
+	}
+	for _, path := range flag.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			f.report(err)
+			continue
+		}
+		f.processFile(path, file, os.Stdout)
+		file.Close()
+	}
+	if f.failed {
+		os.Exit(2)
+	}
+}
+
+// formatter holds the state for formatting a sequence of files.
+type formatter struct {
+	from, to lineprotocol.Precision
+	// failed records whether any errors have been reported.
+	failed bool
+}
+
+// processFile formats the contents of in, which has
+// the given file name, writing any output to out.
+func (f *formatter) processFile(filename string, in io.Reader, out io.Writer) {
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		f.report(err)
+		return
+	}
+	res, err := format(src, f.from, f.to)
+	if err != nil {
+		var derr *lineprotocol.DecodeError
+		if errors.As(err, &derr) {
+			err = fmt.Errorf("%s:%d:%d: %v", filename, derr.Line, derr.Column, derr.Err)
+		} else {
+			err = fmt.Errorf("%s: %v", filename, err)
+		}
+		f.report(err)
+		return
+	}
+	if !*listFlag && !*writeFlag && !*diffFlag {
+		if _, err := out.Write(res); err != nil {
+			f.report(err)
+		}
+		return
+	}
+	if bytes.Equal(src, res) {
+		return
+	}
+	if *listFlag {
+		fmt.Fprintln(out, filename)
+	}
+	if *writeFlag {
+		info, err := os.Stat(filename)
+		if err != nil {
+			f.report(err)
+			return
+		}
+		if err := ioutil.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+			f.report(err)
+			return
+		}
+	}
+	if *diffFlag {
+		data, err := diff(filename, src, res)
+		if err != nil {
+			f.report(fmt.Errorf("computing diff: %v", err))
+			return
+		}
+		out.Write(data)
+	}
+}
+
+func (f *formatter) report(err error) {
+	fmt.Fprintf(os.Stderr, "lpfmt: %v\n", err)
+	f.failed = true
+}
+
+// diff returns the output of diff -u between b0 and b1,
+// labelled with the given file name.
+func diff(filename string, b0, b1 []byte) ([]byte, error) {
+	f0, err := writeTempFile("lpfmt", b0)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f0)
+	f1, err := writeTempFile("lpfmt", b1)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f1)
+	data, err := exec.Command("diff", "-u", "-L", filename+".orig", "-L", filename, f0, f1).CombinedOutput()
+	if len(data) > 0 {
+		// diff exits with a non-zero status when the files don't match.
+		// Ignore that failure as long as we get output.
+		return data, nil
+	}
+	return nil, err
+}
+
+func writeTempFile(prefix string, data []byte) (string, error) {
+	file, err := ioutil.TempFile("", prefix)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if err1 := file.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+func fatalf(f string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, "lpfmt: %s\n", fmt.Sprintf(f, a...))
+	os.Exit(2)
+}
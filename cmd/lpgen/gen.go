@@ -0,0 +1,803 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+// generate returns the generated source for the given types,
+// which must be defined in the package in dir.
+// The args are recorded in the generated header.
+func generate(dir string, typeNames []string, args []string) ([]byte, error) {
+	pkgName, specs, err := parsePackage(dir)
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{
+		imports: make(map[string]bool),
+		helpers: make(map[string]bool),
+	}
+	for _, name := range typeNames {
+		spec := specs[name]
+		if spec == nil {
+			return nil, fmt.Errorf("type %s not found in %s", name, dir)
+		}
+		st, ok := spec.Type.(*ast.StructType)
+		if !ok {
+			return nil, fmt.Errorf("type %s is not a struct type", name)
+		}
+		t, err := newStructInfo(name, st)
+		if err != nil {
+			return nil, fmt.Errorf("type %s: %v", name, err)
+		}
+		g.genAppend(t)
+		g.genDecode(t)
+	}
+	var names []string
+	for name := range g.helpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g.body.WriteString(helpers[name])
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by \"lpgen %s\"; DO NOT EDIT.\n\n", strings.Join(args, " "))
+	fmt.Fprintf(&buf, "package %s\n\n", pkgName)
+	fmt.Fprintf(&buf, "import (\n")
+	var imports []string
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	for _, imp := range imports {
+		fmt.Fprintf(&buf, "\t%q\n", imp)
+	}
+	fmt.Fprintf(&buf, "\n\t\"github.com/influxdata/line-protocol/v2/lineprotocol\"\n)\n")
+	buf.Write(g.body.Bytes())
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("cannot format generated code: %v\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+// parsePackage parses the non-test Go files in dir and returns
+// the package name and all the type specs found, keyed by name.
+func parsePackage(dir string) (string, map[string]*ast.TypeSpec, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", nil, err
+	}
+	fset := token.NewFileSet()
+	pkgName := ""
+	specs := make(map[string]*ast.TypeSpec)
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", nil, err
+		}
+		f, err := parser.ParseFile(fset, path, data, 0)
+		if err != nil {
+			return "", nil, err
+		}
+		if pkgName == "" {
+			pkgName = f.Name.Name
+		} else if f.Name.Name != pkgName {
+			return "", nil, fmt.Errorf("multiple packages found in %s (%s and %s)", dir, pkgName, f.Name.Name)
+		}
+		for _, decl := range f.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				specs[spec.Name.Name] = spec
+			}
+		}
+	}
+	if pkgName == "" {
+		return "", nil, fmt.Errorf("no Go files found in %s", dir)
+	}
+	return pkgName, specs, nil
+}
+
+// structInfo holds information on a struct type for
+// which code is being generated.
+type structInfo struct {
+	name        string
+	measurement *fieldInfo
+	timestamp   *fieldInfo
+	// tags holds the tags sorted by key.
+	tags   []*fieldInfo
+	fields []*fieldInfo
+}
+
+// fieldInfo holds information on a struct field.
+type fieldInfo struct {
+	// goName holds the Go name of the field.
+	goName string
+	// key holds the tag or field key.
+	key string
+	// escKey holds the key as it appears in an entry,
+	// with any special characters escaped.
+	escKey string
+	// typ holds the name of the field's type, without any pointer.
+	typ       string
+	isPtr     bool
+	omitEmpty bool
+	kind      basicKind
+	// bits holds the size in bits of numeric types,
+	// or zero for int and uint.
+	bits int
+}
+
+// basicKind classifies the supported field types.
+type basicKind int
+
+const (
+	kindInt basicKind = iota + 1
+	kindUint
+	kindFloat
+	kindBool
+	kindString
+	kindBytes
+	kindTime
+)
+
+var basicTypes = map[string]struct {
+	kind basicKind
+	bits int
+}{
+	"int":     {kindInt, 0},
+	"int8":    {kindInt, 8},
+	"int16":   {kindInt, 16},
+	"int32":   {kindInt, 32},
+	"rune":    {kindInt, 32},
+	"int64":   {kindInt, 64},
+	"uint":    {kindUint, 0},
+	"uint8":   {kindUint, 8},
+	"byte":    {kindUint, 8},
+	"uint16":  {kindUint, 16},
+	"uint32":  {kindUint, 32},
+	"uint64":  {kindUint, 64},
+	"float32": {kindFloat, 32},
+	"float64": {kindFloat, 64},
+	"bool":    {kindBool, 0},
+	"string":  {kindString, 0},
+}
+
+func newStructInfo(name string, st *ast.StructType) (*structInfo, error) {
+	t := &structInfo{
+		name: name,
+	}
+	tagKeys := make(map[string]bool)
+	fieldKeys := make(map[string]bool)
+	for _, field := range st.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+		tagStr, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return nil, err
+		}
+		tag, ok := reflect.StructTag(tagStr).Lookup("lp")
+		if !ok || tag == "-" {
+			continue
+		}
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("embedded field with lp tag not supported")
+		}
+		for _, fieldName := range field.Names {
+			if !fieldName.IsExported() {
+				return nil, fmt.Errorf("field %s with lp tag is not exported", fieldName.Name)
+			}
+			f, kind, err := newFieldInfo(fieldName.Name, field.Type, tag)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", fieldName.Name, err)
+			}
+			switch kind {
+			case "measurement":
+				if t.measurement != nil {
+					return nil, fmt.Errorf("duplicate measurement field %s", f.goName)
+				}
+				if f.kind != kindString && f.kind != kindBytes {
+					return nil, fmt.Errorf("invalid measurement type for field %s", f.goName)
+				}
+				t.measurement = f
+			case "timestamp":
+				if t.timestamp != nil {
+					return nil, fmt.Errorf("duplicate timestamp field %s", f.goName)
+				}
+				if f.kind != kindTime {
+					return nil, fmt.Errorf("invalid timestamp type for field %s", f.goName)
+				}
+				t.timestamp = f
+			case "tag":
+				if tagKeys[f.key] {
+					return nil, fmt.Errorf("duplicate tag key %q", f.key)
+				}
+				if f.kind == kindTime {
+					return nil, fmt.Errorf("invalid tag type for field %s", f.goName)
+				}
+				if f.escKey, err = escapeKey(f.key, true); err != nil {
+					return nil, fmt.Errorf("field %s: %v", f.goName, err)
+				}
+				tagKeys[f.key] = true
+				t.tags = append(t.tags, f)
+			default:
+				if fieldKeys[f.key] {
+					return nil, fmt.Errorf("duplicate field key %q", f.key)
+				}
+				if f.kind == kindTime {
+					return nil, fmt.Errorf("invalid field type for field %s", f.goName)
+				}
+				if f.escKey, err = escapeKey(f.key, false); err != nil {
+					return nil, fmt.Errorf("field %s: %v", f.goName, err)
+				}
+				fieldKeys[f.key] = true
+				t.fields = append(t.fields, f)
+			}
+		}
+	}
+	if t.measurement == nil {
+		return nil, fmt.Errorf("no measurement field")
+	}
+	if len(t.fields) == 0 {
+		return nil, fmt.Errorf("no fields")
+	}
+	sort.Slice(t.tags, func(i, j int) bool {
+		return t.tags[i].key < t.tags[j].key
+	})
+	return t, nil
+}
+
+// newFieldInfo returns information on the field with the given
+// name, type and lp tag, and the kind of the field
+// (measurement, tag, field or timestamp).
+func newFieldInfo(name string, typ ast.Expr, tag string) (*fieldInfo, string, error) {
+	f := &fieldInfo{
+		goName: name,
+	}
+	if star, ok := typ.(*ast.StarExpr); ok {
+		f.isPtr = true
+		typ = star.X
+	}
+	switch typ := typ.(type) {
+	case *ast.Ident:
+		info, ok := basicTypes[typ.Name]
+		if !ok {
+			return nil, "", fmt.Errorf("unsupported type %s", typ.Name)
+		}
+		f.typ, f.kind, f.bits = typ.Name, info.kind, info.bits
+	case *ast.ArrayType:
+		if elem, ok := typ.Elt.(*ast.Ident); !ok || typ.Len != nil || (elem.Name != "byte" && elem.Name != "uint8") {
+			return nil, "", fmt.Errorf("unsupported slice or array type")
+		}
+		f.typ, f.kind = "[]byte", kindBytes
+	case *ast.SelectorExpr:
+		if pkg, ok := typ.X.(*ast.Ident); !ok || pkg.Name != "time" || typ.Sel.Name != "Time" {
+			return nil, "", fmt.Errorf("unsupported type")
+		}
+		f.typ, f.kind = "time.Time", kindTime
+	default:
+		return nil, "", fmt.Errorf("unsupported type")
+	}
+	parts := strings.Split(tag, ",")
+	f.key = parts[0]
+	kind := ""
+	if len(parts) == 1 && parts[0] == "measurement" {
+		kind = "measurement"
+	}
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "omitempty":
+			f.omitEmpty = true
+		case "measurement", "tag", "field", "timestamp":
+			if kind != "" {
+				return nil, "", fmt.Errorf("more than one kind in lp tag %q", tag)
+			}
+			kind = opt
+		default:
+			return nil, "", fmt.Errorf("unknown option %q in lp tag", opt)
+		}
+	}
+	if f.key == "" || kind == "measurement" {
+		f.key = name
+	}
+	return f, kind, nil
+}
+
+// escapeKey checks that the given tag or field key is valid
+// by trying to encode it, and returns its escaped form.
+func escapeKey(key string, isTag bool) (string, error) {
+	var e lineprotocol.Encoder
+	e.StartLine("m")
+	prefix, suffix := "m ", "=true\n"
+	if isTag {
+		e.AddTag(key, "v")
+		e.AddField("f", lineprotocol.BoolValue(true))
+		prefix, suffix = "m,", "=v f=true\n"
+	} else {
+		e.AddField(key, lineprotocol.BoolValue(true))
+	}
+	e.EndLine(time.Time{})
+	if err := e.Err(); err != nil {
+		return "", err
+	}
+	entry := string(e.Bytes())
+	return entry[len(prefix) : len(entry)-len(suffix)], nil
+}
+
+// keyConst returns the name of the constant that holds
+// the escaped key of the field.
+func (t *structInfo) keyConst(f *fieldInfo) string {
+	return "lpgen" + t.name + f.goName + "Key"
+}
+
+type generator struct {
+	body    bytes.Buffer
+	imports map[string]bool
+	helpers map[string]bool
+}
+
+func (g *generator) printf(f string, a ...interface{}) {
+	fmt.Fprintf(&g.body, f, a...)
+}
+
+// genAppend generates the AppendLineProtocol method.
+func (g *generator) genAppend(t *structInfo) {
+	// The keys are escaped and checked when the code is generated, so
+	// the generated code can add them without checking them again.
+	// The measurement and tag values are still checked by the Encoder.
+	g.printf("\n// Escaped tag and field keys for %s.\n", t.name)
+	g.printf("const (\n")
+	for _, f := range t.tags {
+		g.printf("%s = %q\n", t.keyConst(f), f.escKey)
+	}
+	for _, f := range t.fields {
+		g.printf("%s = %q\n", t.keyConst(f), f.escKey)
+	}
+	g.printf(")\n")
+	g.printf("\n// AppendLineProtocol appends x to enc as a single line-protocol entry.\n")
+	g.printf("// Tag keys are added in sorted order.\n")
+	g.printf("// Errors from the Encoder are returned too (see Encoder.Err).\n")
+	g.printf("func (x *%s) AppendLineProtocol(enc *lineprotocol.Encoder) error {\n", t.name)
+	// Convert the field values first so that an invalid value
+	// doesn't leave a partial entry in the encoder.
+	needOK, needErr := false, false
+	for _, f := range t.fields {
+		needOK = needOK || f.kind == kindFloat
+		needErr = needErr || f.kind == kindString || f.kind == kindBytes
+	}
+	if needOK {
+		g.printf("var ok bool\n")
+	}
+	if needErr {
+		g.printf("var err error\n")
+	}
+	for i, f := range t.fields {
+		g.printf("var f%d lineprotocol.Value\n", i)
+		g.startCond(f)
+		switch f.kind {
+		case kindInt:
+			g.printf("f%d = lineprotocol.IntValue(int64(%s))\n", i, f.valueExpr())
+		case kindUint:
+			g.printf("f%d = lineprotocol.UintValue(uint64(%s))\n", i, f.valueExpr())
+		case kindBool:
+			g.printf("f%d = lineprotocol.BoolValue(%s)\n", i, f.valueExpr())
+		case kindFloat:
+			g.imports["fmt"] = true
+			g.printf("if f%d, ok = lineprotocol.FloatValue(float64(%s)); !ok {\n", i, f.valueExpr())
+			g.printf("return fmt.Errorf(\"cannot encode %s.%s: non-finite value %%v\", %s)\n", t.name, f.goName, f.valueExpr())
+			g.printf("}\n")
+		case kindString, kindBytes:
+			g.imports["fmt"] = true
+			g.printf("if f%d, err = lineprotocol.NewValueFromBytes(lineprotocol.String, []byte(%s)); err != nil {\n", i, f.valueExpr())
+			g.printf("return fmt.Errorf(\"cannot encode %s.%s: %%w\", err)\n", t.name, f.goName)
+			g.printf("}\n")
+		}
+		g.endCond(f)
+	}
+	m := t.measurement
+	if m.isPtr {
+		g.imports["fmt"] = true
+		g.printf("if x.%s == nil {\n", m.goName)
+		g.printf("return fmt.Errorf(\"cannot encode %s: nil measurement\")\n", t.name)
+		g.printf("}\n")
+	}
+	if m.kind == kindBytes {
+		g.printf("enc.StartLineRaw(%s)\n", m.valueExpr())
+	} else {
+		g.printf("enc.StartLine(%s)\n", m.valueExpr())
+	}
+	for _, f := range t.tags {
+		g.startCond(f)
+		switch f.kind {
+		case kindString:
+			g.printf("if v := %s; v != \"\" {\n", f.valueExpr())
+			g.printf("enc.AddTagPreEscaped(%s, v)\n", t.keyConst(f))
+			g.printf("}\n")
+		case kindBytes:
+			g.printf("if v := %s; len(v) > 0 {\n", f.valueExpr())
+			g.printf("enc.AddTagPreEscaped(%s, string(v))\n", t.keyConst(f))
+			g.printf("}\n")
+		case kindInt:
+			g.imports["strconv"] = true
+			g.printf("enc.AddTagPreEscaped(%s, strconv.FormatInt(int64(%s), 10))\n", t.keyConst(f), f.valueExpr())
+		case kindUint:
+			g.imports["strconv"] = true
+			g.printf("enc.AddTagPreEscaped(%s, strconv.FormatUint(uint64(%s), 10))\n", t.keyConst(f), f.valueExpr())
+		case kindFloat:
+			g.imports["strconv"] = true
+			g.printf("enc.AddTagPreEscaped(%s, strconv.FormatFloat(float64(%s), 'g', -1, %d))\n", t.keyConst(f), f.valueExpr(), f.bits)
+		case kindBool:
+			g.imports["strconv"] = true
+			g.printf("enc.AddTagPreEscaped(%s, strconv.FormatBool(%s))\n", t.keyConst(f), f.valueExpr())
+		}
+		g.endCond(f)
+	}
+	for i, f := range t.fields {
+		g.startCond(f)
+		g.printf("enc.AddFieldPreEscaped(%s, f%d)\n", t.keyConst(f), i)
+		g.endCond(f)
+	}
+	g.imports["time"] = true
+	if ts := t.timestamp; ts == nil {
+		g.printf("enc.EndLine(time.Time{})\n")
+	} else if ts.isPtr {
+		g.printf("var t time.Time\n")
+		g.printf("if x.%s != nil {\n", ts.goName)
+		g.printf("t = *x.%s\n", ts.goName)
+		g.printf("}\n")
+		g.printf("enc.EndLine(t)\n")
+	} else {
+		g.printf("enc.EndLine(x.%s)\n", ts.goName)
+	}
+	g.printf("return enc.Err()\n")
+	g.printf("}\n")
+}
+
+// startCond generates the start of an if statement that checks
+// whether the field should be encoded. It generates nothing
+// if the field is always encoded.
+func (g *generator) startCond(f *fieldInfo) {
+	if cond := g.presentCond(f); cond != "" {
+		g.printf("if %s {\n", cond)
+	}
+}
+
+// endCond generates the end of the if statement
+// started by startCond.
+func (g *generator) endCond(f *fieldInfo) {
+	if g.presentCond(f) != "" {
+		g.printf("}\n")
+	}
+}
+
+// presentCond returns the condition that reports whether the
+// field should be encoded, or the empty string if it
+// should always be encoded.
+func (g *generator) presentCond(f *fieldInfo) string {
+	var conds []string
+	if f.isPtr {
+		conds = append(conds, fmt.Sprintf("x.%s != nil", f.goName))
+	}
+	if f.omitEmpty {
+		v := f.valueExpr()
+		switch f.kind {
+		case kindInt, kindUint, kindFloat:
+			conds = append(conds, v+" != 0")
+		case kindBool:
+			conds = append(conds, v)
+		case kindString:
+			conds = append(conds, v+` != ""`)
+		case kindBytes:
+			conds = append(conds, v+" != nil")
+		}
+	}
+	return strings.Join(conds, " && ")
+}
+
+// zeroExpr returns the expression for the zero value of the field.
+func (f *fieldInfo) zeroExpr() string {
+	if f.isPtr {
+		return "nil"
+	}
+	switch f.kind {
+	case kindBytes:
+		return "nil"
+	case kindString:
+		return `""`
+	case kindBool:
+		return "false"
+	case kindTime:
+		return "time.Time{}"
+	}
+	return "0"
+}
+
+// valueExpr returns the expression for the value of the field.
+func (f *fieldInfo) valueExpr() string {
+	if f.isPtr {
+		return "(*x." + f.goName + ")"
+	}
+	return "x." + f.goName
+}
+
+// genDecode generates the DecodeLineProtocol method.
+func (g *generator) genDecode(t *structInfo) {
+	g.imports["fmt"] = true
+	g.printf("\n// DecodeLineProtocol decodes the current entry in dec into x.\n")
+	g.printf("// It should be called directly after dec.Next.\n")
+	g.printf("// Tags and fields that don't correspond to any field in x are ignored.\n")
+	g.printf("// The fields of x that hold tags, fields and the timestamp are\n")
+	g.printf("// cleared first, so x can be reused for each entry.\n")
+	g.printf("func (x *%s) DecodeLineProtocol(dec *lineprotocol.Decoder) error {\n", t.name)
+	// Clear all the fields that the entry might not set, so that
+	// values don't leak from one entry to the next when x is reused.
+	// Other fields in x are left alone.
+	for _, f := range t.tags {
+		g.printf("x.%s = %s\n", f.goName, f.zeroExpr())
+	}
+	for _, f := range t.fields {
+		g.printf("x.%s = %s\n", f.goName, f.zeroExpr())
+	}
+	if ts := t.timestamp; ts != nil {
+		g.imports["time"] = true
+		g.printf("x.%s = %s\n", ts.goName, ts.zeroExpr())
+	}
+	g.printf("m, err := dec.Measurement()\n")
+	g.printf("if err != nil {\n")
+	g.printf("return err\n")
+	g.printf("}\n")
+	g.assignText(t, t.measurement, "m", "measurement")
+	g.printf("for {\n")
+	if len(t.tags) > 0 {
+		g.printf("key, val, err := dec.NextTag()\n")
+	} else {
+		g.printf("key, _, err := dec.NextTag()\n")
+	}
+	g.printf("if err != nil {\n")
+	g.printf("return err\n")
+	g.printf("}\n")
+	g.printf("if key == nil {\n")
+	g.printf("break\n")
+	g.printf("}\n")
+	if len(t.tags) > 0 {
+		g.printf("switch string(key) {\n")
+		for _, f := range t.tags {
+			g.printf("case %q:\n", f.key)
+			g.assignText(t, f, "val", "tag")
+		}
+		g.printf("}\n")
+	}
+	g.printf("}\n")
+	g.printf("for {\n")
+	g.printf("key, val, err := dec.NextField()\n")
+	g.printf("if err != nil {\n")
+	g.printf("return err\n")
+	g.printf("}\n")
+	g.printf("if key == nil {\n")
+	g.printf("break\n")
+	g.printf("}\n")
+	g.printf("switch string(key) {\n")
+	for _, f := range t.fields {
+		g.printf("case %q:\n", f.key)
+		g.assignValue(t, f)
+	}
+	g.printf("}\n")
+	g.printf("}\n")
+	g.imports["time"] = true
+	ts := t.timestamp
+	if ts == nil {
+		// The time must still be decoded so that
+		// any error in it is reported.
+		g.printf("if _, err := dec.Time(lineprotocol.Nanosecond, time.Time{}); err != nil {\n")
+		g.printf("return err\n")
+		g.printf("}\n")
+		g.printf("return nil\n")
+		g.printf("}\n")
+		return
+	}
+	g.printf("t, err := dec.Time(lineprotocol.Nanosecond, time.Time{})\n")
+	g.printf("if err != nil {\n")
+	g.printf("return err\n")
+	g.printf("}\n")
+	g.printf("if !t.IsZero() {\n")
+	g.assign(ts, "t")
+	g.printf("}\n")
+	g.printf("return nil\n")
+	g.printf("}\n")
+}
+
+// assign generates code to assign the expression v
+// to the field.
+func (g *generator) assign(f *fieldInfo, v string) {
+	if f.isPtr {
+		g.printf("x.%s = new(%s)\n", f.goName, f.typ)
+		g.printf("*x.%s = %s\n", f.goName, v)
+		return
+	}
+	g.printf("x.%s = %s\n", f.goName, v)
+}
+
+// assignText generates code to assign the text held in the variable
+// named by data to the given field. The what argument describes
+// the kind of data (measurement or tag) for error messages.
+func (g *generator) assignText(t *structInfo, f *fieldInfo, data string, what string) {
+	switch f.kind {
+	case kindString:
+		g.assign(f, f.typ+"("+data+")")
+		return
+	case kindBytes:
+		g.assign(f, "append([]byte(nil), "+data+"...)")
+		return
+	}
+	g.imports["strconv"] = true
+	g.printf("{\n")
+	switch f.kind {
+	case kindInt:
+		g.printf("n, err := strconv.ParseInt(string(%s), 10, %d)\n", data, f.bits)
+	case kindUint:
+		g.printf("n, err := strconv.ParseUint(string(%s), 10, %d)\n", data, f.bits)
+	case kindFloat:
+		g.printf("n, err := strconv.ParseFloat(string(%s), %d)\n", data, f.bits)
+	case kindBool:
+		g.printf("n, err := strconv.ParseBool(string(%s))\n", data)
+	}
+	g.printf("if err != nil {\n")
+	g.printf("return fmt.Errorf(\"cannot decode %s %%q into %s.%s: %%w\", %s, err)\n", what, t.name, f.goName, data)
+	g.printf("}\n")
+	g.assign(f, f.typ+"(n)")
+	g.printf("}\n")
+}
+
+// assignValue generates code to assign the field value held
+// in the variable val to the given field.
+func (g *generator) assignValue(t *structInfo, f *fieldInfo) {
+	g.printf("{\n")
+	switch f.kind {
+	case kindInt:
+		g.helpers["lpgenInt"] = true
+		g.imports["math"] = true
+		g.printf("v, err := lpgenInt(val, %d)\n", f.bits)
+	case kindUint:
+		g.helpers["lpgenUint"] = true
+		g.imports["math"] = true
+		g.printf("v, err := lpgenUint(val, %d)\n", f.bits)
+	case kindFloat:
+		g.helpers["lpgenFloat"] = true
+		g.imports["math"] = true
+		g.printf("v, err := lpgenFloat(val, %d)\n", f.bits)
+	case kindBool:
+		g.helpers["lpgenBool"] = true
+		g.printf("v, err := lpgenBool(val)\n")
+	case kindString, kindBytes:
+		g.helpers["lpgenString"] = true
+		g.printf("v, err := lpgenString(val)\n")
+	}
+	g.printf("if err != nil {\n")
+	g.printf("return fmt.Errorf(\"cannot decode field %%q into %s.%s: %%w\", key, err)\n", t.name, f.goName)
+	g.printf("}\n")
+	switch f.kind {
+	case kindString:
+		g.assign(f, f.typ+"(v)")
+	case kindBytes:
+		g.assign(f, "append([]byte(nil), v...)")
+	default:
+		g.assign(f, f.typ+"(v)")
+	}
+	g.printf("}\n")
+}
+
+// helpers holds the source for helper functions used by the generated
+// code, keyed by function name.
+var helpers = map[string]string{
+	"lpgenInt": `
+// lpgenInt returns v as an integer that fits within the given number
+// of bits. If bits is zero, the size of int is used.
+func lpgenInt(v lineprotocol.Value, bits int) (int64, error) {
+	var x int64
+	switch v.Kind() {
+	case lineprotocol.Int:
+		x = v.IntV()
+	case lineprotocol.Uint:
+		if v.UintV() > math.MaxInt64 {
+			return 0, lineprotocol.ErrValueOutOfRange
+		}
+		x = int64(v.UintV())
+	default:
+		return 0, fmt.Errorf("cannot decode %v value as integer", v.Kind())
+	}
+	if bits == 0 {
+		bits = 32 << (^uint(0) >> 63)
+	}
+	if bits < 64 && (x < -1<<(bits-1) || x >= 1<<(bits-1)) {
+		return 0, lineprotocol.ErrValueOutOfRange
+	}
+	return x, nil
+}
+`,
+	"lpgenUint": `
+// lpgenUint returns v as an unsigned integer that fits within the given number
+// of bits. If bits is zero, the size of uint is used.
+func lpgenUint(v lineprotocol.Value, bits int) (uint64, error) {
+	var x uint64
+	switch v.Kind() {
+	case lineprotocol.Uint:
+		x = v.UintV()
+	case lineprotocol.Int:
+		if v.IntV() < 0 {
+			return 0, lineprotocol.ErrValueOutOfRange
+		}
+		x = uint64(v.IntV())
+	default:
+		return 0, fmt.Errorf("cannot decode %v value as unsigned integer", v.Kind())
+	}
+	if bits == 0 {
+		bits = 32 << (^uint(0) >> 63)
+	}
+	if bits < 64 && x > math.MaxUint64>>(64-bits) {
+		return 0, lineprotocol.ErrValueOutOfRange
+	}
+	return x, nil
+}
+`,
+	"lpgenFloat": `
+// lpgenFloat returns v as a float that fits within the given number of bits.
+func lpgenFloat(v lineprotocol.Value, bits int) (float64, error) {
+	var x float64
+	switch v.Kind() {
+	case lineprotocol.Float:
+		x = v.FloatV()
+	case lineprotocol.Int:
+		x = float64(v.IntV())
+	case lineprotocol.Uint:
+		x = float64(v.UintV())
+	default:
+		return 0, fmt.Errorf("cannot decode %v value as float", v.Kind())
+	}
+	if bits == 32 && math.Abs(x) > math.MaxFloat32 {
+		return 0, lineprotocol.ErrValueOutOfRange
+	}
+	return x, nil
+}
+`,
+	"lpgenBool": `
+// lpgenBool returns v as a bool.
+func lpgenBool(v lineprotocol.Value) (bool, error) {
+	if v.Kind() != lineprotocol.Bool {
+		return false, fmt.Errorf("cannot decode %v value as bool", v.Kind())
+	}
+	return v.BoolV(), nil
+}
+`,
+	"lpgenString": `
+// lpgenString returns v as a byte slice.
+func lpgenString(v lineprotocol.Value) ([]byte, error) {
+	if v.Kind() != lineprotocol.String {
+		return nil, fmt.Errorf("cannot decode %v value as string", v.Kind())
+	}
+	return v.BytesV(), nil
+}
+`,
+}
@@ -0,0 +1,474 @@
+// Code generated by "lpgen -type CPU,Mem,Disk"; DO NOT EDIT.
+
+package lpgentest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+// Escaped tag and field keys for CPU.
+const (
+	lpgenCPUCoreKey   = "core"
+	lpgenCPUHostKey   = "host"
+	lpgenCPURegionKey = "region"
+	lpgenCPUUsageKey  = "usage"
+	lpgenCPUIdleKey   = "idle"
+	lpgenCPUCountKey  = "count"
+	lpgenCPUTotalKey  = "total"
+	lpgenCPUOKKey     = "ok"
+	lpgenCPUNoteKey   = "note"
+	lpgenCPURawKey    = "raw"
+	lpgenCPUPtrKey    = "ptr"
+)
+
+// AppendLineProtocol appends x to enc as a single line-protocol entry.
+// Tag keys are added in sorted order.
+// Errors from the Encoder are returned too (see Encoder.Err).
+func (x *CPU) AppendLineProtocol(enc *lineprotocol.Encoder) error {
+	var ok bool
+	var err error
+	var f0 lineprotocol.Value
+	if f0, ok = lineprotocol.FloatValue(float64(x.Usage)); !ok {
+		return fmt.Errorf("cannot encode CPU.Usage: non-finite value %v", x.Usage)
+	}
+	var f1 lineprotocol.Value
+	if x.Idle != 0 {
+		if f1, ok = lineprotocol.FloatValue(float64(x.Idle)); !ok {
+			return fmt.Errorf("cannot encode CPU.Idle: non-finite value %v", x.Idle)
+		}
+	}
+	var f2 lineprotocol.Value
+	f2 = lineprotocol.IntValue(int64(x.Count))
+	var f3 lineprotocol.Value
+	f3 = lineprotocol.UintValue(uint64(x.Total))
+	var f4 lineprotocol.Value
+	f4 = lineprotocol.BoolValue(x.OK)
+	var f5 lineprotocol.Value
+	if x.Note != "" {
+		if f5, err = lineprotocol.NewValueFromBytes(lineprotocol.String, []byte(x.Note)); err != nil {
+			return fmt.Errorf("cannot encode CPU.Note: %w", err)
+		}
+	}
+	var f6 lineprotocol.Value
+	if x.Raw != nil {
+		if f6, err = lineprotocol.NewValueFromBytes(lineprotocol.String, []byte(x.Raw)); err != nil {
+			return fmt.Errorf("cannot encode CPU.Raw: %w", err)
+		}
+	}
+	var f7 lineprotocol.Value
+	if x.Ptr != nil {
+		f7 = lineprotocol.IntValue(int64((*x.Ptr)))
+	}
+	enc.StartLine(x.Name)
+	enc.AddTagPreEscaped(lpgenCPUCoreKey, strconv.FormatInt(int64(x.Core), 10))
+	if v := x.Host; v != "" {
+		enc.AddTagPreEscaped(lpgenCPUHostKey, v)
+	}
+	if x.Region != nil {
+		if v := (*x.Region); v != "" {
+			enc.AddTagPreEscaped(lpgenCPURegionKey, v)
+		}
+	}
+	enc.AddFieldPreEscaped(lpgenCPUUsageKey, f0)
+	if x.Idle != 0 {
+		enc.AddFieldPreEscaped(lpgenCPUIdleKey, f1)
+	}
+	enc.AddFieldPreEscaped(lpgenCPUCountKey, f2)
+	enc.AddFieldPreEscaped(lpgenCPUTotalKey, f3)
+	enc.AddFieldPreEscaped(lpgenCPUOKKey, f4)
+	if x.Note != "" {
+		enc.AddFieldPreEscaped(lpgenCPUNoteKey, f5)
+	}
+	if x.Raw != nil {
+		enc.AddFieldPreEscaped(lpgenCPURawKey, f6)
+	}
+	if x.Ptr != nil {
+		enc.AddFieldPreEscaped(lpgenCPUPtrKey, f7)
+	}
+	enc.EndLine(x.Time)
+	return enc.Err()
+}
+
+// DecodeLineProtocol decodes the current entry in dec into x.
+// It should be called directly after dec.Next.
+// Tags and fields that don't correspond to any field in x are ignored.
+// The fields of x that hold tags, fields and the timestamp are
+// cleared first, so x can be reused for each entry.
+func (x *CPU) DecodeLineProtocol(dec *lineprotocol.Decoder) error {
+	x.Core = 0
+	x.Host = ""
+	x.Region = nil
+	x.Usage = 0
+	x.Idle = 0
+	x.Count = 0
+	x.Total = 0
+	x.OK = false
+	x.Note = ""
+	x.Raw = nil
+	x.Ptr = nil
+	x.Time = time.Time{}
+	m, err := dec.Measurement()
+	if err != nil {
+		return err
+	}
+	x.Name = string(m)
+	for {
+		key, val, err := dec.NextTag()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			break
+		}
+		switch string(key) {
+		case "core":
+			{
+				n, err := strconv.ParseInt(string(val), 10, 0)
+				if err != nil {
+					return fmt.Errorf("cannot decode tag %q into CPU.Core: %w", val, err)
+				}
+				x.Core = int(n)
+			}
+		case "host":
+			x.Host = string(val)
+		case "region":
+			x.Region = new(string)
+			*x.Region = string(val)
+		}
+	}
+	for {
+		key, val, err := dec.NextField()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			break
+		}
+		switch string(key) {
+		case "usage":
+			{
+				v, err := lpgenFloat(val, 64)
+				if err != nil {
+					return fmt.Errorf("cannot decode field %q into CPU.Usage: %w", key, err)
+				}
+				x.Usage = float64(v)
+			}
+		case "idle":
+			{
+				v, err := lpgenFloat(val, 32)
+				if err != nil {
+					return fmt.Errorf("cannot decode field %q into CPU.Idle: %w", key, err)
+				}
+				x.Idle = float32(v)
+			}
+		case "count":
+			{
+				v, err := lpgenInt(val, 16)
+				if err != nil {
+					return fmt.Errorf("cannot decode field %q into CPU.Count: %w", key, err)
+				}
+				x.Count = int16(v)
+			}
+		case "total":
+			{
+				v, err := lpgenUint(val, 64)
+				if err != nil {
+					return fmt.Errorf("cannot decode field %q into CPU.Total: %w", key, err)
+				}
+				x.Total = uint64(v)
+			}
+		case "ok":
+			{
+				v, err := lpgenBool(val)
+				if err != nil {
+					return fmt.Errorf("cannot decode field %q into CPU.OK: %w", key, err)
+				}
+				x.OK = bool(v)
+			}
+		case "note":
+			{
+				v, err := lpgenString(val)
+				if err != nil {
+					return fmt.Errorf("cannot decode field %q into CPU.Note: %w", key, err)
+				}
+				x.Note = string(v)
+			}
+		case "raw":
+			{
+				v, err := lpgenString(val)
+				if err != nil {
+					return fmt.Errorf("cannot decode field %q into CPU.Raw: %w", key, err)
+				}
+				x.Raw = append([]byte(nil), v...)
+			}
+		case "ptr":
+			{
+				v, err := lpgenInt(val, 64)
+				if err != nil {
+					return fmt.Errorf("cannot decode field %q into CPU.Ptr: %w", key, err)
+				}
+				x.Ptr = new(int64)
+				*x.Ptr = int64(v)
+			}
+		}
+	}
+	t, err := dec.Time(lineprotocol.Nanosecond, time.Time{})
+	if err != nil {
+		return err
+	}
+	if !t.IsZero() {
+		x.Time = t
+	}
+	return nil
+}
+
+// Escaped tag and field keys for Mem.
+const (
+	lpgenMemUsedKey = "used"
+	lpgenMemFreeKey = "free"
+)
+
+// AppendLineProtocol appends x to enc as a single line-protocol entry.
+// Tag keys are added in sorted order.
+// Errors from the Encoder are returned too (see Encoder.Err).
+func (x *Mem) AppendLineProtocol(enc *lineprotocol.Encoder) error {
+	var f0 lineprotocol.Value
+	f0 = lineprotocol.UintValue(uint64(x.Used))
+	var f1 lineprotocol.Value
+	if x.Free != nil {
+		f1 = lineprotocol.UintValue(uint64((*x.Free)))
+	}
+	enc.StartLineRaw(x.Name)
+	enc.AddFieldPreEscaped(lpgenMemUsedKey, f0)
+	if x.Free != nil {
+		enc.AddFieldPreEscaped(lpgenMemFreeKey, f1)
+	}
+	var t time.Time
+	if x.Time != nil {
+		t = *x.Time
+	}
+	enc.EndLine(t)
+	return enc.Err()
+}
+
+// DecodeLineProtocol decodes the current entry in dec into x.
+// It should be called directly after dec.Next.
+// Tags and fields that don't correspond to any field in x are ignored.
+// The fields of x that hold tags, fields and the timestamp are
+// cleared first, so x can be reused for each entry.
+func (x *Mem) DecodeLineProtocol(dec *lineprotocol.Decoder) error {
+	x.Used = 0
+	x.Free = nil
+	x.Time = nil
+	m, err := dec.Measurement()
+	if err != nil {
+		return err
+	}
+	x.Name = append([]byte(nil), m...)
+	for {
+		key, _, err := dec.NextTag()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			break
+		}
+	}
+	for {
+		key, val, err := dec.NextField()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			break
+		}
+		switch string(key) {
+		case "used":
+			{
+				v, err := lpgenUint(val, 32)
+				if err != nil {
+					return fmt.Errorf("cannot decode field %q into Mem.Used: %w", key, err)
+				}
+				x.Used = uint32(v)
+			}
+		case "free":
+			{
+				v, err := lpgenUint(val, 0)
+				if err != nil {
+					return fmt.Errorf("cannot decode field %q into Mem.Free: %w", key, err)
+				}
+				x.Free = new(uint)
+				*x.Free = uint(v)
+			}
+		}
+	}
+	t, err := dec.Time(lineprotocol.Nanosecond, time.Time{})
+	if err != nil {
+		return err
+	}
+	if !t.IsZero() {
+		x.Time = new(time.Time)
+		*x.Time = t
+	}
+	return nil
+}
+
+// Escaped tag and field keys for Disk.
+const (
+	lpgenDiskMountKey = "mount\\ point"
+	lpgenDiskFreeKey  = "free\\=space"
+)
+
+// AppendLineProtocol appends x to enc as a single line-protocol entry.
+// Tag keys are added in sorted order.
+// Errors from the Encoder are returned too (see Encoder.Err).
+func (x *Disk) AppendLineProtocol(enc *lineprotocol.Encoder) error {
+	var f0 lineprotocol.Value
+	f0 = lineprotocol.IntValue(int64(x.Free))
+	enc.StartLine(x.Name)
+	if v := x.Mount; v != "" {
+		enc.AddTagPreEscaped(lpgenDiskMountKey, v)
+	}
+	enc.AddFieldPreEscaped(lpgenDiskFreeKey, f0)
+	enc.EndLine(time.Time{})
+	return enc.Err()
+}
+
+// DecodeLineProtocol decodes the current entry in dec into x.
+// It should be called directly after dec.Next.
+// Tags and fields that don't correspond to any field in x are ignored.
+// The fields of x that hold tags, fields and the timestamp are
+// cleared first, so x can be reused for each entry.
+func (x *Disk) DecodeLineProtocol(dec *lineprotocol.Decoder) error {
+	x.Mount = ""
+	x.Free = 0
+	m, err := dec.Measurement()
+	if err != nil {
+		return err
+	}
+	x.Name = string(m)
+	for {
+		key, val, err := dec.NextTag()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			break
+		}
+		switch string(key) {
+		case "mount point":
+			x.Mount = string(val)
+		}
+	}
+	for {
+		key, val, err := dec.NextField()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			break
+		}
+		switch string(key) {
+		case "free=space":
+			{
+				v, err := lpgenInt(val, 64)
+				if err != nil {
+					return fmt.Errorf("cannot decode field %q into Disk.Free: %w", key, err)
+				}
+				x.Free = int64(v)
+			}
+		}
+	}
+	if _, err := dec.Time(lineprotocol.Nanosecond, time.Time{}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// lpgenBool returns v as a bool.
+func lpgenBool(v lineprotocol.Value) (bool, error) {
+	if v.Kind() != lineprotocol.Bool {
+		return false, fmt.Errorf("cannot decode %v value as bool", v.Kind())
+	}
+	return v.BoolV(), nil
+}
+
+// lpgenFloat returns v as a float that fits within the given number of bits.
+func lpgenFloat(v lineprotocol.Value, bits int) (float64, error) {
+	var x float64
+	switch v.Kind() {
+	case lineprotocol.Float:
+		x = v.FloatV()
+	case lineprotocol.Int:
+		x = float64(v.IntV())
+	case lineprotocol.Uint:
+		x = float64(v.UintV())
+	default:
+		return 0, fmt.Errorf("cannot decode %v value as float", v.Kind())
+	}
+	if bits == 32 && math.Abs(x) > math.MaxFloat32 {
+		return 0, lineprotocol.ErrValueOutOfRange
+	}
+	return x, nil
+}
+
+// lpgenInt returns v as an integer that fits within the given number
+// of bits. If bits is zero, the size of int is used.
+func lpgenInt(v lineprotocol.Value, bits int) (int64, error) {
+	var x int64
+	switch v.Kind() {
+	case lineprotocol.Int:
+		x = v.IntV()
+	case lineprotocol.Uint:
+		if v.UintV() > math.MaxInt64 {
+			return 0, lineprotocol.ErrValueOutOfRange
+		}
+		x = int64(v.UintV())
+	default:
+		return 0, fmt.Errorf("cannot decode %v value as integer", v.Kind())
+	}
+	if bits == 0 {
+		bits = 32 << (^uint(0) >> 63)
+	}
+	if bits < 64 && (x < -1<<(bits-1) || x >= 1<<(bits-1)) {
+		return 0, lineprotocol.ErrValueOutOfRange
+	}
+	return x, nil
+}
+
+// lpgenString returns v as a byte slice.
+func lpgenString(v lineprotocol.Value) ([]byte, error) {
+	if v.Kind() != lineprotocol.String {
+		return nil, fmt.Errorf("cannot decode %v value as string", v.Kind())
+	}
+	return v.BytesV(), nil
+}
+
+// lpgenUint returns v as an unsigned integer that fits within the given number
+// of bits. If bits is zero, the size of uint is used.
+func lpgenUint(v lineprotocol.Value, bits int) (uint64, error) {
+	var x uint64
+	switch v.Kind() {
+	case lineprotocol.Uint:
+		x = v.UintV()
+	case lineprotocol.Int:
+		if v.IntV() < 0 {
+			return 0, lineprotocol.ErrValueOutOfRange
+		}
+		x = uint64(v.IntV())
+	default:
+		return 0, fmt.Errorf("cannot decode %v value as unsigned integer", v.Kind())
+	}
+	if bits == 0 {
+		bits = 32 << (^uint(0) >> 63)
+	}
+	if bits < 64 && x > math.MaxUint64>>(64-bits) {
+		return 0, lineprotocol.ErrValueOutOfRange
+	}
+	return x, nil
+}
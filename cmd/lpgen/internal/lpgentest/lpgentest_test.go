@@ -0,0 +1,229 @@
+package lpgentest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+func newString(s string) *string {
+	return &s
+}
+
+func newInt64(i int64) *int64 {
+	return &i
+}
+
+func newUint(i uint) *uint {
+	return &i
+}
+
+func newTime(t time.Time) *time.Time {
+	return &t
+}
+
+var roundTripTests = []struct {
+	testName string
+	value    interface {
+		AppendLineProtocol(*lineprotocol.Encoder) error
+	}
+	expect string
+}{{
+	testName: "all-fields",
+	value: &CPU{
+		Name:   "cpu",
+		Host:   "foo",
+		Region: newString("us-east"),
+		Core:   3,
+		Usage:  0.5,
+		Idle:   0.25,
+		Count:  -12,
+		Total:  99,
+		OK:     true,
+		Note:   "hello \"world\"",
+		Raw:    []byte("raw"),
+		Ptr:    newInt64(-1),
+		Time:   time.Unix(0, 1625823259000000000),
+	},
+	expect: `cpu,core=3,host=foo,region=us-east usage=0.5,idle=0.25,count=-12i,total=99u,ok=true,note="hello \"world\"",raw="raw",ptr=-1i 1625823259000000000` + "\n",
+}, {
+	testName: "omitted-fields",
+	value: &CPU{
+		Name:  "cpu",
+		Usage: 1,
+	},
+	expect: "cpu,core=0 usage=1,count=0i,total=0u,ok=false\n",
+}, {
+	testName: "bytes-measurement",
+	value: &Mem{
+		Name: []byte("mem"),
+		Used: 10,
+		Free: newUint(20),
+		Time: newTime(time.Unix(0, 1000)),
+	},
+	expect: "mem used=10u,free=20u 1000\n",
+}, {
+	testName: "nil-pointers",
+	value: &Mem{
+		Name: []byte("mem"),
+		Used: 10,
+	},
+	expect: "mem used=10u\n",
+}, {
+	testName: "escaped-keys",
+	value: &Disk{
+		Name:  "disk",
+		Mount: "/var/lib",
+		Free:  1,
+	},
+	expect: `disk,mount\ point=/var/lib free\=space=1i` + "\n",
+}}
+
+func TestRoundTrip(t *testing.T) {
+	for _, test := range roundTripTests {
+		t.Run(test.testName, func(t *testing.T) {
+			c := qt.New(t)
+			var enc lineprotocol.Encoder
+			err := test.value.AppendLineProtocol(&enc)
+			c.Assert(err, qt.IsNil)
+			c.Assert(enc.Err(), qt.IsNil)
+			c.Assert(string(enc.Bytes()), qt.Equals, test.expect)
+
+			// The generated code should produce the same
+			// result as Marshal.
+			data, err := lineprotocol.Marshal(test.value)
+			c.Assert(err, qt.IsNil)
+			c.Assert(string(data), qt.Equals, test.expect)
+
+			dec := lineprotocol.NewDecoderWithBytes(enc.Bytes())
+			c.Assert(dec.Next(), qt.IsTrue)
+			switch v := test.value.(type) {
+			case *CPU:
+				var got, want CPU
+				c.Assert(got.DecodeLineProtocol(dec), qt.IsNil)
+				c.Assert(lineprotocol.Unmarshal(data, &want), qt.IsNil)
+				c.Assert(got, qt.DeepEquals, want)
+				if v.Region == nil {
+					// Unmarshal can't distinguish a nil pointer
+					// from an empty tag.
+					got.Region = nil
+				}
+				c.Assert(&got, qt.DeepEquals, v)
+			case *Mem:
+				var got, want Mem
+				c.Assert(got.DecodeLineProtocol(dec), qt.IsNil)
+				c.Assert(lineprotocol.Unmarshal(data, &want), qt.IsNil)
+				c.Assert(got, qt.DeepEquals, want)
+				c.Assert(&got, qt.DeepEquals, v)
+			case *Disk:
+				var got, want Disk
+				c.Assert(got.DecodeLineProtocol(dec), qt.IsNil)
+				c.Assert(lineprotocol.Unmarshal(data, &want), qt.IsNil)
+				c.Assert(got, qt.DeepEquals, want)
+				c.Assert(&got, qt.DeepEquals, v)
+			}
+			c.Assert(dec.Next(), qt.IsFalse)
+		})
+	}
+}
+
+func TestAppendError(t *testing.T) {
+	c := qt.New(t)
+	var enc lineprotocol.Encoder
+	err := (&CPU{
+		Name:  "cpu",
+		Usage: math.NaN(),
+	}).AppendLineProtocol(&enc)
+	c.Assert(err, qt.ErrorMatches, `cannot encode CPU.Usage: non-finite value NaN`)
+	// No partial entry should have been written.
+	c.Assert(enc.Bytes(), qt.HasLen, 0)
+
+	// Errors from the encoder are returned too.
+	err = (&Mem{}).AppendLineProtocol(&enc)
+	c.Assert(err, qt.ErrorMatches, `invalid measurement ""`)
+	c.Assert(enc.Err(), qt.Equals, err)
+}
+
+var decodeErrorTests = []struct {
+	testName    string
+	data        string
+	expectError string
+}{{
+	testName:    "tag-out-of-range",
+	data:        "cpu,core=x usage=1",
+	expectError: `cannot decode tag "x" into CPU.Core: strconv.ParseInt: parsing "x": invalid syntax`,
+}, {
+	testName:    "field-wrong-kind",
+	data:        "cpu usage=\"x\"",
+	expectError: `cannot decode field "usage" into CPU.Usage: cannot decode string value as float`,
+}, {
+	testName:    "field-out-of-range",
+	data:        "cpu count=100000i",
+	expectError: `cannot decode field "count" into CPU.Count: line-protocol value out of range`,
+}, {
+	testName:    "syntax-error",
+	data:        "cpu usage=",
+	expectError: `at line 1:11: expected value for field "usage", found end of input`,
+}}
+
+func TestDecodeError(t *testing.T) {
+	for _, test := range decodeErrorTests {
+		t.Run(test.testName, func(t *testing.T) {
+			c := qt.New(t)
+			dec := lineprotocol.NewDecoderWithBytes([]byte(test.data))
+			c.Assert(dec.Next(), qt.IsTrue)
+			var x CPU
+			c.Assert(x.DecodeLineProtocol(dec), qt.ErrorMatches, test.expectError)
+		})
+	}
+}
+
+func TestDecodeIgnoresUnknownKeys(t *testing.T) {
+	c := qt.New(t)
+	dec := lineprotocol.NewDecoderWithBytes([]byte("cpu,a=b,host=h other=1,usage=2 1000\n"))
+	c.Assert(dec.Next(), qt.IsTrue)
+	var x CPU
+	c.Assert(x.DecodeLineProtocol(dec), qt.IsNil)
+	c.Assert(x, qt.DeepEquals, CPU{
+		Name:  "cpu",
+		Host:  "h",
+		Usage: 2,
+		Time:  time.Unix(0, 1000),
+	})
+}
+
+func TestDecodeReuse(t *testing.T) {
+	c := qt.New(t)
+	dec := lineprotocol.NewDecoderWithBytes([]byte(`cpu,host=a,region=eu usage=1,note="x",ptr=3i 5
+cpu usage=2
+`))
+	x := CPU{
+		Ignore: "keep",
+	}
+	c.Assert(dec.Next(), qt.IsTrue)
+	c.Assert(x.DecodeLineProtocol(dec), qt.IsNil)
+	c.Assert(x, qt.DeepEquals, CPU{
+		Name:   "cpu",
+		Host:   "a",
+		Region: newString("eu"),
+		Usage:  1,
+		Note:   "x",
+		Ptr:    newInt64(3),
+		Time:   time.Unix(0, 5),
+		Ignore: "keep",
+	})
+
+	// Nothing from the previous entry should remain, but
+	// fields without an lp tag are left alone.
+	c.Assert(dec.Next(), qt.IsTrue)
+	c.Assert(x.DecodeLineProtocol(dec), qt.IsNil)
+	c.Assert(x, qt.DeepEquals, CPU{
+		Name:   "cpu",
+		Usage:  2,
+		Ignore: "keep",
+	})
+}
@@ -0,0 +1,39 @@
+// Package lpgentest holds types used to test the code
+// generated by lpgen.
+package lpgentest
+
+import "time"
+
+//go:generate go run github.com/influxdata/line-protocol/v2/cmd/lpgen -type CPU,Mem,Disk
+
+type CPU struct {
+	Name   string    `lp:"measurement"`
+	Host   string    `lp:"host,tag"`
+	Region *string   `lp:"region,tag"`
+	Core   int       `lp:"core,tag"`
+	Usage  float64   `lp:"usage"`
+	Idle   float32   `lp:"idle,omitempty"`
+	Count  int16     `lp:"count"`
+	Total  uint64    `lp:"total"`
+	OK     bool      `lp:"ok"`
+	Note   string    `lp:"note,omitempty"`
+	Raw    []byte    `lp:"raw,omitempty"`
+	Ptr    *int64    `lp:"ptr"`
+	Time   time.Time `lp:",timestamp"`
+
+	Ignore string `lp:"-"`
+}
+
+type Mem struct {
+	Name []byte     `lp:"measurement"`
+	Used uint32     `lp:"used"`
+	Free *uint      `lp:"free"`
+	Time *time.Time `lp:",timestamp"`
+}
+
+// Disk has keys that need escaping.
+type Disk struct {
+	Name  string `lp:"measurement"`
+	Mount string `lp:"mount point,tag"`
+	Free  int64  `lp:"free=space"`
+}
@@ -0,0 +1,75 @@
+// The lpgen command generates methods that encode and decode
+// line-protocol entries to and from Go struct types without
+// using reflection.
+//
+// It is intended to be used with go generate, for example:
+//
+//	//go:generate go run github.com/influxdata/line-protocol/v2/cmd/lpgen -type CPU,Mem
+//
+// For each named type, which must be a struct type defined in
+// the package in the current directory, lpgen generates
+// two methods:
+//
+//	func (x *T) AppendLineProtocol(enc *lineprotocol.Encoder) error
+//	func (x *T) DecodeLineProtocol(dec *lineprotocol.Decoder) error
+//
+// The struct fields are interpreted using "lp" struct tags in the
+// same way as lineprotocol.Marshal, except that only fields of
+// basic type (integer, unsigned integer, float, bool and string
+// types, []byte, and time.Time for the timestamp), or pointers to
+// those types, are supported.
+//
+// All tag and field keys are checked for validity and escaped when
+// the code is generated, and tags are encoded in sorted order, so
+// AppendLineProtocol adds the keys with Encoder.AddTagPreEscaped
+// and Encoder.AddFieldPreEscaped without checking them again.
+// The measurement and tag values are still checked unless the
+// Encoder is in lax mode (see Encoder.SetLax), and AppendLineProtocol
+// returns any error recorded by the Encoder.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of type names; must be set")
+	output    = flag.String("output", "", "output file name; default <type>_lp.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: lpgen -type T [-output file] [directory]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	types := strings.Split(*typeNames, ",")
+	src, err := generate(dir, types, os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lpgen: %v\n", err)
+		os.Exit(1)
+	}
+	outputName := *output
+	if outputName == "" {
+		outputName = filepath.Join(dir, strings.ToLower(types[0])+"_lp.go")
+	}
+	if err := ioutil.WriteFile(outputName, src, 0666); err != nil {
+		fmt.Fprintf(os.Stderr, "lpgen: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -1,56 +1,225 @@
+// The lpverify command reads line-protocol entries from the named
+// files, or from its standard input if there are none, and reports
+// any that are invalid. Gzip-compressed input is decompressed
+// automatically.
+//
+// Usage:
+//
+//	lpverify [flags] [file...]
+//
+// Timestamps are interpreted with the precision specified by the
+// -precision flag (nanoseconds by default) and entries with
+// timestamps that cannot be represented as nanoseconds since
+// the epoch are reported as invalid.
+//
+// If -min-time or -max-time is specified, entries with timestamps
+// outside that range are also reported. This can be used, for
+// example, to check that exported data falls within the retention
+// period of the bucket it is to be written to. A time can be given
+// either in RFC3339 format or as a duration relative to the current
+// time (for example -720h). Entries without a timestamp are not
+// checked against the range.
+//
+// The -format flag selects the output format:
+//
+//	text   one line per error on standard error (the default)
+//	json   a JSON object holding all the errors and a summary
+//	sarif  a SARIF 2.1.0 log, as used by code-scanning tools
+//	junit  a JUnit XML report, with a test suite for each file
+//
+// The machine-readable formats are written to standard output.
+// All formats include a summary holding the number of valid and
+// invalid entries and the number of distinct measurements in
+// valid entries.
+//
+// If -max-errors is non-zero, checking stops after that many errors
+// have been found.
+//
+// The exit status is 1 if any entry is invalid.
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"time"
 
 	"github.com/influxdata/line-protocol/v2/lineprotocol"
 )
 
+var (
+	precisionFlag = flag.String("precision", "ns", "timestamp precision (ns, us, ms or s)")
+	minTimeFlag   = flag.String("min-time", "", "earliest allowed timestamp (RFC3339 or duration relative to now)")
+	maxTimeFlag   = flag.String("max-time", "", "latest allowed timestamp (RFC3339 or duration relative to now)")
+	formatFlag    = flag.String("format", "text", "output format (text, json, sarif or junit)")
+	maxErrorsFlag = flag.Int("max-errors", 0, "stop after this many errors; 0 means no limit")
+)
+
+// maxLineText holds the maximum amount of line text
+// included in each error record.
+const maxLineText = 256
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: lpverify [flags] [file...]\n")
+	flag.PrintDefaults()
+}
+
 func main() {
-	dec := lineprotocol.NewDecoder(os.Stdin)
-	if !verify(dec) {
+	flag.Usage = usage
+	flag.Parse()
+	writeReport, ok := formats[*formatFlag]
+	if !ok {
+		fatalf("unknown -format %q", *formatFlag)
+	}
+	prec, err := lineprotocol.ParsePrecision(*precisionFlag)
+	if err != nil {
+		fatalf("invalid -precision flag: %v", err)
+	}
+	now := time.Now()
+	minTime, err := parseTime(*minTimeFlag, now)
+	if err != nil {
+		fatalf("invalid -min-time flag: %v", err)
+	}
+	maxTime, err := parseTime(*maxTimeFlag, now)
+	if err != nil {
+		fatalf("invalid -max-time flag: %v", err)
+	}
+	if !minTime.IsZero() && !maxTime.IsZero() && maxTime.Before(minTime) {
+		fatalf("-max-time is before -min-time")
+	}
+	v := &verifier{
+		prec:      prec,
+		minTime:   minTime,
+		maxTime:   maxTime,
+		maxErrors: *maxErrorsFlag,
+		report:    newReport(),
+	}
+	if flag.NArg() == 0 {
+		v.verify("<stdin>", os.Stdin)
+	}
+	for _, file := range flag.Args() {
+		if v.full() {
+			v.report.Summary.Truncated = true
+			break
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		v.verify(file, f)
+		f.Close()
+	}
+	if err := writeReport(os.Stdout, os.Stderr, v.report); err != nil {
+		fatalf("cannot write report: %v", err)
+	}
+	if len(v.report.Errors) > 0 {
 		os.Exit(1)
 	}
 }
 
-func verify(dec *lineprotocol.Decoder) (ok bool) {
-	logErr := func(err error) {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		ok = false
-	}
-nextLine:
-	for dec.Next() {
-		_, err := dec.Measurement()
-		if err != nil {
-			logErr(err)
-			continue nextLine
+// verifier checks line-protocol entries and accumulates
+// the results in a report.
+type verifier struct {
+	prec      lineprotocol.Precision
+	minTime   time.Time
+	maxTime   time.Time
+	maxErrors int
+	report    *report
+}
+
+// verify checks all the entries read from r, recording
+// any errors against the given file name.
+func (v *verifier) verify(file string, r io.Reader) {
+	rep := v.report
+	rep.Summary.Files++
+	dec := lineprotocol.NewDecoderCompressed(r, nil)
+	dec.SetErrorLineLength(maxLineText)
+	var p lineprotocol.Point
+	for entry := 1; dec.Next(); entry++ {
+		if v.full() {
+			rep.Summary.Truncated = true
+			return
 		}
-		for {
-			key, _, err := dec.NextTag()
-			if err != nil {
-				logErr(err)
-				continue nextLine
-			}
-			if key == nil {
-				break
-			}
+		if err := dec.DecodePoint(&p, v.prec, time.Time{}); err != nil {
+			v.addError(file, entry, dec, err)
+			continue
 		}
-		for {
-			key, _, err := dec.NextField()
-			if err != nil {
-				logErr(err)
-				continue nextLine
+		if !p.Time.IsZero() {
+			if err := checkTime(p.Time, v.minTime, v.maxTime); err != nil {
+				v.addError(file, entry, dec, err)
+				continue
 			}
-			if key == nil {
-				break
-			}
-		}
-		// TODO precision flag so we can check time bounds.
-		if _, err := dec.TimeBytes(); err != nil {
-			logErr(err)
-			continue nextLine
 		}
+		rep.Summary.Valid++
+		rep.measurements[string(p.Measurement)] = true
+		rep.Summary.Measurements = len(rep.measurements)
+	}
+	if err := dec.Err(); err != nil {
+		// A read error isn't associated with any entry.
+		rep.Errors = append(rep.Errors, &errorRecord{
+			File:    file,
+			Message: err.Error(),
+		})
+	}
+}
+
+// addError records an error for the given entry,
+// which is the current entry in dec.
+func (v *verifier) addError(file string, entry int, dec *lineprotocol.Decoder, err error) {
+	v.report.Summary.Invalid++
+	v.report.Errors = append(v.report.Errors, newErrorRecord(file, entry, dec.EntryLine(), lineText(dec.RawLine()), err))
+}
+
+// lineText returns the text of the first line of an entry
+// for inclusion in an error record.
+func lineText(line []byte) string {
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	if len(line) > maxLineText {
+		line = line[:maxLineText]
+	}
+	return string(line)
+}
+
+// full reports whether the maximum number of errors
+// has been reached.
+func (v *verifier) full() bool {
+	return v.maxErrors > 0 && len(v.report.Errors) >= v.maxErrors
+}
+
+// checkTime returns an error if t is outside the range
+// specified by minTime and maxTime.
+func checkTime(t, minTime, maxTime time.Time) error {
+	if !minTime.IsZero() && t.Before(minTime) {
+		return fmt.Errorf("timestamp %s is before minimum time %s", t.UTC().Format(time.RFC3339Nano), minTime.UTC().Format(time.RFC3339Nano))
 	}
-	return ok
+	if !maxTime.IsZero() && t.After(maxTime) {
+		return fmt.Errorf("timestamp %s is after maximum time %s", t.UTC().Format(time.RFC3339Nano), maxTime.UTC().Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
+// parseTime parses a time flag value, which may be either an RFC3339
+// timestamp or a duration relative to now. The empty string
+// parses as the zero time.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse %q as RFC3339 time or duration", s)
+	}
+	return t, nil
+}
+
+func fatalf(f string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, "lpverify: %s\n", fmt.Sprintf(f, a...))
+	os.Exit(2)
 }
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+// report holds the results of verifying some line-protocol input.
+type report struct {
+	Errors  []*errorRecord `json:"errors"`
+	Summary summary        `json:"summary"`
+
+	// measurements holds the set of measurements seen
+	// in valid entries.
+	measurements map[string]bool
+}
+
+func newReport() *report {
+	return &report{
+		Errors:       []*errorRecord{},
+		measurements: make(map[string]bool),
+	}
+}
+
+// summary holds summary information about the verified input.
+type summary struct {
+	// Files holds the number of files read.
+	Files int `json:"files"`
+	// Valid holds the number of valid entries.
+	Valid int `json:"valid"`
+	// Invalid holds the number of invalid entries.
+	Invalid int `json:"invalid"`
+	// Measurements holds the number of distinct measurements
+	// in valid entries.
+	Measurements int `json:"measurements"`
+	// Truncated reports whether checking stopped early
+	// because the -max-errors limit was reached.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// errorRecord holds information about a single error.
+type errorRecord struct {
+	// File holds the name of the file containing the error.
+	File string `json:"file"`
+	// Entry holds the one-based index of the erroneous entry
+	// within the file, or zero if the error isn't associated
+	// with an entry (for example, a read error).
+	Entry int `json:"entry,omitempty"`
+	// Line and Column hold the position of the error, when known.
+	Line   int64 `json:"line,omitempty"`
+	Column int   `json:"column,omitempty"`
+	// Message holds the error message, without position information.
+	Message string `json:"message"`
+	// LineText holds the text of the line containing the error, when known.
+	// It may be truncated for long lines.
+	LineText string `json:"lineText,omitempty"`
+}
+
+// newErrorRecord returns the record for an error in the given
+// entry, which starts on the given line and holds the given text.
+// When err is a *lineprotocol.DecodeError, its more precise
+// position and line text are used instead.
+func newErrorRecord(file string, entry int, line int64, text string, err error) *errorRecord {
+	r := &errorRecord{
+		File:     file,
+		Entry:    entry,
+		Line:     line,
+		Message:  err.Error(),
+		LineText: text,
+	}
+	var derr *lineprotocol.DecodeError
+	if errors.As(err, &derr) {
+		r.Line = derr.Line
+		r.Column = derr.Column
+		r.Message = derr.Err.Error()
+		r.LineText = derr.LineText
+	}
+	return r
+}
+
+// String returns the error in the conventional file:line:column: message form.
+func (r *errorRecord) String() string {
+	switch {
+	case r.Line > 0 && r.Column > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", r.File, r.Line, r.Column, r.Message)
+	case r.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", r.File, r.Line, r.Message)
+	case r.Entry > 0:
+		return fmt.Sprintf("%s: entry %d: %s", r.File, r.Entry, r.Message)
+	}
+	return fmt.Sprintf("%s: %s", r.File, r.Message)
+}
+
+// formats holds the report writers for all the supported
+// output formats, indexed by -format flag value.
+// Each is passed the standard output and standard error writers.
+var formats = map[string]func(stdout, stderr io.Writer, rep *report) error{
+	"text":  writeText,
+	"json":  writeJSON,
+	"sarif": writeSARIF,
+	"junit": writeJUnit,
+}
+
+func writeText(stdout, stderr io.Writer, rep *report) error {
+	for _, r := range rep.Errors {
+		fmt.Fprintln(stderr, r)
+	}
+	s := rep.Summary
+	truncated := ""
+	if s.Truncated {
+		truncated = " (stopped after too many errors)"
+	}
+	_, err := fmt.Fprintf(stderr, "%d valid entries, %d invalid entries, %d distinct measurements%s\n", s.Valid, s.Invalid, s.Measurements, truncated)
+	return err
+}
+
+func writeJSON(stdout, stderr io.Writer, rep *report) error {
+	data, err := json.MarshalIndent(rep, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = stdout.Write(append(data, '\n'))
+	return err
+}
+
+// sarifRuleID holds the SARIF rule identifier used for all errors.
+const sarifRuleID = "LP001"
+
+// The following types define the subset of the SARIF 2.1.0
+// format used by writeSARIF.
+type (
+	sarifLog struct {
+		Version string     `json:"version"`
+		Schema  string     `json:"$schema"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool       sarifTool              `json:"tool"`
+		Results    []sarifResult          `json:"results"`
+		Properties map[string]interface{} `json:"properties,omitempty"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri,omitempty"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		Name             string       `json:"name"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           *sarifRegion          `json:"region,omitempty"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int64         `json:"startLine"`
+		StartColumn int           `json:"startColumn,omitempty"`
+		Snippet     *sarifMessage `json:"snippet,omitempty"`
+	}
+)
+
+func writeSARIF(stdout, stderr io.Writer, rep *report) error {
+	results := make([]sarifResult, 0, len(rep.Errors))
+	for _, r := range rep.Errors {
+		loc := sarifLocation{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{
+					URI: r.File,
+				},
+			},
+		}
+		msg := r.Message
+		if r.Line > 0 {
+			region := &sarifRegion{
+				StartLine:   r.Line,
+				StartColumn: r.Column,
+			}
+			if r.LineText != "" {
+				region.Snippet = &sarifMessage{Text: r.LineText}
+			}
+			loc.PhysicalLocation.Region = region
+		} else if r.Entry > 0 {
+			msg = fmt.Sprintf("entry %d: %s", r.Entry, msg)
+		}
+		results = append(results, sarifResult{
+			RuleID:    sarifRuleID,
+			Level:     "error",
+			Message:   sarifMessage{Text: msg},
+			Locations: []sarifLocation{loc},
+		})
+	}
+	log := sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{
+				Driver: sarifDriver{
+					Name:           "lpverify",
+					InformationURI: "https://github.com/influxdata/line-protocol",
+					Rules: []sarifRule{{
+						ID:   sarifRuleID,
+						Name: "InvalidLineProtocol",
+						ShortDescription: sarifMessage{
+							Text: "invalid line-protocol entry",
+						},
+					}},
+				},
+			},
+			Results: results,
+			Properties: map[string]interface{}{
+				"summary": rep.Summary,
+			},
+		}},
+	}
+	data, err := json.MarshalIndent(log, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = stdout.Write(append(data, '\n'))
+	return err
+}
+
+// The following types define the JUnit XML format
+// as written by writeJUnit.
+type (
+	junitTestSuites struct {
+		XMLName  xml.Name         `xml:"testsuites"`
+		Tests    int              `xml:"tests,attr"`
+		Failures int              `xml:"failures,attr"`
+		Suites   []junitTestSuite `xml:"testsuite"`
+	}
+	junitTestSuite struct {
+		Name      string          `xml:"name,attr"`
+		Tests     int             `xml:"tests,attr"`
+		Failures  int             `xml:"failures,attr"`
+		TestCases []junitTestCase `xml:"testcase"`
+	}
+	junitTestCase struct {
+		Name      string        `xml:"name,attr"`
+		ClassName string        `xml:"classname,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+	}
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// writeJUnit writes a JUnit report containing a test suite
+// for each file that has errors, with a failed test case for
+// each error. All valid entries are represented by a single
+// passing test case.
+func writeJUnit(stdout, stderr io.Writer, rep *report) error {
+	suites := make(map[string]*junitTestSuite)
+	var names []string
+	for _, r := range rep.Errors {
+		suite := suites[r.File]
+		if suite == nil {
+			suite = &junitTestSuite{
+				Name: r.File,
+			}
+			suites[r.File] = suite
+			names = append(names, r.File)
+		}
+		name := r.File
+		if r.Line > 0 {
+			name = fmt.Sprintf("%s:%d", r.File, r.Line)
+		} else if r.Entry > 0 {
+			name = fmt.Sprintf("%s#%d", r.File, r.Entry)
+		}
+		suite.TestCases = append(suite.TestCases, junitTestCase{
+			Name:      name,
+			ClassName: "lpverify",
+			Failure: &junitFailure{
+				Message: r.Message,
+				Type:    "error",
+				Text:    r.String() + "\n" + r.LineText,
+			},
+		})
+		suite.Tests++
+		suite.Failures++
+	}
+	sort.Strings(names)
+	all := junitTestSuites{
+		Tests:    rep.Summary.Valid + len(rep.Errors),
+		Failures: len(rep.Errors),
+	}
+	for _, name := range names {
+		all.Suites = append(all.Suites, *suites[name])
+	}
+	all.Suites = append(all.Suites, junitTestSuite{
+		Name:  "valid",
+		Tests: rep.Summary.Valid,
+		TestCases: []junitTestCase{{
+			Name:      fmt.Sprintf("%d valid entries, %d distinct measurements", rep.Summary.Valid, rep.Summary.Measurements),
+			ClassName: "lpverify",
+		}},
+	})
+	data, err := xml.MarshalIndent(all, "", "\t")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(stdout, xml.Header); err != nil {
+		return err
+	}
+	_, err = stdout.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+// testReport returns a small report holding one of each kind of error.
+func testReport() *report {
+	rep := newReport()
+	rep.Errors = append(rep.Errors, &errorRecord{
+		File:     "a.lp",
+		Entry:    2,
+		Line:     3,
+		Column:   5,
+		Message:  `missing field value for field "f"`,
+		LineText: "m f= 1",
+	}, &errorRecord{
+		File:     "a.lp",
+		Entry:    4,
+		Line:     6,
+		Message:  "timestamp 2021-01-01T00:00:00Z is after maximum time 2020-01-01T00:00:00Z",
+		LineText: "m f=1 1609459200000000000",
+	}, &errorRecord{
+		File:    "b.lp",
+		Message: "unexpected EOF",
+	})
+	rep.Summary = summary{
+		Files:        2,
+		Valid:        5,
+		Invalid:      2,
+		Measurements: 3,
+		Truncated:    true,
+	}
+	return rep
+}
+
+func TestVerify(t *testing.T) {
+	c := qt.New(t)
+	v := &verifier{
+		prec:      lineprotocol.Second,
+		maxTime:   time.Unix(100, 0),
+		maxErrors: 2,
+		report:    newReport(),
+	}
+	// Checking stops at the entry after the second error.
+	v.verify("a.lp", strings.NewReader("a f=1 1\nb f=1 2\n\nc f= 3\nd f=1 200\na f=2\ne f=x\n"))
+	c.Assert(v.report.Summary, qt.Equals, summary{
+		Files:        1,
+		Valid:        2,
+		Invalid:      2,
+		Measurements: 2,
+		Truncated:    true,
+	})
+	c.Assert(v.report.Errors, qt.DeepEquals, []*errorRecord{{
+		File:     "a.lp",
+		Entry:    3,
+		Line:     4,
+		Column:   5,
+		Message:  `missing field value for field "f"`,
+		LineText: "c f= 3",
+	}, {
+		File:     "a.lp",
+		Entry:    4,
+		Line:     5,
+		Message:  "timestamp 1970-01-01T00:03:20Z is after maximum time 1970-01-01T00:01:40Z",
+		LineText: "d f=1 200",
+	}})
+}
+
+func TestWriteText(t *testing.T) {
+	c := qt.New(t)
+	var stdout, stderr bytes.Buffer
+	err := writeText(&stdout, &stderr, testReport())
+	c.Assert(err, qt.IsNil)
+	c.Assert(stdout.String(), qt.Equals, "")
+	c.Assert(stderr.String(), qt.Equals, `a.lp:3:5: missing field value for field "f"
+a.lp:6: timestamp 2021-01-01T00:00:00Z is after maximum time 2020-01-01T00:00:00Z
+b.lp: unexpected EOF
+5 valid entries, 2 invalid entries, 3 distinct measurements (stopped after too many errors)
+`)
+}
+
+func TestWriteJSON(t *testing.T) {
+	c := qt.New(t)
+	var stdout, stderr bytes.Buffer
+	err := writeJSON(&stdout, &stderr, testReport())
+	c.Assert(err, qt.IsNil)
+	c.Assert(stderr.String(), qt.Equals, "")
+	var got map[string]interface{}
+	err = json.Unmarshal(stdout.Bytes(), &got)
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.DeepEquals, map[string]interface{}{
+		"errors": []interface{}{
+			map[string]interface{}{
+				"file":     "a.lp",
+				"entry":    2.0,
+				"line":     3.0,
+				"column":   5.0,
+				"message":  `missing field value for field "f"`,
+				"lineText": "m f= 1",
+			},
+			map[string]interface{}{
+				"file":     "a.lp",
+				"entry":    4.0,
+				"line":     6.0,
+				"message":  "timestamp 2021-01-01T00:00:00Z is after maximum time 2020-01-01T00:00:00Z",
+				"lineText": "m f=1 1609459200000000000",
+			},
+			map[string]interface{}{
+				"file":    "b.lp",
+				"message": "unexpected EOF",
+			},
+		},
+		"summary": map[string]interface{}{
+			"files":        2.0,
+			"valid":        5.0,
+			"invalid":      2.0,
+			"measurements": 3.0,
+			"truncated":    true,
+		},
+	})
+}
+
+func TestWriteJSONNotTruncated(t *testing.T) {
+	c := qt.New(t)
+	rep := newReport()
+	rep.Summary.Valid = 1
+	var stdout, stderr bytes.Buffer
+	err := writeJSON(&stdout, &stderr, rep)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stdout.String(), qt.Equals, `{
+	"errors": [],
+	"summary": {
+		"files": 0,
+		"valid": 1,
+		"invalid": 0,
+		"measurements": 0
+	}
+}
+`)
+}
+
+func TestWriteSARIF(t *testing.T) {
+	c := qt.New(t)
+	var stdout, stderr bytes.Buffer
+	err := writeSARIF(&stdout, &stderr, testReport())
+	c.Assert(err, qt.IsNil)
+	c.Assert(stderr.String(), qt.Equals, "")
+	var got sarifLog
+	err = json.Unmarshal(stdout.Bytes(), &got)
+	c.Assert(err, qt.IsNil)
+	c.Assert(got.Version, qt.Equals, "2.1.0")
+	c.Assert(got.Schema, qt.Equals, "https://json.schemastore.org/sarif-2.1.0.json")
+	c.Assert(got.Runs, qt.HasLen, 1)
+	run := got.Runs[0]
+	c.Assert(run.Tool.Driver.Name, qt.Equals, "lpverify")
+	c.Assert(run.Tool.Driver.Rules, qt.HasLen, 1)
+	c.Assert(run.Tool.Driver.Rules[0].ID, qt.Equals, sarifRuleID)
+	c.Assert(run.Results, qt.DeepEquals, []sarifResult{{
+		RuleID:  sarifRuleID,
+		Level:   "error",
+		Message: sarifMessage{Text: `missing field value for field "f"`},
+		Locations: []sarifLocation{{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: "a.lp"},
+				Region: &sarifRegion{
+					StartLine:   3,
+					StartColumn: 5,
+					Snippet:     &sarifMessage{Text: "m f= 1"},
+				},
+			},
+		}},
+	}, {
+		RuleID:  sarifRuleID,
+		Level:   "error",
+		Message: sarifMessage{Text: "timestamp 2021-01-01T00:00:00Z is after maximum time 2020-01-01T00:00:00Z"},
+		Locations: []sarifLocation{{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: "a.lp"},
+				Region: &sarifRegion{
+					StartLine: 6,
+					Snippet:   &sarifMessage{Text: "m f=1 1609459200000000000"},
+				},
+			},
+		}},
+	}, {
+		RuleID:  sarifRuleID,
+		Level:   "error",
+		Message: sarifMessage{Text: "unexpected EOF"},
+		Locations: []sarifLocation{{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: "b.lp"},
+			},
+		}},
+	}})
+	c.Assert(run.Properties, qt.DeepEquals, map[string]interface{}{
+		"summary": map[string]interface{}{
+			"files":        2.0,
+			"valid":        5.0,
+			"invalid":      2.0,
+			"measurements": 3.0,
+			"truncated":    true,
+		},
+	})
+}
+
+func TestWriteSARIFEntryWithoutLine(t *testing.T) {
+	c := qt.New(t)
+	rep := newReport()
+	rep.Errors = append(rep.Errors, &errorRecord{
+		File:    "a.lp",
+		Entry:   7,
+		Message: "some error",
+	})
+	var stdout, stderr bytes.Buffer
+	err := writeSARIF(&stdout, &stderr, rep)
+	c.Assert(err, qt.IsNil)
+	var got sarifLog
+	err = json.Unmarshal(stdout.Bytes(), &got)
+	c.Assert(err, qt.IsNil)
+	result := got.Runs[0].Results[0]
+	c.Assert(result.Message.Text, qt.Equals, "entry 7: some error")
+	c.Assert(result.Locations[0].PhysicalLocation.Region, qt.IsNil)
+}
+
+func TestWriteJUnit(t *testing.T) {
+	c := qt.New(t)
+	var stdout, stderr bytes.Buffer
+	err := writeJUnit(&stdout, &stderr, testReport())
+	c.Assert(err, qt.IsNil)
+	c.Assert(stderr.String(), qt.Equals, "")
+	c.Assert(strings.HasPrefix(stdout.String(), xml.Header), qt.IsTrue)
+	var got junitTestSuites
+	err = xml.Unmarshal(stdout.Bytes(), &got)
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.DeepEquals, junitTestSuites{
+		XMLName:  xml.Name{Local: "testsuites"},
+		Tests:    8,
+		Failures: 3,
+		Suites: []junitTestSuite{{
+			Name:     "a.lp",
+			Tests:    2,
+			Failures: 2,
+			TestCases: []junitTestCase{{
+				Name:      "a.lp:3",
+				ClassName: "lpverify",
+				Failure: &junitFailure{
+					Message: `missing field value for field "f"`,
+					Type:    "error",
+					Text:    "a.lp:3:5: missing field value for field \"f\"\nm f= 1",
+				},
+			}, {
+				Name:      "a.lp:6",
+				ClassName: "lpverify",
+				Failure: &junitFailure{
+					Message: "timestamp 2021-01-01T00:00:00Z is after maximum time 2020-01-01T00:00:00Z",
+					Type:    "error",
+					Text:    "a.lp:6: timestamp 2021-01-01T00:00:00Z is after maximum time 2020-01-01T00:00:00Z\nm f=1 1609459200000000000",
+				},
+			}},
+		}, {
+			Name:     "b.lp",
+			Tests:    1,
+			Failures: 1,
+			TestCases: []junitTestCase{{
+				Name:      "b.lp",
+				ClassName: "lpverify",
+				Failure: &junitFailure{
+					Message: "unexpected EOF",
+					Type:    "error",
+					Text:    "b.lp: unexpected EOF\n",
+				},
+			}},
+		}, {
+			Name:  "valid",
+			Tests: 5,
+			TestCases: []junitTestCase{{
+				Name:      "5 valid entries, 3 distinct measurements",
+				ClassName: "lpverify",
+			}},
+		}},
+	})
+}
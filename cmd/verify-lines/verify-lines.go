@@ -4,6 +4,7 @@ import "C"
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/influxdata/line-protocol/v2/lineprotocol"
 )
@@ -21,40 +22,11 @@ func main() {}
 func verifyLines(lines *C.char) C.int {
 	dec := lineprotocol.NewDecoderWithBytes([]byte(C.GoString(lines)))
 	var failure bool
-	logErr := func(err error) {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		failure = true
-	}
-nextLine:
+	var p lineprotocol.Point
 	for dec.Next() {
-		_, err := dec.Measurement()
-		if err != nil {
-			logErr(err)
-			continue nextLine
-		}
-		for {
-			key, _, err := dec.NextTag()
-			if err != nil {
-				logErr(err)
-				continue nextLine
-			}
-			if key == nil {
-				break
-			}
-		}
-		for {
-			key, _, err := dec.NextField()
-			if err != nil {
-				logErr(err)
-				continue nextLine
-			}
-			if key == nil {
-				break
-			}
-		}
-		if _, err := dec.TimeBytes(); err != nil {
-			logErr(err)
-			continue nextLine
+		if err := dec.DecodePoint(&p, lineprotocol.Nanosecond, time.Time{}); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			failure = true
 		}
 	}
 	if failure {
@@ -0,0 +1,653 @@
+// Package client implements a batching client for the InfluxDB v2
+// write endpoint (or any compatible endpoint, such as the
+// one implemented by the httpwrite package).
+//
+// Points are encoded with a lineprotocol.Encoder into batches,
+// which are compressed with gzip and sent in the background,
+// with retries when the server is overloaded or unavailable.
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+const (
+	// DefaultBatchPoints holds the default value for Options.BatchPoints.
+	DefaultBatchPoints = 5000
+
+	// DefaultBatchBytes holds the default value for Options.BatchBytes.
+	DefaultBatchBytes = 1024 * 1024
+
+	// DefaultFlushInterval holds the default value for Options.FlushInterval.
+	DefaultFlushInterval = time.Second
+
+	// DefaultMaxRetries holds the default value for Options.MaxRetries.
+	DefaultMaxRetries = 5
+
+	// DefaultRetryInterval holds the default value for Options.RetryInterval.
+	DefaultRetryInterval = time.Second
+
+	// DefaultMaxRetryInterval holds the default value for Options.MaxRetryInterval.
+	DefaultMaxRetryInterval = 30 * time.Second
+
+	// DefaultMaxRetryAfter holds the default value for Options.MaxRetryAfter.
+	DefaultMaxRetryAfter = 5 * time.Minute
+)
+
+// maxPendingBatches holds the number of complete batches that
+// can be waiting to be sent before writes block.
+const maxPendingBatches = 2
+
+// maxErrorBody holds the maximum number of bytes of an error
+// response body that will be read.
+const maxErrorBody = 64 * 1024
+
+// ErrClosed is returned when a Writer is used after it has been closed.
+var ErrClosed = errors.New("writer closed")
+
+// Options holds options for NewWriter.
+type Options struct {
+	// HTTPClient holds the client used to make requests.
+	// If this is nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// Header holds headers to add to each request,
+	// for example an Authorization header.
+	Header http.Header
+
+	// Precision holds the precision used to encode timestamps.
+	// The default is lineprotocol.Nanosecond.
+	Precision lineprotocol.Precision
+
+	// BatchPoints holds the number of points at which a batch
+	// is sent. If this is zero, DefaultBatchPoints is used.
+	BatchPoints int
+
+	// BatchBytes holds the size of the uncompressed batch
+	// at which a batch is sent. If this is zero, DefaultBatchBytes is used.
+	BatchBytes int
+
+	// FlushInterval holds the maximum time that a point will
+	// wait in a batch before it's sent. If this is zero,
+	// DefaultFlushInterval is used.
+	FlushInterval time.Duration
+
+	// DisableCompression disables gzip compression of
+	// request bodies.
+	DisableCompression bool
+
+	// MaxRetries holds the maximum number of times a request for
+	// a batch will be retried. If this is zero, DefaultMaxRetries
+	// is used. If it's negative, requests are not retried.
+	MaxRetries int
+
+	// RetryInterval holds the time to wait before the first retry.
+	// The interval doubles for each subsequent retry, up to
+	// MaxRetryInterval, with random jitter. If this is zero,
+	// DefaultRetryInterval is used.
+	RetryInterval time.Duration
+
+	// MaxRetryInterval holds the maximum time to wait between
+	// retries, unless the server specifies a longer time in a
+	// Retry-After header. If this is zero, DefaultMaxRetryInterval is used.
+	MaxRetryInterval time.Duration
+
+	// MaxRetryAfter holds the maximum time to wait before a retry
+	// when the server specifies the time in a Retry-After header.
+	// Longer times are reduced to this. If this is zero,
+	// DefaultMaxRetryAfter is used.
+	MaxRetryAfter time.Duration
+
+	// OnResult, if non-nil, is called with the result of
+	// each batch, whether it succeeded or not. It is called
+	// from a separate goroutine, in the order that the batches
+	// were sent, and doesn't hold up the sending of later batches.
+	//
+	// OnResult may call Writer methods, for example to write
+	// the points from a failed batch again, except for Close and
+	// Shutdown, which wait for all calls to OnResult to return.
+	OnResult func(r *BatchResult)
+}
+
+// BatchResult holds the result of sending a batch.
+type BatchResult struct {
+	// Points holds the number of entries in the batch.
+	Points int
+	// Size holds the uncompressed size of the batch in bytes.
+	Size int
+	// Attempts holds the number of requests made for the batch.
+	Attempts int
+	// Err holds the error that caused the batch to fail, or nil
+	// if it was written successfully. If the error was returned
+	// by the server, it is of type *Error.
+	Err error
+}
+
+// Error holds an error response from the server.
+type Error struct {
+	// StatusCode holds the HTTP status code of the response.
+	StatusCode int
+	// Code holds the InfluxDB error code, if any.
+	Code string
+	// Message holds the error message from the response,
+	// or the response body if it couldn't be parsed.
+	Message string
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("write failed with status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("write failed with status %d: %s", e.StatusCode, e.Message)
+}
+
+// Writer writes points to an InfluxDB-compatible write endpoint
+// in batches. Its methods are safe to call concurrently.
+type Writer struct {
+	url              string
+	client           *http.Client
+	header           http.Header
+	batchPoints      int
+	batchBytes       int
+	flushInterval    time.Duration
+	compress         bool
+	maxRetries       int
+	retryInterval    time.Duration
+	maxRetryInterval time.Duration
+	maxRetryAfter    time.Duration
+	onResult         func(r *BatchResult)
+
+	// ctx is used for requests and is cancelled
+	// to abandon retries when Shutdown times out.
+	ctx    context.Context
+	cancel func()
+
+	// batches holds batches waiting to be sent.
+	batches chan []byte
+	// done is closed when the sending goroutine has finished
+	// and all results have been passed to onResult.
+	done chan struct{}
+
+	// resultMu guards the fields below it.
+	resultMu sync.Mutex
+	// results holds results waiting to be passed to onResult.
+	results []*BatchResult
+	// sent holds whether all batches have been sent.
+	sent bool
+	// resultReady is sent a value when results or sent changes.
+	resultReady chan struct{}
+
+	// mu guards the fields below it.
+	mu sync.Mutex
+	// enc holds the encoder for the current batch.
+	enc lineprotocol.Encoder
+	// points holds the number of points in the current batch.
+	points int
+	// generation is incremented each time a batch is sent,
+	// so the flush timer can tell whether its batch has already gone.
+	generation int
+	// timer holds the flush timer for the current batch, if any.
+	timer *time.Timer
+	// closed holds whether Close has been called.
+	closed bool
+
+	// The following fields are only used by the sending goroutine.
+	zw   *gzip.Writer
+	body bytes.Buffer
+}
+
+// NewWriter returns a Writer that sends points to the given URL,
+// which should be the URL of an InfluxDB v2 write endpoint including
+// the org and bucket parameters, for example:
+//
+//	http://localhost:8086/api/v2/write?org=myorg&bucket=mybucket
+//
+// The precision parameter is set from opts.Precision.
+// If opts is nil, the default options are used.
+//
+// The Writer must be closed after use.
+func NewWriter(writeURL string, opts *Options) (*Writer, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	u, err := url.Parse(writeURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid write URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid write URL %q: scheme must be http or https", writeURL)
+	}
+	query := u.Query()
+	query.Set("precision", precisionParams[opts.Precision])
+	u.RawQuery = query.Encode()
+
+	w := &Writer{
+		url:              u.String(),
+		client:           opts.HTTPClient,
+		header:           opts.Header,
+		batchPoints:      opts.BatchPoints,
+		batchBytes:       opts.BatchBytes,
+		flushInterval:    opts.FlushInterval,
+		compress:         !opts.DisableCompression,
+		maxRetries:       opts.MaxRetries,
+		retryInterval:    opts.RetryInterval,
+		maxRetryInterval: opts.MaxRetryInterval,
+		maxRetryAfter:    opts.MaxRetryAfter,
+		onResult:         opts.OnResult,
+		batches:          make(chan []byte, maxPendingBatches),
+		done:             make(chan struct{}),
+		resultReady:      make(chan struct{}, 1),
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	if w.client == nil {
+		w.client = http.DefaultClient
+	}
+	if w.batchPoints <= 0 {
+		w.batchPoints = DefaultBatchPoints
+	}
+	if w.batchBytes <= 0 {
+		w.batchBytes = DefaultBatchBytes
+	}
+	if w.flushInterval <= 0 {
+		w.flushInterval = DefaultFlushInterval
+	}
+	if w.maxRetries == 0 {
+		w.maxRetries = DefaultMaxRetries
+	} else if w.maxRetries < 0 {
+		w.maxRetries = 0
+	}
+	if w.retryInterval <= 0 {
+		w.retryInterval = DefaultRetryInterval
+	}
+	if w.maxRetryInterval <= 0 {
+		w.maxRetryInterval = DefaultMaxRetryInterval
+	}
+	if w.maxRetryAfter <= 0 {
+		w.maxRetryAfter = DefaultMaxRetryAfter
+	}
+	if w.compress {
+		w.zw = gzip.NewWriter(nil)
+	}
+	w.enc.SetPrecision(opts.Precision)
+	go w.sendLoop()
+	if w.onResult != nil {
+		go w.resultLoop()
+	}
+	return w, nil
+}
+
+var precisionParams = map[lineprotocol.Precision]string{
+	lineprotocol.Nanosecond:  "ns",
+	lineprotocol.Microsecond: "us",
+	lineprotocol.Millisecond: "ms",
+	lineprotocol.Second:      "s",
+}
+
+// WritePoint adds p to the current batch. It returns an error
+// if p cannot be encoded, in which case it is not added.
+func (w *Writer) WritePoint(p *lineprotocol.Point) error {
+	return w.Encode(func(enc *lineprotocol.Encoder) {
+		enc.EncodePoint(p)
+	})
+}
+
+// Encode calls encode to add entries to the current batch.
+// An entry that isn't explicitly ended with EndLine is ended
+// without a timestamp after encode returns.
+//
+// Encode returns the first error encountered by the Encoder, if any.
+// As usual, erroneous entries are omitted from the batch.
+//
+// The encode function must not call any Writer methods
+// and must not retain the Encoder.
+func (w *Writer) Encode(encode func(enc *lineprotocol.Encoder)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	start := len(w.enc.Bytes())
+	encode(&w.enc)
+	if buf := w.enc.Bytes(); len(buf) > start && buf[len(buf)-1] != '\n' {
+		w.enc.EndLine(time.Time{})
+	}
+	err := w.enc.Err()
+	// The encoder removes any partially encoded entry when there's
+	// an error, but that can leave the last complete entry without
+	// its newline, so add it back. SetBuffer also resets the
+	// encoder's state for the next call.
+	buf := w.enc.Bytes()
+	if len(buf) > start && buf[len(buf)-1] != '\n' {
+		buf = append(buf, '\n')
+	}
+	w.enc.SetBuffer(buf)
+	w.points += bytes.Count(buf[start:], newline)
+	switch {
+	case w.points >= w.batchPoints || len(buf) >= w.batchBytes:
+		w.flush()
+	case w.points > 0 && w.timer == nil:
+		generation := w.generation
+		w.timer = time.AfterFunc(w.flushInterval, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if w.generation == generation && !w.closed {
+				w.flush()
+			}
+		})
+	}
+	return err
+}
+
+var newline = []byte{'\n'}
+
+// Flush sends the current batch without waiting
+// for the batch to fill up or the flush interval to pass.
+// It does not wait for the batch to be written.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.flush()
+	return nil
+}
+
+// Close sends any remaining points and waits for all
+// batches to be written or to fail.
+//
+// Close can take a long time if the server is unavailable,
+// because failed batches are retried. Use Shutdown
+// to limit the time spent.
+func (w *Writer) Close() error {
+	return w.Shutdown(context.Background())
+}
+
+// Shutdown is like Close except that if ctx is done before
+// all batches have been written, any request in progress is
+// cancelled and no more retries are made, so all remaining batches
+// fail. It then waits for their results to be reported and
+// returns ctx.Err().
+func (w *Writer) Shutdown(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	w.flush()
+	w.closed = true
+	close(w.batches)
+	w.mu.Unlock()
+	defer w.cancel()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+	}
+	w.cancel()
+	<-w.done
+	return ctx.Err()
+}
+
+// flush queues the current batch to be sent, if it's not empty.
+// It's called with w.mu held.
+func (w *Writer) flush() {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.generation++
+	buf := w.enc.Bytes()
+	if len(buf) == 0 {
+		return
+	}
+	// Note: this blocks while there are too many
+	// batches pending, which limits the amount
+	// of memory used.
+	w.batches <- buf
+	w.enc.SetBuffer(make([]byte, 0, len(buf)))
+	w.points = 0
+}
+
+// sendLoop sends batches until w.batches is closed.
+func (w *Writer) sendLoop() {
+	for data := range w.batches {
+		w.send(data)
+	}
+	if w.onResult == nil {
+		close(w.done)
+		return
+	}
+	w.resultMu.Lock()
+	w.sent = true
+	w.resultMu.Unlock()
+	w.notifyResult()
+}
+
+// resultLoop calls onResult for each result added by send
+// until all batches have been sent. It runs in its own goroutine
+// so that the callback never holds up sending, which would
+// deadlock if the callback were to write more points.
+func (w *Writer) resultLoop() {
+	defer close(w.done)
+	for {
+		w.resultMu.Lock()
+		results, sent := w.results, w.sent
+		w.results = nil
+		w.resultMu.Unlock()
+		if len(results) == 0 {
+			if sent {
+				return
+			}
+			<-w.resultReady
+			continue
+		}
+		for _, r := range results {
+			w.onResult(r)
+		}
+	}
+}
+
+// addResult queues r to be passed to onResult.
+func (w *Writer) addResult(r *BatchResult) {
+	if w.onResult == nil {
+		return
+	}
+	w.resultMu.Lock()
+	w.results = append(w.results, r)
+	w.resultMu.Unlock()
+	w.notifyResult()
+}
+
+// notifyResult wakes up resultLoop if it's waiting.
+func (w *Writer) notifyResult() {
+	select {
+	case w.resultReady <- struct{}{}:
+	default:
+	}
+}
+
+// send sends a batch, retrying as needed, and reports the result.
+// If the server rejects the batch as too large, it's split into two.
+func (w *Writer) send(data []byte) {
+	r := &BatchResult{
+		Points: bytes.Count(data, newline),
+		Size:   len(data),
+	}
+	for {
+		r.Attempts++
+		retryAfter, err := w.post(data)
+		if err == nil {
+			break
+		}
+		var werr *Error
+		isServerError := errors.As(err, &werr)
+		if isServerError && werr.StatusCode == http.StatusRequestEntityTooLarge {
+			if data0, data1, ok := splitBatch(data); ok {
+				w.send(data0)
+				w.send(data1)
+				return
+			}
+		}
+		if r.Attempts > w.maxRetries || (isServerError && !retryable(werr.StatusCode)) {
+			r.Err = err
+			break
+		}
+		if retryAfter < 0 {
+			retryAfter = w.backoff(r.Attempts)
+		} else if retryAfter > w.maxRetryAfter {
+			retryAfter = w.maxRetryAfter
+		}
+		if !w.wait(retryAfter) {
+			r.Err = err
+			break
+		}
+	}
+	w.addResult(r)
+}
+
+// wait waits for the given duration. It returns false
+// without waiting that long if retries have been abandoned.
+func (w *Writer) wait(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// retryable reports whether a request that failed
+// with the given status code should be retried.
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// backoff returns the time to wait before retrying
+// after the given number of attempts.
+func (w *Writer) backoff(attempts int) time.Duration {
+	d := w.maxRetryInterval
+	if shift := uint(attempts - 1); shift < 32 && w.retryInterval<<shift < d {
+		d = w.retryInterval << shift
+	}
+	// Choose a random interval between d/2 and d so that
+	// clients that failed at the same time don't all
+	// retry at the same time.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// splitBatch splits data into two parts, each holding
+// complete entries. It reports false if there's only
+// a single entry.
+func splitBatch(data []byte) ([]byte, []byte, bool) {
+	mid := len(data) / 2
+	if i := bytes.IndexByte(data[mid:], '\n'); i >= 0 && mid+i+1 < len(data) {
+		return data[:mid+i+1], data[mid+i+1:], true
+	}
+	if i := bytes.LastIndexByte(data[:mid], '\n'); i >= 0 {
+		return data[:i+1], data[i+1:], true
+	}
+	return nil, nil, false
+}
+
+// post makes a single write request holding data.
+// If the server responds with a Retry-After header, it returns
+// the duration specified, otherwise it returns -1.
+func (w *Writer) post(data []byte) (time.Duration, error) {
+	body := data
+	if w.compress {
+		w.body.Reset()
+		w.zw.Reset(&w.body)
+		w.zw.Write(data)
+		if err := w.zw.Close(); err != nil {
+			return -1, err
+		}
+		body = w.body.Bytes()
+	}
+	req, err := http.NewRequestWithContext(w.ctx, "POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	for k, v := range w.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return -1, nil
+	}
+	return parseRetryAfter(resp.Header.Get("Retry-After")), responseError(resp)
+}
+
+// parseRetryAfter parses the value of a Retry-After header,
+// which may hold a number of seconds or an HTTP date.
+// It returns -1 if the value is empty or invalid.
+func parseRetryAfter(s string) time.Duration {
+	if s == "" {
+		return -1
+	}
+	if secs, err := strconv.Atoi(s); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return -1
+}
+
+// responseError returns the error for an unsuccessful response.
+func responseError(resp *http.Response) error {
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var body struct {
+		// Code and Message are used in v2 responses.
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		// Error is used in v1 responses.
+		Error string `json:"error"`
+	}
+	werr := &Error{
+		StatusCode: resp.StatusCode,
+	}
+	if err := json.Unmarshal(data, &body); err == nil && (body.Message != "" || body.Error != "") {
+		werr.Code = body.Code
+		werr.Message = body.Message
+		if werr.Message == "" {
+			werr.Message = body.Error
+		}
+	} else {
+		werr.Message = string(bytes.TrimSpace(data))
+		if werr.Message == "" {
+			werr.Message = http.StatusText(resp.StatusCode)
+		}
+	}
+	return werr
+}
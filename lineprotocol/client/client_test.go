@@ -0,0 +1,399 @@
+package client_test
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+	"github.com/influxdata/line-protocol/v2/lineprotocol/client"
+	"github.com/influxdata/line-protocol/v2/lineprotocol/httpwrite"
+)
+
+// recorder records the points written to an httpwrite.Handler
+// and the results reported by a client.Writer.
+type recorder struct {
+	mu      sync.Mutex
+	points  []string
+	results []client.BatchResult
+}
+
+func (r *recorder) write(req *httpwrite.Request, p *lineprotocol.Point) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.points = append(r.points, string(p.Measurement))
+	return nil
+}
+
+func (r *recorder) onResult(res *client.BatchResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, *res)
+}
+
+func writePoints(c *qt.C, w *client.Writer, n int) {
+	for i := 0; i < n; i++ {
+		err := w.WritePoint(&lineprotocol.Point{
+			Measurement: []byte("m" + string(rune('a'+i))),
+			Fields: []lineprotocol.Field{{
+				Key:   []byte("f"),
+				Value: lineprotocol.IntValue(int64(i)),
+			}},
+			Time: time.Unix(int64(i), 0),
+		})
+		c.Assert(err, qt.IsNil)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	var mu sync.Mutex
+	var headers []http.Header
+	h := httpwrite.NewHandler(rec.write, nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		headers = append(headers, req.Header)
+		mu.Unlock()
+		c.Check(req.URL.Query().Get("precision"), qt.Equals, "s")
+		h.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	w, err := client.NewWriter(srv.URL+"/api/v2/write?org=o&bucket=b", &client.Options{
+		Header:      http.Header{"Authorization": {"Token xxx"}},
+		Precision:   lineprotocol.Second,
+		BatchPoints: 2,
+		OnResult:    rec.onResult,
+	})
+	c.Assert(err, qt.IsNil)
+	writePoints(c, w, 5)
+	err = w.Encode(func(enc *lineprotocol.Encoder) {
+		enc.StartLine("x")
+		enc.AddField("f", lineprotocol.IntValue(1))
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(w.Close(), qt.IsNil)
+	c.Assert(w.Close(), qt.Equals, client.ErrClosed)
+
+	c.Assert(rec.points, qt.DeepEquals, []string{"ma", "mb", "mc", "md", "me", "x"})
+	c.Assert(rec.results, qt.DeepEquals, []client.BatchResult{{
+		Points:   2,
+		Size:     len("ma f=0i 0\nmb f=1i 1\n"),
+		Attempts: 1,
+	}, {
+		Points:   2,
+		Size:     len("mc f=2i 2\nmd f=3i 3\n"),
+		Attempts: 1,
+	}, {
+		Points:   2,
+		Size:     len("me f=4i 4\nx f=1i\n"),
+		Attempts: 1,
+	}})
+	for _, h := range headers {
+		c.Check(h.Get("Authorization"), qt.Equals, "Token xxx")
+		c.Check(h.Get("Content-Encoding"), qt.Equals, "gzip")
+	}
+}
+
+func TestWriterEncodeError(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	srv := httptest.NewServer(httpwrite.NewHandler(rec.write, nil))
+	defer srv.Close()
+	w, err := client.NewWriter(srv.URL+"/api/v2/write?org=o&bucket=b", nil)
+	c.Assert(err, qt.IsNil)
+	err = w.Encode(func(enc *lineprotocol.Encoder) {
+		enc.StartLine("m1")
+		enc.AddField("f", lineprotocol.IntValue(1))
+		enc.StartLine("m2")
+		enc.AddField("\xff", lineprotocol.IntValue(2))
+		enc.StartLine("m3")
+	})
+	c.Assert(err, qt.ErrorMatches, `encoding point 1: invalid field key "\\xff"`)
+	writePoints(c, w, 1)
+	c.Assert(w.Close(), qt.IsNil)
+	c.Assert(rec.points, qt.DeepEquals, []string{"m1", "ma"})
+	c.Assert(w.WritePoint(&lineprotocol.Point{}), qt.Equals, client.ErrClosed)
+}
+
+func TestWriterBatchBytes(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	srv := httptest.NewServer(httpwrite.NewHandler(rec.write, nil))
+	defer srv.Close()
+	w, err := client.NewWriter(srv.URL+"/api/v2/write?org=o&bucket=b", &client.Options{
+		BatchBytes:         40,
+		DisableCompression: true,
+		OnResult:           rec.onResult,
+	})
+	c.Assert(err, qt.IsNil)
+	writePoints(c, w, 5)
+	c.Assert(w.Close(), qt.IsNil)
+	c.Assert(rec.points, qt.HasLen, 5)
+	var points []int
+	for _, r := range rec.results {
+		c.Assert(r.Err, qt.IsNil)
+		points = append(points, r.Points)
+	}
+	c.Assert(points, qt.DeepEquals, []int{3, 2})
+}
+
+func TestWriterFlushInterval(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	results := make(chan *client.BatchResult)
+	srv := httptest.NewServer(httpwrite.NewHandler(rec.write, nil))
+	defer srv.Close()
+	w, err := client.NewWriter(srv.URL+"/api/v2/write?org=o&bucket=b", &client.Options{
+		FlushInterval: 10 * time.Millisecond,
+		OnResult: func(r *client.BatchResult) {
+			results <- r
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	defer w.Close()
+	writePoints(c, w, 2)
+	select {
+	case r := <-results:
+		c.Assert(r.Err, qt.IsNil)
+		c.Assert(r.Points, qt.Equals, 2)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("batch not sent after flush interval")
+	}
+}
+
+func TestWriterRetry(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	h := httpwrite.NewHandler(rec.write, nil)
+	var mu sync.Mutex
+	responses := []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusBadGateway}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(responses) == 0 {
+			h.ServeHTTP(w, req)
+			return
+		}
+		status := responses[0]
+		responses = responses[1:]
+		if status != http.StatusBadGateway {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	w, err := client.NewWriter(srv.URL+"/api/v2/write?org=o&bucket=b", &client.Options{
+		RetryInterval: time.Millisecond,
+		OnResult:      rec.onResult,
+	})
+	c.Assert(err, qt.IsNil)
+	writePoints(c, w, 3)
+	c.Assert(w.Close(), qt.IsNil)
+	c.Assert(rec.points, qt.DeepEquals, []string{"ma", "mb", "mc"})
+	c.Assert(rec.results, qt.HasLen, 1)
+	c.Assert(rec.results[0].Err, qt.IsNil)
+	c.Assert(rec.results[0].Attempts, qt.Equals, 4)
+}
+
+func TestWriterRetryLimit(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"code":"internal error","message":"oops"}`))
+	}))
+	defer srv.Close()
+	w, err := client.NewWriter(srv.URL+"/api/v2/write?org=o&bucket=b", &client.Options{
+		MaxRetries:    2,
+		RetryInterval: time.Millisecond,
+		OnResult:      rec.onResult,
+	})
+	c.Assert(err, qt.IsNil)
+	writePoints(c, w, 1)
+	c.Assert(w.Close(), qt.IsNil)
+	c.Assert(attempts, qt.Equals, 3)
+	c.Assert(rec.results, qt.HasLen, 1)
+	c.Assert(rec.results[0].Attempts, qt.Equals, 3)
+	c.Assert(rec.results[0].Err, qt.ErrorMatches, `write failed with status 500 \(internal error\): oops`)
+	werr, ok := rec.results[0].Err.(*client.Error)
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(werr.StatusCode, qt.Equals, http.StatusInternalServerError)
+}
+
+func TestWriterNoRetryOnBadRequest(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"authorization failed"}`))
+	}))
+	defer srv.Close()
+	w, err := client.NewWriter(srv.URL+"/write?db=x", &client.Options{
+		OnResult: rec.onResult,
+	})
+	c.Assert(err, qt.IsNil)
+	writePoints(c, w, 1)
+	c.Assert(w.Close(), qt.IsNil)
+	c.Assert(rec.results, qt.HasLen, 1)
+	c.Assert(rec.results[0].Attempts, qt.Equals, 1)
+	c.Assert(rec.results[0].Err, qt.ErrorMatches, `write failed with status 401: authorization failed`)
+}
+
+func TestWriterOnResultCanWrite(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	srv := httptest.NewServer(httpwrite.NewHandler(rec.write, nil))
+	defer srv.Close()
+	var (
+		w       *client.Writer
+		mu      sync.Mutex
+		results int
+	)
+	allDone := make(chan struct{})
+	w, err := client.NewWriter(srv.URL+"/api/v2/write?org=o&bucket=b", &client.Options{
+		BatchPoints: 1,
+		OnResult: func(r *client.BatchResult) {
+			c.Check(r.Err, qt.IsNil)
+			mu.Lock()
+			results++
+			n := results
+			mu.Unlock()
+			// Write another point for each of the first batches.
+			// This would deadlock if the results were reported
+			// from the goroutine that sends the batches.
+			if n <= 5 {
+				writePoints(c, w, 1)
+			}
+			if n == 10 {
+				close(allDone)
+			}
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	writePoints(c, w, 5)
+	select {
+	case <-allDone:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("timed out waiting for results")
+	}
+	c.Assert(w.Close(), qt.IsNil)
+	c.Assert(rec.points, qt.HasLen, 10)
+}
+
+func TestWriterMaxRetryAfter(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	h := httpwrite.NewHandler(rec.write, nil)
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+	w, err := client.NewWriter(srv.URL+"/api/v2/write?org=o&bucket=b", &client.Options{
+		MaxRetryAfter: time.Millisecond,
+		OnResult:      rec.onResult,
+	})
+	c.Assert(err, qt.IsNil)
+	writePoints(c, w, 1)
+	c.Assert(w.Close(), qt.IsNil)
+	c.Assert(rec.results, qt.HasLen, 1)
+	c.Assert(rec.results[0].Err, qt.IsNil)
+	c.Assert(rec.results[0].Attempts, qt.Equals, 2)
+}
+
+func TestWriterShutdown(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	w, err := client.NewWriter(srv.URL+"/api/v2/write?org=o&bucket=b", &client.Options{
+		MaxRetryAfter: time.Hour,
+		OnResult:      rec.onResult,
+	})
+	c.Assert(err, qt.IsNil)
+	writePoints(c, w, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = w.Shutdown(ctx)
+	c.Assert(errors.Is(err, context.DeadlineExceeded), qt.IsTrue)
+	// The retry is abandoned and the batch fails.
+	c.Assert(rec.results, qt.HasLen, 1)
+	c.Assert(rec.results[0].Attempts, qt.Equals, 1)
+	c.Assert(rec.results[0].Err, qt.ErrorMatches, `write failed with status 503: .*`)
+	c.Assert(w.Close(), qt.Equals, client.ErrClosed)
+}
+
+func TestWriterSplitsTooLargeBatch(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		zr, err := gzip.NewReader(req.Body)
+		c.Check(err, qt.IsNil)
+		data, err := ioutil.ReadAll(zr)
+		c.Check(err, qt.IsNil)
+		if strings.Count(string(data), "\n") > 2 || strings.Contains(string(data), "md") {
+			// Entry md is always rejected.
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		bodies = append(bodies, string(data))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	w, err := client.NewWriter(srv.URL+"/api/v2/write?org=o&bucket=b", &client.Options{
+		OnResult: rec.onResult,
+	})
+	c.Assert(err, qt.IsNil)
+	writePoints(c, w, 7)
+	c.Assert(w.Close(), qt.IsNil)
+	c.Assert(bodies, qt.DeepEquals, []string{
+		"ma f=0i 0\nmb f=1i 1000000000\n",
+		"mc f=2i 2000000000\n",
+		"me f=4i 4000000000\nmf f=5i 5000000000\n",
+		"mg f=6i 6000000000\n",
+	})
+	var results []string
+	for _, r := range rec.results {
+		if r.Err != nil {
+			results = append(results, r.Err.Error())
+		} else {
+			results = append(results, "ok")
+		}
+	}
+	c.Assert(results, qt.DeepEquals, []string{
+		"ok",
+		"ok",
+		"write failed with status 413: Request Entity Too Large",
+		"ok",
+		"ok",
+	})
+}
+
+func TestNewWriterInvalidURL(t *testing.T) {
+	c := qt.New(t)
+	_, err := client.NewWriter("ftp://localhost/write", nil)
+	c.Assert(err, qt.ErrorMatches, `invalid write URL "ftp://localhost/write": scheme must be http or https`)
+}
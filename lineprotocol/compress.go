@@ -0,0 +1,184 @@
+package lineprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Compression identifies the compression format of
+// line-protocol input.
+type Compression int
+
+const (
+	// AutoCompression specifies that the compression format
+	// is detected from the initial bytes of the input.
+	// Input that isn't recognized as compressed is
+	// read uncompressed.
+	AutoCompression Compression = iota
+
+	// Uncompressed specifies that the input is not compressed.
+	Uncompressed
+
+	// Gzip specifies gzip-compressed input (RFC 1952).
+	// Input holding several concatenated gzip members
+	// is decompressed as a single stream.
+	Gzip
+
+	// Zstd specifies Zstandard-compressed input (RFC 8878).
+	// See CompressedDecoderOptions.NewZstdReader.
+	Zstd
+)
+
+// String implements fmt.Stringer.
+func (c Compression) String() string {
+	switch c {
+	case AutoCompression:
+		return "auto"
+	case Uncompressed:
+		return "uncompressed"
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("Compression(%d)", int(c))
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ErrDecompressedTooLarge signals that decompressed input is
+// larger than the maximum allowed by CompressedDecoderOptions.MaxSize.
+var ErrDecompressedTooLarge = errors.New("decompressed line-protocol data too large")
+
+// CompressedDecoderOptions holds options for NewDecoderCompressed.
+type CompressedDecoderOptions struct {
+	// Compression holds the compression format of the input.
+	// The zero value, AutoCompression, detects the format.
+	Compression Compression
+
+	// MaxSize holds the maximum number of decompressed bytes
+	// that will be read. When the limit is exceeded, the Decoder's
+	// Err method will return an error for which
+	// errors.Is(err, ErrDecompressedTooLarge) is true.
+	// This guards against input that decompresses to an
+	// unreasonable size. If it's zero, there's no limit.
+	MaxSize int64
+
+	// NewZstdReader is used to create a reader that decompresses
+	// Zstandard-compressed data from r. This package does not
+	// include a Zstandard implementation, so this must be set
+	// in order to decode such input; for example, it can use the
+	// NewReader function in the github.com/klauspost/compress/zstd
+	// package.
+	NewZstdReader func(r io.Reader) (io.Reader, error)
+}
+
+// NewDecoderCompressed returns a decoder that reads compressed
+// line-protocol text from r, decompressing it on the fly.
+// If opts is nil, the default options are used.
+//
+// The line numbers and offsets in any DecodeError
+// refer to the decompressed text. Errors in the compressed
+// data are returned by the Decoder's Err method.
+func NewDecoderCompressed(r io.Reader, opts *CompressedDecoderOptions) *Decoder {
+	if opts == nil {
+		opts = &CompressedDecoderOptions{}
+	}
+	return NewDecoder(&decompressReader{
+		r:    r,
+		opts: *opts,
+	})
+}
+
+// decompressReader is an io.Reader that decompresses the
+// data read from r. The decompressor is created by the
+// first call to Read.
+type decompressReader struct {
+	r    io.Reader
+	opts CompressedDecoderOptions
+
+	// dr holds the decompressing reader.
+	dr io.Reader
+	// n holds the number of decompressed bytes read so far.
+	n int64
+	// err holds any error that's been encountered
+	// creating the decompressor or enforcing the size limit.
+	err error
+}
+
+// Read implements io.Reader.
+func (r *decompressReader) Read(buf []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.dr == nil {
+		r.dr, r.err = r.newReader()
+		if r.err != nil {
+			return 0, r.err
+		}
+	}
+	maxSize := r.opts.MaxSize
+	if maxSize > 0 && int64(len(buf)) > maxSize-r.n+1 {
+		// Read at most one byte more than the limit, so
+		// that we can tell whether it's been exceeded.
+		buf = buf[:maxSize-r.n+1]
+	}
+	n, err := r.dr.Read(buf)
+	r.n += int64(n)
+	if maxSize > 0 && r.n > maxSize {
+		n -= int(r.n - maxSize)
+		r.n = maxSize
+		r.err = fmt.Errorf("%w (maximum %d bytes)", ErrDecompressedTooLarge, maxSize)
+		return n, r.err
+	}
+	return n, err
+}
+
+// newReader returns a reader that decompresses the data
+// from r.r according to r.opts.
+func (r *decompressReader) newReader() (io.Reader, error) {
+	rd := r.r
+	c := r.opts.Compression
+	if c == AutoCompression {
+		brd := bufio.NewReader(rd)
+		// Note: an error from Peek will be returned
+		// again by the first Read call.
+		magic, _ := brd.Peek(len(zstdMagic))
+		switch {
+		case bytes.HasPrefix(magic, gzipMagic):
+			c = Gzip
+		case bytes.HasPrefix(magic, zstdMagic):
+			c = Zstd
+		default:
+			c = Uncompressed
+		}
+		rd = brd
+	}
+	switch c {
+	case Uncompressed:
+		return rd, nil
+	case Gzip:
+		zr, err := gzip.NewReader(rd)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decompress gzip data: %w", err)
+		}
+		return zr, nil
+	case Zstd:
+		if r.opts.NewZstdReader == nil {
+			return nil, fmt.Errorf("cannot decompress zstd data: no zstd decompressor configured")
+		}
+		zr, err := r.opts.NewZstdReader(rd)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decompress zstd data: %w", err)
+		}
+		return zr, nil
+	}
+	return nil, fmt.Errorf("unknown compression %v", c)
+}
@@ -0,0 +1,162 @@
+package lineprotocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func gzipData(s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.Bytes()
+}
+
+// fakeZstdData returns s preceded by the Zstandard magic number,
+// to be "decompressed" by newFakeZstdReader.
+func fakeZstdData(s string) []byte {
+	return append(append([]byte(nil), zstdMagic...), s...)
+}
+
+func newFakeZstdReader(r io.Reader) (io.Reader, error) {
+	magic := make([]byte, len(zstdMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, zstdMagic) {
+		return nil, errors.New("bad magic number")
+	}
+	return r, nil
+}
+
+const compressTestText = "m1 f=1i 1\n\nm2 f=2i 2\nm3 f=3i 3\n"
+
+var compressedDecoderTests = []struct {
+	testName     string
+	data         []byte
+	opts         *CompressedDecoderOptions
+	expectPoints []string
+	expectError  string
+}{{
+	testName:     "gzip",
+	data:         gzipData(compressTestText),
+	opts:         &CompressedDecoderOptions{Compression: Gzip},
+	expectPoints: []string{"m1", "m2", "m3"},
+}, {
+	testName:     "auto-gzip",
+	data:         gzipData(compressTestText),
+	expectPoints: []string{"m1", "m2", "m3"},
+}, {
+	testName:     "auto-concatenated-gzip",
+	data:         append(gzipData("m1 f=1i 1\n"), gzipData("m2 f=2i 2\n")...),
+	expectPoints: []string{"m1", "m2"},
+}, {
+	testName:     "auto-uncompressed",
+	data:         []byte(compressTestText),
+	expectPoints: []string{"m1", "m2", "m3"},
+}, {
+	testName:     "auto-short-input",
+	data:         []byte("m"),
+	expectPoints: []string{"error: at line 1:2: expected tag key or field but found end of input instead"},
+}, {
+	testName: "auto-empty",
+	data:     []byte{},
+}, {
+	testName: "zstd",
+	data:     fakeZstdData(compressTestText),
+	opts: &CompressedDecoderOptions{
+		Compression:   Zstd,
+		NewZstdReader: newFakeZstdReader,
+	},
+	expectPoints: []string{"m1", "m2", "m3"},
+}, {
+	testName: "auto-zstd",
+	data:     fakeZstdData(compressTestText),
+	opts: &CompressedDecoderOptions{
+		NewZstdReader: newFakeZstdReader,
+	},
+	expectPoints: []string{"m1", "m2", "m3"},
+}, {
+	testName:    "zstd-without-decompressor",
+	data:        fakeZstdData(compressTestText),
+	expectError: `cannot decompress zstd data: no zstd decompressor configured`,
+}, {
+	testName:    "invalid-gzip",
+	data:        []byte(compressTestText),
+	opts:        &CompressedDecoderOptions{Compression: Gzip},
+	expectError: `cannot decompress gzip data: gzip: invalid header`,
+}, {
+	testName:    "truncated-gzip",
+	data:        gzipData(compressTestText)[:10],
+	expectError: `unexpected EOF`,
+}, {
+	testName: "error-line-numbers",
+	data:     gzipData("m1 f=1i\n\n\nm2 f=x\nm3 f=3i\n"),
+	expectPoints: []string{
+		"m1",
+		`error: at line 4:6: value for field "f" ("x") has unrecognized type`,
+		"m3",
+	},
+}, {
+	testName: "max-size",
+	data:     gzipData(compressTestText),
+	opts: &CompressedDecoderOptions{
+		MaxSize: int64(len(compressTestText)),
+	},
+	expectPoints: []string{"m1", "m2", "m3"},
+}, {
+	testName: "max-size-exceeded",
+	data:     gzipData(compressTestText),
+	opts: &CompressedDecoderOptions{
+		MaxSize: int64(len(compressTestText)) - 1,
+	},
+	// Note: the final entry is truncated but still valid.
+	expectPoints: []string{"m1", "m2", "m3"},
+	expectError:  `decompressed line-protocol data too large \(maximum 30 bytes\)`,
+}}
+
+func TestNewDecoderCompressed(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range compressedDecoderTests {
+		c.Run(test.testName, func(c *qt.C) {
+			dec := NewDecoderCompressed(bytes.NewReader(test.data), test.opts)
+			var points []string
+			var p Point
+			for dec.Next() {
+				if err := dec.DecodePoint(&p, Nanosecond, time.Time{}); err != nil {
+					points = append(points, "error: "+err.Error())
+					continue
+				}
+				points = append(points, string(p.Measurement))
+			}
+			c.Assert(points, qt.DeepEquals, test.expectPoints)
+			if test.expectError != "" {
+				c.Assert(dec.Err(), qt.ErrorMatches, test.expectError)
+			} else {
+				c.Assert(dec.Err(), qt.IsNil)
+			}
+		})
+	}
+}
+
+func TestNewDecoderCompressedMaxSizeError(t *testing.T) {
+	c := qt.New(t)
+	data := gzipData(strings.Repeat("m f=1i\n", 100000))
+	dec := NewDecoderCompressed(bytes.NewReader(data), &CompressedDecoderOptions{
+		MaxSize: 1000,
+	})
+	n := 0
+	for dec.Next() {
+		n++
+	}
+	c.Assert(n, qt.Equals, 143)
+	c.Assert(errors.Is(dec.Err(), ErrDecompressedTooLarge), qt.IsTrue)
+}
@@ -2,6 +2,7 @@ package lineprotocol
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -21,6 +22,17 @@ const (
 	// This is a trade-off between copy overhead and the likelihood
 	// that a complete line-protocol entry will fit into this size.
 	maxSlide = 256
+
+	// maxRetainedBuf is the maximum capacity of a buffer
+	// that will be retained for reuse by Reset and ResetBytes.
+	// Larger buffers are discarded so that decoding a single
+	// large input doesn't cause a long-lived Decoder to hold
+	// on to a large amount of memory.
+	maxRetainedBuf = 64 * 1024
+
+	// initialEscBuf holds the initial capacity of the buffer used
+	// for unescaped data.
+	initialEscBuf = 512
 )
 
 var (
@@ -88,6 +100,53 @@ type Decoder struct {
 	// character at buf[r1].
 	line int64
 
+	// offset holds the offset within the input stream
+	// of the byte at buf[0].
+	offset int64
+
+	// errorLineLength holds the maximum number of bytes
+	// of line text to include in a DecodeError.
+	errorLineLength int
+
+	// multipleErrors holds whether the decoder attempts
+	// to continue decoding an entry after a syntax error.
+	multipleErrors bool
+
+	// maxLineSize holds the maximum number of bytes that
+	// will be buffered for a single entry. If it's zero, there's
+	// no limit.
+	maxLineSize int
+
+	// lineTooLong holds whether the current entry has
+	// exceeded maxLineSize. When it's true, no more data will
+	// be read until the rest of the line has been discarded.
+	lineTooLong bool
+
+	// iterErr holds the error that terminated the most
+	// recent Tags or Fields iteration.
+	iterErr error
+
+	// comments holds whether Next returns comment lines
+	// as entries.
+	comments bool
+
+	// comment holds the text of the current entry
+	// when it's a comment, and nil otherwise.
+	comment []byte
+
+	// entryStart holds the offset within the input stream
+	// of the start of the current entry.
+	entryStart int64
+
+	// entryLine holds the line number of the start
+	// of the current entry.
+	entryLine int64
+
+	// seriesTags and seriesKey hold the tags and the result
+	// of the most recent call to SeriesKey.
+	seriesTags []Tag
+	seriesKey  []byte
+
 	// err holds any non-EOF error that was returned from rd.
 	err error
 }
@@ -107,12 +166,154 @@ func NewDecoderWithBytes(buf []byte) *Decoder {
 func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{
 		rd:      r,
-		escBuf:  make([]byte, 0, 512),
+		escBuf:  make([]byte, 0, initialEscBuf),
 		section: endSection,
 		line:    1,
 	}
 }
 
+// Reset resets the decoder to read from r, discarding any
+// buffered data and state. Settings such as the maximum line
+// size are retained. The decoder's internal buffers are reused
+// unless they have grown unusually large.
+//
+// Reset makes it possible to reuse decoders, for example by
+// using a sync.Pool to hold decoders between HTTP requests:
+//
+//	var decoderPool = sync.Pool{
+//		New: func() interface{} {
+//			return lineprotocol.NewDecoder(nil)
+//		},
+//	}
+//
+//	func handler(w http.ResponseWriter, req *http.Request) {
+//		dec := decoderPool.Get().(*lineprotocol.Decoder)
+//		defer decoderPool.Put(dec)
+//		dec.Reset(req.Body)
+//		for dec.Next() {
+//			...
+//		}
+//	}
+//
+// Note that the data returned by the decoder must not be used
+// after the decoder has been put back into the pool.
+func (d *Decoder) Reset(r io.Reader) {
+	buf := d.buf
+	if d.rd == nil || cap(buf) > maxRetainedBuf {
+		// Either the buffer was provided by the caller to
+		// NewDecoderWithBytes or ResetBytes, so we
+		// must not write to it, or it's too large to keep.
+		buf = nil
+	}
+	d.reset1(buf[:0])
+	d.rd = r
+	d.complete = false
+}
+
+// ResetBytes is like Reset except that the decoder
+// will read the line-protocol text inside buf, as if
+// it had been created with NewDecoderWithBytes.
+func (d *Decoder) ResetBytes(buf []byte) {
+	d.reset1(buf)
+	d.rd = nil
+	d.complete = true
+}
+
+// reset1 resets all the decoder state apart from the
+// settings and the reader, and sets the buffer to buf.
+func (d *Decoder) reset1(buf []byte) {
+	escBuf := d.escBuf[:0]
+	if cap(escBuf) > maxRetainedBuf {
+		escBuf = make([]byte, 0, initialEscBuf)
+	}
+	seriesKey := d.seriesKey[:0]
+	if cap(seriesKey) > maxRetainedBuf {
+		seriesKey = nil
+	}
+	*d = Decoder{
+		buf:             buf,
+		escBuf:          escBuf,
+		seriesTags:      d.seriesTags[:0],
+		seriesKey:       seriesKey,
+		section:         endSection,
+		line:            1,
+		errorLineLength: d.errorLineLength,
+		multipleErrors:  d.multipleErrors,
+		maxLineSize:     d.maxLineSize,
+		comments:        d.comments,
+	}
+}
+
+// SetMaxLineSize sets the maximum number of bytes that the decoder
+// will buffer for a single entry, which bounds the amount of
+// memory that it will use. If n is zero or negative, there is no limit.
+//
+// When an entry is longer than n bytes, the Decoder method that
+// encounters the limit returns a *DecodeError for which
+// errors.Is(err, ErrLineTooLong) will return true. The remainder
+// of the line is discarded without being buffered, and decoding
+// continues with the next line.
+//
+// The limit only applies when reading from an io.Reader:
+// entries decoded from a Decoder created with NewDecoderWithBytes
+// are already held in memory, so it has no effect there.
+func (d *Decoder) SetMaxLineSize(n int) {
+	if n < 0 {
+		n = 0
+	}
+	d.maxLineSize = n
+}
+
+// SetErrorLineLength sets the maximum number of bytes of the text
+// of an erroneous line that will be included in the LineText field
+// of a DecodeError. By default, or if n is zero or negative,
+// no text is included.
+func (d *Decoder) SetErrorLineLength(n int) {
+	if n < 0 {
+		n = 0
+	}
+	d.errorLineLength = n
+}
+
+// SetMultipleErrors sets whether the decoder attempts to find
+// more than one error in an entry. By default, after a syntax error,
+// the rest of the entry is skipped and subsequent Decoder methods
+// return no more data for that entry.
+//
+// When multiple is true, the decoder instead attempts to recover
+// by skipping to the next separator (comma or space) in the
+// entry, so subsequent calls to NextTag, NextField and Time can
+// return more errors (or valid data). This is useful when validating
+// input, so that all the problems with a line can be reported at once.
+// See also EntryErrors.
+//
+// Note that the recovery is necessarily heuristic, so some
+// errors reported after the first one in an entry may be consequences
+// of the first.
+func (d *Decoder) SetMultipleErrors(multiple bool) {
+	d.multipleErrors = multiple
+}
+
+// SetComments sets whether the decoder returns comment lines as entries.
+// By default, comments are skipped like empty lines.
+//
+// When enabled is true, Next also stops at each comment line.
+// For such an entry, Comment returns the text of the comment
+// and the other Decoder methods return no data.
+func (d *Decoder) SetComments(enabled bool) {
+	d.comments = enabled
+}
+
+// Comment returns the text of the current entry after the leading #
+// character if it's a comment, or nil if it's not.
+// It always returns nil unless SetComments(true) has been called.
+//
+// As with the other Decoder methods, the returned slice is
+// only valid until the next call to Next.
+func (d *Decoder) Comment() []byte {
+	return d.comment
+}
+
 // Next advances to the next entry, and reports whether there is an
 // entry available. Syntax errors on individual lines do not cause this
 // to return false (the decoder attempts to recover from badly
@@ -128,7 +329,8 @@ func NewDecoder(r io.Reader) *Decoder {
 // only valid until the next call to any other Decode method.
 //
 // Decoder will skip earlier components if a later method is called,
-// but it doesn't retain the entire entry, so it cannot go backwards.
+// but it cannot go backwards. The original text of the entry
+// is available from RawLine.
 //
 // For example, to retrieve only the timestamp of all lines, this suffices:
 //
@@ -137,19 +339,74 @@ func NewDecoder(r io.Reader) *Decoder {
 //	}
 //
 func (d *Decoder) Next() bool {
+	d.skipEntry()
+	d.skipEmptyLines()
+	d.section = measurementSection
+	d.entryStart = d.offset + int64(d.r1)
+	d.entryLine = d.line
+	d.iterErr = nil
+	d.comment = nil
+	if d.comments && d.ensure(1) && d.at(0) == '#' && d.takeComment() {
+		return true
+	}
+	return d.ensure(1)
+}
+
+// skipEntry consumes the rest of the current entry,
+// ignoring any errors.
+func (d *Decoder) skipEntry() {
 	if _, err := d.advanceToSection(endSection); err != nil {
 		// There was a syntax error and the line might not be
 		// fully consumed, so make sure that we do actually
-		// consume the rest of the line. This relies on the fact
-		// that when we return a syntax error, we abandon the
-		// rest of the line by going to newlineSection. If we
-		// changed that behaviour (for example to allow obtaining
-		// multiple errors per line), then we might need to loop here.
+		// consume the rest of the line. When multiple errors are
+		// enabled, the decoder might have recovered to an earlier
+		// section, but we're not interested in any more errors,
+		// so abandon the rest of the line by going to newlineSection.
+		if d.section < newlineSection {
+			d.section = newlineSection
+		}
 		d.advanceToSection(endSection)
 	}
-	d.skipEmptyLines()
-	d.section = measurementSection
-	return d.ensure(1)
+}
+
+// RawLine returns the original text of the current entry,
+// from the start of the measurement (or the # of a comment)
+// up to but not including the newline at the end of the entry.
+// Any escape sequences are left intact. If the entry holds a
+// multi-line string field value, the returned text
+// includes all its lines.
+//
+// RawLine consumes the rest of the entry, so after calling
+// it, the other Decoder methods will return no more data
+// for the entry. Any syntax errors in the remainder of the
+// entry are ignored. It can be called at any point after
+// Next, including after an error has been returned, so it
+// can be used to retain the exact text of an entry that
+// fails validation.
+//
+// If the entry was longer than the limit set by SetMaxLineSize,
+// its text is no longer available and RawLine returns nil.
+//
+// As with the other Decoder methods, the returned slice
+// is only valid until the next call to Next.
+func (d *Decoder) RawLine() []byte {
+	d.skipEntry()
+	start := d.entryStart - d.offset
+	if start < 0 || start >= int64(d.r1) {
+		// The entry was too long and its data has been
+		// discarded, possibly leaving nothing in the buffer.
+		return nil
+	}
+	line := d.buf[start:d.r1]
+	line = bytes.TrimSuffix(line, newlineBytes)
+	line = bytes.TrimSuffix(line, crBytes)
+	return line
+}
+
+// EntryLine returns the one-based line number of the
+// start of the current entry.
+func (d *Decoder) EntryLine() int64 {
+	return d.entryLine
 }
 
 // Err returns any I/O error encountered when reading
@@ -183,11 +440,17 @@ func (d *Decoder) Measurement() ([]byte, error) {
 		// there's no way for the comment-parsing code to return an error, so instead
 		// the read point is set to the start of the comment and we hit this case.
 		// TODO find the actual invalid character to give a more accurate position.
-		return nil, d.syntaxErrorf(i0, "invalid character found in comment line")
+		err := d.syntaxErrorf(i0, "invalid character found in comment line")
+		// There's no point in trying to find more errors in a comment.
+		d.section = newlineSection
+		return nil, err
 	}
 	if err := d.advanceTagComma(); err != nil {
 		return nil, err
 	}
+	if d.lineTooLong {
+		return nil, d.lineTooLongError()
+	}
 	d.section = tagSection
 	return measure, nil
 }
@@ -237,6 +500,9 @@ func (d *Decoder) NextTag() (key, value []byte, err error) {
 		return nil, nil, d.syntaxErrorf(i0, "expected tag value after tag key %q, but none found", tagKey)
 	}
 	if !d.ensure(1) {
+		if d.lineTooLong {
+			return nil, nil, d.lineTooLongError()
+		}
 		// There's no more data after the tag value. Instead of returning an error
 		// immediately, advance to the field section and return the tag and value.
 		// This means that we'll see all the tags even when there's no value,
@@ -349,6 +615,9 @@ func (d *Decoder) NextFieldBytes() (key []byte, kind ValueKind, value []byte, er
 		return nil, Unknown, nil, d.syntaxErrorf(start, "value for field %q (%q) has unrecognized type", fieldKey, fieldVal)
 	}
 	if !d.ensure(1) {
+		if d.lineTooLong {
+			return nil, Unknown, nil, d.lineTooLongError()
+		}
 		d.section = endSection
 		return fieldKey, fieldKind, fieldVal, nil
 	}
@@ -362,6 +631,9 @@ func (d *Decoder) NextFieldBytes() (key []byte, kind ValueKind, value []byte, er
 	}
 	d.discardc(' ')
 	if d.takeEOL() {
+		if d.lineTooLong {
+			return nil, Unknown, nil, d.lineTooLongError()
+		}
 		d.section = endSection
 		return fieldKey, fieldKind, fieldVal, nil
 	}
@@ -429,7 +701,7 @@ func (d *Decoder) NextField() (key []byte, val Value, err error) {
 		// we can reconstruct the index of the start of the field.
 		escLen, _ := tagKeyEscapes.escapedLen(unsafeBytesToString(key))
 		startIndex += escLen + len("=")
-		return nil, Value{}, d.syntaxErrorf(startIndex, "cannot parse value for field key %q: %w", key, err)
+		return nil, Value{}, d.valueErrorf(startIndex, "cannot parse value for field key %q: %w", key, err)
 	}
 	return key, v, nil
 }
@@ -449,6 +721,9 @@ func (d *Decoder) TimeBytes() ([]byte, error) {
 		timeBytes = nil
 	}
 	if !d.ensure(1) {
+		if d.lineTooLong {
+			return nil, d.lineTooLongError()
+		}
 		d.section = endSection
 		return timeBytes, nil
 	}
@@ -459,6 +734,9 @@ func (d *Decoder) TimeBytes() ([]byte, error) {
 	}
 	d.discardc(' ')
 	if !d.ensure(1) {
+		if d.lineTooLong {
+			return nil, d.lineTooLongError()
+		}
 		d.section = endSection
 		return timeBytes, nil
 	}
@@ -501,26 +779,105 @@ func (d *Decoder) Time(prec Precision, defaultTime time.Time) (time.Time, error)
 	return time.Unix(0, ns), nil
 }
 
+// EntryErrors decodes the rest of the current entry, interpreting any
+// timestamp with the given precision, and returns all the errors found.
+// Unless SetMultipleErrors(true) has been called, at most
+// one error will be returned.
+func (d *Decoder) EntryErrors(prec Precision) []*DecodeError {
+	var errs []*DecodeError
+	addErr := func(err error) {
+		if derr, ok := err.(*DecodeError); ok {
+			errs = append(errs, derr)
+		}
+	}
+	if _, err := d.Measurement(); err != nil {
+		addErr(err)
+	}
+	for d.section == tagSection {
+		if _, _, err := d.NextTag(); err != nil {
+			addErr(err)
+		}
+	}
+	for d.section == fieldSection {
+		if _, _, err := d.NextField(); err != nil {
+			addErr(err)
+		}
+	}
+	if _, err := d.Time(prec, time.Time{}); err != nil {
+		addErr(err)
+	}
+	return errs
+}
+
 // consumeLine is used to recover from errors by reading an entire
 // line even if it contains invalid characters.
 func (d *Decoder) consumeLine() {
 	d.take(notNewline)
+	d.discardLongLine()
 	if d.at(0) == '\n' {
 		d.advance(1)
 		d.line++
 	}
-	d.reset()
+	// Note: the buffer isn't reset here so that
+	// the text of the entry remains available to RawLine.
+	// It will be reset when the next entry is started.
+	d.section = endSection
+}
+
+// discardLongLine discards the rest of the current line
+// without buffering it when the line has been found
+// to exceed the maximum line size. It leaves the read
+// position at the newline, if any.
+func (d *Decoder) discardLongLine() {
+	for d.lineTooLong {
+		d.lineTooLong = false
+		// Note: the error for the long line (if any) has already been
+		// returned, so we can throw away everything that's in the buffer.
+		d.offset += int64(len(d.buf))
+		d.buf = d.buf[:0]
+		d.r0 = 0
+		d.r1 = 0
+		d.take(notNewline)
+	}
+}
+
+// takeComment consumes a comment line at the current read position
+// and makes it available as the current entry. If the comment
+// is invalid or too long, it leaves the read position unchanged
+// and returns false, so that Measurement will return the error.
+func (d *Decoder) takeComment() bool {
+	start := d.r1 - d.r0
+	d.take(commentChars)
+	end := d.r1 - d.r0
+	if d.lineTooLong || !d.takeEOL() {
+		d.r1 = d.r0 + start
+		return false
+	}
+	// Note: the buffer is not reset until the next call to Next,
+	// so the comment remains valid until then.
+	d.comment = d.buf[d.r0+start+1 : d.r0+end]
 	d.section = endSection
+	return true
 }
 
 func (d *Decoder) skipEmptyLines() {
 	for {
+		// Discard any empty lines or comments already consumed so
+		// that they don't count towards the size of the next entry.
+		d.reset()
 		startLine := d.r1 - d.r0
 		d.discardc(' ')
 		switch d.at(0) {
 		case '#':
+			if d.comments {
+				// Leave the comment for Next to return.
+				return
+			}
 			// Found a comment.
 			d.take(commentChars)
+			// Comments are ignored, so there's no need to
+			// report an error when one is too long.
+			d.discardLongLine()
 			if !d.takeEOL() {
 				// Comment has invalid characters.
 				// Rewind input to start of comment so
@@ -763,7 +1120,10 @@ outer:
 	return taken, start, nil
 }
 
-var newlineBytes = []byte{'\n'}
+var (
+	newlineBytes = []byte{'\n'}
+	crBytes      = []byte{'\r'}
+)
 
 // at returns the byte at i bytes after the current read position.
 // It assumes that the index has already been ensured.
@@ -780,6 +1140,7 @@ func (d *Decoder) reset() {
 	if unread := len(d.buf) - d.r1; unread == 0 {
 		// No bytes in the buffer, so we can start from the beginning without
 		// needing to copy anything (and get better cache behaviour too).
+		d.offset += int64(len(d.buf))
 		d.buf = d.buf[:0]
 		d.r1 = 0
 	} else if !d.complete && unread <= maxSlide {
@@ -787,6 +1148,7 @@ func (d *Decoder) reset() {
 		// start so that when we read more data,
 		// there's less chance that we'll need to grow the buffer.
 		copy(d.buf, d.buf[d.r1:])
+		d.offset += int64(d.r1)
 		d.r1 = 0
 		d.buf = d.buf[:unread]
 	}
@@ -820,6 +1182,13 @@ func (d *Decoder) ensure1(n int) bool {
 			// No possibility of more data.
 			return false
 		}
+		if d.maxLineSize > 0 && d.r1+n-d.r0 > d.maxLineSize {
+			// The current entry won't fit. Note that readMore never reads
+			// past d.r0+d.maxLineSize so this check is sufficient to
+			// catch all entries that are too long.
+			d.lineTooLong = true
+			return false
+		}
 		d.readMore()
 		if d.r1+n <= len(d.buf) {
 			// There are enough bytes available.
@@ -837,20 +1206,36 @@ func (d *Decoder) readMore() {
 	if n < minRead {
 		// We need to grow the buffer. Note that we don't have to copy
 		// the unused part of the buffer (d.buf[:d.r0]).
-		// TODO provide a way to limit the maximum size that
-		// the buffer can grow to.
 		used := len(d.buf) - d.r0
 		n1 := cap(d.buf) * 2
 		if n1-used < minGrow {
 			n1 = used + minGrow
 		}
-		buf1 := make([]byte, used, n1)
-		copy(buf1, d.buf[d.r0:])
-		d.buf = buf1
-		d.r1 -= d.r0
-		d.r0 = 0
+		if d.maxLineSize > 0 && n1 > d.maxLineSize {
+			// There's no point in growing the buffer larger
+			// than the maximum line size. Note that used is always
+			// less than maxLineSize here (see ensure1).
+			n1 = d.maxLineSize
+		}
+		// Note: when the current entry already starts at the beginning
+		// of the buffer and the buffer is large enough, there's
+		// no need to allocate.
+		if d.r0 > 0 || n1 > cap(d.buf) {
+			buf1 := make([]byte, used, n1)
+			copy(buf1, d.buf[d.r0:])
+			d.offset += int64(d.r0)
+			d.buf = buf1
+			d.r1 -= d.r0
+			d.r0 = 0
+		}
 	}
-	n, err := d.rd.Read(d.buf[len(d.buf):cap(d.buf)])
+	end := cap(d.buf)
+	if d.maxLineSize > 0 && d.r0+d.maxLineSize < end {
+		// Don't read beyond the maximum line size so that
+		// we'll always know when an entry is too long.
+		end = d.r0 + d.maxLineSize
+	}
+	n, err := d.rd.Read(d.buf[len(d.buf):end])
 	d.buf = d.buf[:len(d.buf)+n]
 	if err == nil {
 		return
@@ -861,9 +1246,44 @@ func (d *Decoder) readMore() {
 	}
 }
 
+// lineTooLongError returns the error for an entry that has exceeded
+// the maximum line size.
+func (d *Decoder) lineTooLongError() error {
+	return d.syntaxError(0, fmt.Errorf("%w (maximum %d bytes)", ErrLineTooLong, d.maxLineSize))
+}
+
 // syntaxErrorf records a syntax error at the given offset from d.r0
 // and the using the given fmt.Sprintf-formatted message.
 func (d *Decoder) syntaxErrorf(offset int, f string, a ...interface{}) error {
+	if d.lineTooLong {
+		// The entry has been truncated, so any syntax error
+		// is probably a result of that.
+		return d.lineTooLongError()
+	}
+	return d.syntaxError(offset, fmt.Errorf(f, a...))
+}
+
+// valueErrorf is like syntaxErrorf except that it's used
+// for errors in a field value that has already been
+// consumed, so the decoder is already positioned correctly
+// to continue decoding the entry when multiple errors are enabled.
+func (d *Decoder) valueErrorf(offset int, f string, a ...interface{}) error {
+	if d.lineTooLong || !d.multipleErrors {
+		return d.syntaxErrorf(offset, f, a...)
+	}
+	return d.decodeError(offset, fmt.Errorf(f, a...))
+}
+
+// syntaxError records a syntax error at the given offset from d.r0
+// and arranges to recover from it.
+func (d *Decoder) syntaxError(offset int, err error) error {
+	derr := d.decodeError(offset, err)
+	d.recoverFromError()
+	return derr
+}
+
+// decodeError returns a DecodeError for an error at the given offset from d.r0.
+func (d *Decoder) decodeError(offset int, err error) *DecodeError {
 	// Note: we only ever reset the buffer at the end of an entry,
 	// so we can assume that d.r0 corresponds to column 1.
 	buf := d.buf[d.r0 : d.r0+offset]
@@ -881,25 +1301,150 @@ func (d *Decoder) syntaxErrorf(offset int, f string, a ...interface{}) error {
 	remain := d.buf[d.r0+offset : d.r1]
 	line := d.line - int64(bytes.Count(remain, newlineBytes))
 
-	// We'll recover from a syntax error by reading all bytes until
-	// the next newline. We don't want to do that if we've already
-	// just scanned the end of a line.
-	if d.section != endSection {
-		d.section = newlineSection
-	}
-	return &DecodeError{
+	derr := &DecodeError{
 		Line:   line,
 		Column: column,
-		Err:    fmt.Errorf(f, a...),
+		Offset: d.offset + int64(d.r0+offset),
+		Err:    err,
 	}
+	if d.errorLineLength > 0 {
+		derr.LineText, derr.LineTextOffset = d.lineText(offset-len(columnBytes), offset)
+	}
+	return derr
 }
 
+// recoverFromError arranges for decoding to continue after a syntax error.
+func (d *Decoder) recoverFromError() {
+	if d.section == endSection {
+		// We've already just scanned the end of the line.
+		return
+	}
+	if !d.multipleErrors || d.lineTooLong {
+		// We'll recover from a syntax error by reading all bytes until
+		// the next newline.
+		d.section = newlineSection
+		return
+	}
+	switch d.section {
+	case measurementSection, tagSection:
+		d.skipToSeparator()
+		switch {
+		case d.lineTooLong || !d.ensure(1) || d.at(0) == '\n':
+			d.section = newlineSection
+		case d.at(0) == ',':
+			d.advance(1)
+			d.section = tagSection
+		default:
+			// Leave the space there so that NextTag
+			// moves on to the field section.
+			d.section = tagSection
+		}
+	case fieldSection:
+		d.skipToSeparator()
+		switch {
+		case d.lineTooLong || !d.ensure(1) || d.at(0) == '\n':
+			d.section = newlineSection
+		case d.at(0) == ',':
+			d.advance(1)
+		default:
+			d.discardc(' ')
+			if d.takeEOL() {
+				d.section = endSection
+			} else {
+				d.section = timeSection
+			}
+		}
+	default:
+		d.section = newlineSection
+	}
+}
+
+// skipToSeparator skips input up until the next unescaped
+// comma, space or newline.
+func (d *Decoder) skipToSeparator() {
+	for d.ensure(1) {
+		switch d.at(0) {
+		case ',', ' ', '\n':
+			return
+		case '\\':
+			if d.ensure(2) && d.at(1) != '\n' {
+				d.advance(2)
+				continue
+			}
+		}
+		d.advance(1)
+	}
+}
+
+// lineText returns up to d.errorLineLength bytes of the line
+// starting at start that includes the byte at pos, and the offset
+// of the start of the returned text within the line. Both start and pos
+// are relative to d.r0.
+func (d *Decoder) lineText(start, pos int) (string, int) {
+	// Read as much of the rest of the line as we need, if possible.
+	// Note that the rest of the line will be discarded anyway
+	// when we recover from the error.
+	for bytes.IndexByte(d.buf[d.r0+pos:], '\n') == -1 && len(d.buf)-(d.r0+pos) < d.errorLineLength {
+		n := len(d.buf) - d.r1 + 1
+		if d.maxLineSize > 0 && d.r1+n-d.r0 > d.maxLineSize {
+			// Don't read past the maximum line size.
+			break
+		}
+		if !d.ensure(n) {
+			break
+		}
+	}
+	// Note: reading more might have moved the data in the buffer.
+	start += d.r0
+	pos += d.r0
+	end := len(d.buf)
+	if i := bytes.IndexByte(d.buf[pos:], '\n'); i >= 0 {
+		end = pos + i
+	}
+	if end-start > d.errorLineLength {
+		// The line is too long, so choose a window
+		// of text around the error position.
+		textStart := pos - d.errorLineLength/2
+		if textStart < start {
+			textStart = start
+		}
+		textEnd := textStart + d.errorLineLength
+		if textEnd > end {
+			textEnd = end
+			textStart = end - d.errorLineLength
+		}
+		return string(d.buf[textStart:textEnd]), textStart - start
+	}
+	return string(d.buf[start:end]), 0
+}
+
+// ErrLineTooLong signals that a line-protocol entry is longer
+// than the maximum allowed by Decoder.SetMaxLineSize.
+var ErrLineTooLong = errors.New("line-protocol entry too long")
+
 // DecodeError represents an error when decoding a line-protocol entry.
 type DecodeError struct {
 	// Line holds the one-based index of the line where the error occurred.
 	Line int64
 	// Column holds the one-based index of the column (in bytes) where the error occurred.
 	Column int
+	// Offset holds the zero-based byte offset within the
+	// input of the position where the error occurred.
+	Offset int64
+	// LineText holds some or all of the text of the line
+	// where the error occurred. It is only set when
+	// Decoder.SetErrorLineLength has been called and holds
+	// at most that many bytes of the line, as far as it's available
+	// in the Decoder's buffer. It does not include the
+	// terminating newline.
+	LineText string
+	// LineTextOffset holds the byte offset within the line
+	// of the start of LineText. It's non-zero only when
+	// the line was too long to include in its entirety, so
+	// LineText holds the text around the error position.
+	// The error position within LineText is at
+	// index Column-1-LineTextOffset.
+	LineTextOffset int
 	// Err holds the underlying error.
 	Err error
 }
@@ -28,7 +28,7 @@ type FieldKeyValue struct {
 	Error string
 }
 
-type Point struct {
+type TestPoint struct {
 	Measurement      string
 	MeasurementError string
 	Tags             []TagKeyValue
@@ -45,8 +45,8 @@ func isDecodeError(err error) bool {
 
 // sectionCheckers holds a function for each section that checks that the result of decoding
 // for that section is as expected.
-var sectionCheckers = []func(c *qt.C, dec *Decoder, expect Point, errp errPositions){
-	measurementSection: func(c *qt.C, dec *Decoder, expect Point, errp errPositions) {
+var sectionCheckers = []func(c *qt.C, dec *Decoder, expect TestPoint, errp errPositions){
+	measurementSection: func(c *qt.C, dec *Decoder, expect TestPoint, errp errPositions) {
 		m, err := dec.Measurement()
 		if expect.MeasurementError != "" {
 			c.Assert(err, qt.Satisfies, isDecodeError)
@@ -57,7 +57,7 @@ var sectionCheckers = []func(c *qt.C, dec *Decoder, expect Point, errp errPositi
 		c.Assert(err, qt.IsNil)
 		c.Assert(string(m), qt.Equals, expect.Measurement, qt.Commentf("runes: %x", []rune(string(m))))
 	},
-	tagSection: func(c *qt.C, dec *Decoder, expect Point, errp errPositions) {
+	tagSection: func(c *qt.C, dec *Decoder, expect TestPoint, errp errPositions) {
 		var tags []TagKeyValue
 		for {
 			key, value, err := dec.NextTag()
@@ -86,7 +86,7 @@ var sectionCheckers = []func(c *qt.C, dec *Decoder, expect Point, errp errPositi
 		}
 		c.Assert(tags, qt.DeepEquals, expectTags)
 	},
-	fieldSection: func(c *qt.C, dec *Decoder, expect Point, errp errPositions) {
+	fieldSection: func(c *qt.C, dec *Decoder, expect TestPoint, errp errPositions) {
 		var fields []FieldKeyValue
 		for {
 			key, value, err := dec.NextField()
@@ -119,7 +119,7 @@ var sectionCheckers = []func(c *qt.C, dec *Decoder, expect Point, errp errPositi
 		}
 		c.Assert(fields, qt.DeepEquals, expectFields)
 	},
-	timeSection: func(c *qt.C, dec *Decoder, expect Point, errp errPositions) {
+	timeSection: func(c *qt.C, dec *Decoder, expect TestPoint, errp errPositions) {
 		timestamp, err := dec.Time(expect.Precision, expect.DefaultTime)
 		if expect.TimeError != "" {
 			c.Assert(err, qt.Satisfies, isDecodeError)
@@ -139,14 +139,14 @@ var decoderTests = []struct {
 	// string contains a corresponding ∑ character, signifying that
 	// it's expected to be a DecodeError at that error position.
 	text   string
-	expect []Point
+	expect []TestPoint
 }{{
 	testName: "all-fields-present-no-escapes",
 	text: `
    # comment
  somename,tag1=val1,tag2=val2  floatfield=1,strfield="hello",intfield=-1i,uintfield=1u,boolfield=true  1602841605822791506
 `,
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "somename",
 		Tags: []TagKeyValue{{
 			Key:   "tag1",
@@ -182,7 +182,7 @@ var decoderTests = []struct {
 
  # last comment
 `,
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m1",
 		Tags: []TagKeyValue{{
 			Key:   "tag1",
@@ -213,7 +213,7 @@ m2 value=∑¹2a.0
 m3 value=32.0
 m4 value=42.0
 `,
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m1",
 		Fields: []FieldKeyValue{{
 			Key:   "value",
@@ -244,7 +244,7 @@ m1 value=12.0
 m2∑¹
 m3 value=32.0
 `,
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m1",
 		Fields: []FieldKeyValue{{
 			Key:   "value",
@@ -271,7 +271,7 @@ m3 value=32.0
 
  # last comment
 `,
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "comma,1",
 		Tags: []TagKeyValue{{
 			Key:   "equals=",
@@ -289,7 +289,7 @@ m3 value=32.0
 }, {
 	testName: "missing-quotes",
 	text:     `TestBucket FieldOné=∑¹Happy,FieldTwo=sad`,
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "TestBucket",
 		Fields: []FieldKeyValue{{
 			Error: `at line ∑¹: value for field "FieldOné" ("Happy") has unrecognized type`,
@@ -299,7 +299,7 @@ m3 value=32.0
 	testName: "trailing-comma-after-measurement",
 	text: `TestBuckét,∑¹ FieldOne=Happy
 next x=1`,
-	expect: []Point{{
+	expect: []TestPoint{{
 		MeasurementError: "at line ∑¹: expected tag key after comma; got white space instead",
 	}, {
 		Measurement: "next",
@@ -311,7 +311,7 @@ next x=1`,
 }, {
 	testName: "missing-comma-after-field",
 	text:     `TestBuckét TagOné="Happy" ∑¹FieldOne=123.45`,
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "TestBuckét",
 		Fields: []FieldKeyValue{{
 			Key:   "TagOné",
@@ -322,7 +322,7 @@ next x=1`,
 }, {
 	testName: "missing timestamp",
 	text:     "b f=1",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "b",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -332,7 +332,7 @@ next x=1`,
 }, {
 	testName: "missing timestamp with newline",
 	text:     "b f=1\n",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "b",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -342,7 +342,7 @@ next x=1`,
 }, {
 	testName: "out-of-range-timestamp",
 	text:     "b f=1 ∑¹9223372036854775808",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "b",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -353,7 +353,7 @@ next x=1`,
 }, {
 	testName: "out-of-range-timestamp-due-to-precision",
 	text:     "b f=1 ∑¹200000000000000000",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "b",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -365,7 +365,7 @@ next x=1`,
 }, {
 	testName: "negative-timestamp-just-in-range",
 	text:     "b f=1 ∑¹-9223372036854775808",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "b",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -376,7 +376,7 @@ next x=1`,
 }, {
 	testName: "negative-timestamp-just-out-of-range",
 	text:     "b f=1 ∑¹-9223372036854775809",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "b",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -387,7 +387,7 @@ next x=1`,
 }, {
 	testName: "missing-timestamp-with-default",
 	text:     "b f=1",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "b",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -399,7 +399,7 @@ next x=1`,
 }, {
 	testName: "field-with-space-and-no-timestamp",
 	text:     "9 f=-7 ",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "9",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -409,7 +409,7 @@ next x=1`,
 }, {
 	testName: "carriage-returns",
 	text:     "# foo\r\nm x=1\r\n\r\n",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Fields: []FieldKeyValue{{
 			Key:   "x",
@@ -419,7 +419,7 @@ next x=1`,
 }, {
 	testName: "carriage-return-in-comment",
 	text:     "∑¹# foo\rxxx\nm x=1\r\n\r\n",
-	expect: []Point{{
+	expect: []TestPoint{{
 		MeasurementError: "at line ∑¹: invalid character found in comment line",
 	}, {
 		Measurement: "m",
@@ -433,7 +433,7 @@ next x=1`,
 	// propagated correctly with errors.Is
 	testName: "out-of-range-value",
 	text:     "mmmé é=∑¹1e9999999999999",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "mmmé",
 		Fields: []FieldKeyValue{{
 			Error: `at line ∑¹: cannot parse value for field key "é": line-protocol value out of range`,
@@ -444,9 +444,9 @@ next x=1`,
 	// Note: we've deliberately got two fields below so that
 	// if we ever change error behaviour so that the caller
 	// can see multiple errors on a single line, this test should
-	// fail (see comment in the Next method).
+	// fail (see comment in the skipEntry method).
 	text: "m f=1,∑¹\x01=1,\x01=2",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -458,7 +458,7 @@ next x=1`,
 }, {
 	testName: "field-value-error-after-newline-in-string",
 	text:     "m f=\"hello\ngoodbye\nx\",gé=∑¹invalid",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -470,7 +470,7 @@ next x=1`,
 }, {
 	testName: "field-string-value-error-after-newline-in-string",
 	text:     "m f=\"a\nb\",g=∑¹\"c\nd",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -482,7 +482,7 @@ next x=1`,
 }, {
 	testName: "non-printable-ASCII-in-tag-key",
 	text:     "m foo∑¹\x01=bar x=1",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Fields: []FieldKeyValue{{
 			Error: `at line ∑¹: want '=' after field key "foo", found '\x01'`,
@@ -491,7 +491,7 @@ next x=1`,
 }, {
 	testName: "non-printable-ASCII-in-tag-key",
 	text:     "m,∑¹foo\x03=bar x=1",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Tags: []TagKeyValue{{
 			Error: `at line ∑¹: expected '=' after tag key "foo", but got '\x03' instead`,
@@ -500,7 +500,7 @@ next x=1`,
 }, {
 	testName: "non-printable-ASCII-in-tag-value",
 	text:     "m,foo=bar∑¹\x02 x=1",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Tags: []TagKeyValue{{
 			Key:   "foo",
@@ -512,7 +512,7 @@ next x=1`,
 }, {
 	testName: "non-printable-ASCII-in-field-key",
 	text:     "m foo∑¹\x01=bar",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Fields: []FieldKeyValue{{
 			Error: `at line ∑¹: want '=' after field key "foo", found '\x01'`,
@@ -521,7 +521,7 @@ next x=1`,
 }, {
 	testName: "backslash-escapes-in-string-field",
 	text:     `m s="\t\r\n\v"`,
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Fields: []FieldKeyValue{{
 			Key:   "s",
@@ -531,7 +531,7 @@ next x=1`,
 }, {
 	testName: "backslash-escapes-in-tags",
 	text:     `m,s=\t\r\n\v x=1`,
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Tags: []TagKeyValue{{
 			Key:   "s",
@@ -545,7 +545,7 @@ next x=1`,
 }, {
 	testName: "bad-tag-key-#1",
 	text:     "m∑¹",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Tags: []TagKeyValue{{
 			Error: `at line ∑¹: expected tag key or field but found end of input instead`,
@@ -554,7 +554,7 @@ next x=1`,
 }, {
 	testName: "bad-tag-key-#2",
 	text:     "m,∑¹=bar¹",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Tags: []TagKeyValue{{
 			Error: `at line ∑¹: empty tag key`,
@@ -563,7 +563,7 @@ next x=1`,
 }, {
 	testName: "bad-tag-key-#3",
 	text:     "m,∑¹x =y¹",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Tags: []TagKeyValue{{
 			Error: `at line ∑¹: expected '=' after tag key "x", but got ' ' instead`,
@@ -572,7 +572,7 @@ next x=1`,
 }, {
 	testName: "bad-tag-key-#4",
 	text:     "m,∑¹x",
-	expect: []Point{{
+	expect: []TestPoint{{
 		Measurement: "m",
 		Tags: []TagKeyValue{{
 			Error: `at line ∑¹: expected '=' after tag key "x", but got end of input instead`,
@@ -595,7 +595,7 @@ func TestDecoder(t *testing.T) {
 // the expected points and returns the number of points
 // consumed. If allowMore is true, it's OK for there
 // to be more points than expected.
-func assertDecodeResult(c *qt.C, dec *Decoder, expect []Point, allowMore bool, errp errPositions) int {
+func assertDecodeResult(c *qt.C, dec *Decoder, expect []TestPoint, allowMore bool, errp errPositions) int {
 	i := 0
 	for {
 		if i >= len(expect) && allowMore {
@@ -637,7 +637,7 @@ func doSection(dec *Decoder, section section) error {
 // expectedSectionError returns the error that's expected when
 // reading any complete section up to and including
 // the given section.
-func expectedSectionError(p Point, section section) string {
+func expectedSectionError(p TestPoint, section section) string {
 	switch section {
 	case measurementSection:
 		if p.MeasurementError != "" {
@@ -946,7 +946,7 @@ func (r *errorReader) Read(buf []byte) (int, error) {
 var scanEntriesBenchmarks = []struct {
 	name     string
 	makeData func() (data []byte, totalEntries int)
-	expect   Point
+	expect   TestPoint
 }{{
 	name: "long-lines",
 	makeData: func() (data []byte, totalEntries int) {
@@ -959,7 +959,7 @@ var scanEntriesBenchmarks = []struct {
 		}
 		return buf.Bytes(), totalEntries
 	},
-	expect: Point{
+	expect: TestPoint{
 		Measurement: "name",
 		Tags: []TagKeyValue{{
 			Key:   "tag1",
@@ -989,7 +989,7 @@ var scanEntriesBenchmarks = []struct {
 		}
 		return buf.Bytes(), totalEntries
 	},
-	expect: Point{
+	expect: TestPoint{
 		Measurement: "name",
 		Tags: []TagKeyValue{{
 			Key:   "ta=g1",
@@ -1012,7 +1012,7 @@ var scanEntriesBenchmarks = []struct {
 	makeData: func() ([]byte, int) {
 		return []byte(`x,t=y y=1 1602841605822791506`), 1
 	},
-	expect: Point{
+	expect: TestPoint{
 		Measurement: "x",
 		Tags: []TagKeyValue{{
 			Key:   "t",
@@ -1027,7 +1027,7 @@ var scanEntriesBenchmarks = []struct {
 }, {
 	name:     "single-short-line-with-escapes",
 	makeData: singleEntry(`x,t=y\,y y=1 1602841605822791506`),
-	expect: Point{
+	expect: TestPoint{
 		Measurement: "x",
 		Tags: []TagKeyValue{{
 			Key:   "t",
@@ -1051,7 +1051,7 @@ var scanEntriesBenchmarks = []struct {
 		}
 		return buf.Bytes(), totalEntries
 	},
-	expect: Point{
+	expect: TestPoint{
 		Measurement: "x",
 		Tags: []TagKeyValue{{
 			Key:   "t",
@@ -1066,7 +1066,7 @@ var scanEntriesBenchmarks = []struct {
 }, {
 	name:     "field-key-escape-not-escapable",
 	makeData: singleEntry(`cpu va\lue=42 1602841605822791506`),
-	expect: Point{
+	expect: TestPoint{
 		Measurement: "cpu",
 		Fields: []FieldKeyValue{{
 			Key:   `va\lue`,
@@ -1077,7 +1077,7 @@ var scanEntriesBenchmarks = []struct {
 }, {
 	name:     "tag-value-triple-escape-space",
 	makeData: singleEntry(`cpu,host=two\\\ words value=42 1602841605822791506`),
-	expect: Point{
+	expect: TestPoint{
 		Measurement: "cpu",
 		Tags: []TagKeyValue{{
 			Key:   "host",
@@ -1092,7 +1092,7 @@ var scanEntriesBenchmarks = []struct {
 }, {
 	name:     "procstat",
 	makeData: singleEntry(`procstat,exe=bash,process_name=bash voluntary_context_switches=42i,memory_rss=5103616i,rlimit_memory_data_hard=2147483647i,cpu_time_user=0.02,rlimit_file_locks_soft=2147483647i,pid=29417i,cpu_time_nice=0,rlimit_memory_locked_soft=65536i,read_count=259i,rlimit_memory_vms_hard=2147483647i,memory_swap=0i,rlimit_num_fds_soft=1024i,rlimit_nice_priority_hard=0i,cpu_time_soft_irq=0,cpu_time=0i,rlimit_memory_locked_hard=65536i,realtime_priority=0i,signals_pending=0i,nice_priority=20i,cpu_time_idle=0,memory_stack=139264i,memory_locked=0i,rlimit_memory_stack_soft=8388608i,cpu_time_iowait=0,cpu_time_guest=0,cpu_time_guest_nice=0,rlimit_memory_data_soft=2147483647i,read_bytes=0i,rlimit_cpu_time_soft=2147483647i,involuntary_context_switches=2i,write_bytes=106496i,cpu_time_system=0,cpu_time_irq=0,cpu_usage=0,memory_vms=21659648i,memory_data=1576960i,rlimit_memory_stack_hard=2147483647i,num_threads=1i,rlimit_memory_rss_soft=2147483647i,rlimit_realtime_priority_soft=0i,num_fds=4i,write_count=35i,rlimit_signals_pending_soft=78994i,cpu_time_steal=0,rlimit_num_fds_hard=4096i,rlimit_file_locks_hard=2147483647i,rlimit_cpu_time_hard=2147483647i,rlimit_signals_pending_hard=78994i,rlimit_nice_priority_soft=0i,rlimit_memory_rss_hard=2147483647i,rlimit_memory_vms_soft=2147483647i,rlimit_realtime_priority_hard=0i 1517620624000000000`),
-	expect: Point{
+	expect: TestPoint{
 		Measurement: "procstat",
 		Tags: []TagKeyValue{{
 			Key:   "exe",
@@ -1276,7 +1276,7 @@ func BenchmarkDecodeEntriesSkipping(b *testing.B) {
 			// Sanity check that the decoder is doing what we're expecting.
 			// Only check the first entry because checking them all is slow.
 			dec := NewDecoderWithBytes(data)
-			assertDecodeResult(c, dec, []Point{bench.expect}, true, errPositions{})
+			assertDecodeResult(c, dec, []TestPoint{bench.expect}, true, errPositions{})
 			b.ReportAllocs()
 			b.ResetTimer()
 			b.SetBytes(int64(len(data)))
@@ -1302,7 +1302,7 @@ func BenchmarkDecodeEntriesWithoutSkipping(b *testing.B) {
 			// Sanity check that the decoder is doing what we're expecting.
 			// Only check the first entry because checking them all is slow.
 			dec := NewDecoderWithBytes(data)
-			assertDecodeResult(c, dec, []Point{bench.expect}, true, errPositions{})
+			assertDecodeResult(c, dec, []TestPoint{bench.expect}, true, errPositions{})
 			b.ReportAllocs()
 			b.ResetTimer()
 			b.SetBytes(int64(len(data)))
@@ -1559,3 +1559,572 @@ func (g *tokenGenerator) token() []byte {
 	}
 	return data
 }
+
+func TestDecoderMaxLineSize(t *testing.T) {
+	c := qt.New(t)
+	longTag := strings.Repeat("a", 200)
+	text := "m1 f=1i\n" +
+		"# " + longTag + "\n" +
+		"m2,t=" + longTag + " f=2i\n" +
+		"m3 f=3i 1234\n" +
+		"m4 f=\"" + longTag + "\n" + longTag + "\"\n" +
+		"m5 f=5i\n" +
+		"m6 f=" + strings.Repeat("1", 200) + "\n" +
+		"m7 f=7i"
+	type result struct {
+		measurement string
+		line        int64
+		err         string
+	}
+	expect := []result{
+		{measurement: "m1"},
+		{line: 3, err: `at line 3:1: line-protocol entry too long \(maximum 100 bytes\)`},
+		{measurement: "m3"},
+		{line: 5, err: `at line 5:1: line-protocol entry too long \(maximum 100 bytes\)`},
+		// Note: the remainder of the string field is treated
+		// as a line of its own, and that's too long too.
+		{line: 6, err: `at line 6:1: line-protocol entry too long \(maximum 100 bytes\)`},
+		{measurement: "m5"},
+		{line: 8, err: `at line 8:1: line-protocol entry too long \(maximum 100 bytes\)`},
+		{measurement: "m7"},
+	}
+	for _, test := range decoderTakeTests {
+		if test.expectError != "" {
+			continue
+		}
+		c.Run(test.testName, func(c *qt.C) {
+			dec := test.newDecoder(text)
+			if dec.complete {
+				c.Skip("limit does not apply to byte slices")
+			}
+			dec.SetMaxLineSize(100)
+			var results []result
+			for dec.Next() {
+				m, err := dec.Measurement()
+				if err == nil {
+					for {
+						key, _, err1 := dec.NextField()
+						if err1 != nil {
+							err = err1
+							break
+						}
+						if key == nil {
+							break
+						}
+					}
+				}
+				if err == nil {
+					_, err = dec.Time(Nanosecond, time.Time{})
+				}
+				if err != nil {
+					var derr *DecodeError
+					c.Assert(errors.As(err, &derr), qt.IsTrue)
+					if strings.Contains(err.Error(), "too long") {
+						c.Assert(errors.Is(err, ErrLineTooLong), qt.IsTrue)
+					}
+					results = append(results, result{
+						line: derr.Line,
+						err:  err.Error(),
+					})
+					continue
+				}
+				results = append(results, result{
+					measurement: string(m),
+				})
+			}
+			c.Assert(dec.Err(), qt.IsNil)
+			c.Assert(results, qt.HasLen, len(expect))
+			for i, r := range results {
+				c.Check(r.measurement, qt.Equals, expect[i].measurement)
+				c.Check(r.line, qt.Equals, expect[i].line)
+				if expect[i].err == "" {
+					c.Check(r.err, qt.Equals, "")
+				} else {
+					c.Check(r.err, qt.Matches, expect[i].err)
+				}
+			}
+			c.Assert(cap(dec.buf) <= minGrow, qt.IsTrue, qt.Commentf("buffer capacity %d", cap(dec.buf)))
+		})
+	}
+}
+
+func TestDecodeErrorOffset(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range decoderTests {
+		c.Run(test.testName, func(c *qt.C) {
+			_, text := makeErrPositions(test.text)
+			readers := map[string]func() *Decoder{
+				"bytes": func() *Decoder {
+					return NewDecoderWithBytes([]byte(text))
+				},
+				"one-byte-reader": func() *Decoder {
+					return NewDecoder(iotest.OneByteReader(strings.NewReader(text)))
+				},
+			}
+			for name, newDecoder := range readers {
+				c.Run(name, func(c *qt.C) {
+					dec := newDecoder()
+					dec.SetErrorLineLength(1000)
+					for _, err := range decodeAllErrors(dec) {
+						var derr *DecodeError
+						c.Assert(errors.As(err, &derr), qt.IsTrue)
+						// Check that the offset is consistent with the
+						// line and column.
+						c.Assert(derr.Offset <= int64(len(text)), qt.IsTrue)
+						before := text[:derr.Offset]
+						c.Assert(int64(strings.Count(before, "\n")+1), qt.Equals, derr.Line)
+						lineStart := strings.LastIndexByte(before, '\n') + 1
+						c.Assert(int(derr.Offset)-lineStart+1, qt.Equals, derr.Column)
+						lineText := text[lineStart:]
+						if i := strings.IndexByte(lineText, '\n'); i >= 0 {
+							lineText = lineText[:i]
+						}
+						c.Assert(derr.LineText, qt.Equals, lineText)
+						c.Assert(derr.LineTextOffset, qt.Equals, 0)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestDecodeErrorLineText(t *testing.T) {
+	c := qt.New(t)
+	text := "m f=1\n" + "m,t=" + strings.Repeat("a", 100) + " f=x," + strings.Repeat("b", 100) + "=1\nm f=1\n"
+	dec := NewDecoderWithBytes([]byte(text))
+	errs := decodeAllErrors(dec)
+	c.Assert(errs, qt.HasLen, 1)
+	var derr *DecodeError
+	c.Assert(errors.As(errs[0], &derr), qt.IsTrue)
+	// No text by default.
+	c.Assert(derr.LineText, qt.Equals, "")
+	c.Assert(derr.Offset, qt.Equals, int64(len("m f=1\nm,t=")+100+len(" f=")))
+
+	for _, n := range []int{10, 11} {
+		dec = NewDecoderWithBytes([]byte(text))
+		dec.SetErrorLineLength(n)
+		errs = decodeAllErrors(dec)
+		c.Assert(errs, qt.HasLen, 1)
+		c.Assert(errors.As(errs[0], &derr), qt.IsTrue)
+		c.Assert(derr.LineText, qt.HasLen, n)
+		textOffset := derr.Column - 1 - derr.LineTextOffset
+		c.Assert(derr.LineText[textOffset:], qt.Matches, `x,b*`)
+		c.Assert(derr.LineText[:textOffset], qt.Matches, `a* f=`)
+	}
+
+	// A window at the end of the line.
+	dec = NewDecoderWithBytes([]byte("m " + strings.Repeat("f=1,", 10) + "g=x\n"))
+	dec.SetErrorLineLength(10)
+	errs = decodeAllErrors(dec)
+	c.Assert(errs, qt.HasLen, 1)
+	c.Assert(errors.As(errs[0], &derr), qt.IsTrue)
+	c.Assert(derr.LineText, qt.Equals, "=1,f=1,g=x")
+	c.Assert(derr.LineTextOffset, qt.Equals, 35)
+}
+
+// decodeAllErrors decodes all the entries in dec and
+// returns any errors encountered.
+func decodeAllErrors(dec *Decoder) []error {
+	var errs []error
+	for dec.Next() {
+		if _, err := dec.Measurement(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for {
+			key, _, err := dec.NextTag()
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if key == nil {
+				break
+			}
+		}
+		for {
+			key, _, err := dec.NextField()
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if key == nil {
+				break
+			}
+		}
+		if _, err := dec.Time(Nanosecond, time.Time{}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+var multipleErrorsTests = []struct {
+	testName     string
+	text         string
+	expectErrors [][]string
+}{{
+	testName: "no-errors",
+	text:     "m,t=1 f=1i 1\nm f=2\n",
+	expectErrors: [][]string{
+		nil,
+		nil,
+	},
+}, {
+	testName: "bad-tag-field-and-time",
+	text:     "m,t,u=1 f=x,g=1i,h=99999999999999999999i 12x\nm f=1\n",
+	expectErrors: [][]string{{
+		`at line 1:3: expected '=' after tag key "t", but got ',' instead`,
+		`at line 1:11: value for field "f" ("x") has unrecognized type`,
+		`at line 1:20: cannot parse value for field key "h": line-protocol value out of range`,
+		`at line 1:42: invalid timestamp ("12x")`,
+	}, nil},
+}, {
+	testName: "bad-measurement",
+	text:     "\x01m,t=1 f=1,g=\n",
+	expectErrors: [][]string{{
+		`at line 1:1: invalid character '\x01' found at start of measurement name`,
+		`at line 1:14: value for field "g" ("") has unrecognized type`,
+	}},
+}, {
+	testName: "multiple-bad-tags",
+	text:     "m,a,b=,c=1,=d f=1\n",
+	expectErrors: [][]string{{
+		`at line 1:3: expected '=' after tag key "a", but got ',' instead`,
+		`at line 1:7: expected tag value after tag key "b", but none found`,
+		`at line 1:12: empty tag key`,
+	}},
+}, {
+	testName: "empty-fields",
+	text:     "m f=1,,g=\"x\"y,h=2\nm f=1\n",
+	expectErrors: [][]string{{
+		`at line 1:7: invalid character ',' found at start of field key`,
+		`at line 1:13: unexpected character 'y' after field "g"`,
+	}, nil},
+}, {
+	testName: "error-in-multiline-string-entry",
+	text:     "m f=\"a\nb\",g=x h\nm f=1\n",
+	expectErrors: [][]string{{
+		`at line 2:6: value for field "g" ("x") has unrecognized type`,
+		`at line 2:8: invalid timestamp ("h")`,
+	}, nil},
+}, {
+	testName: "bad-comment",
+	text:     "# \x01 comment, f=x\nm f=1\n",
+	expectErrors: [][]string{{
+		`at line 1:1: invalid character found in comment line`,
+	}, nil},
+}}
+
+func TestDecoderMultipleErrors(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range multipleErrorsTests {
+		c.Run(test.testName, func(c *qt.C) {
+			dec := NewDecoderWithBytes([]byte(test.text))
+			dec.SetMultipleErrors(true)
+			var allErrs [][]string
+			for dec.Next() {
+				var errs []string
+				for _, err := range dec.EntryErrors(Nanosecond) {
+					errs = append(errs, err.Error())
+				}
+				allErrs = append(allErrs, errs)
+			}
+			c.Assert(allErrs, qt.DeepEquals, test.expectErrors)
+		})
+	}
+}
+
+func TestDecoderMultipleErrorsWithDecoderTests(t *testing.T) {
+	c := qt.New(t)
+	// Check that the first error in each entry is always the
+	// same when multiple errors are enabled, and that
+	// the entries found are the same.
+	for _, test := range decoderTests {
+		c.Run(test.testName, func(c *qt.C) {
+			_, text := makeErrPositions(test.text)
+			dec := NewDecoderWithBytes([]byte(text))
+			multiDec := NewDecoderWithBytes([]byte(text))
+			multiDec.SetMultipleErrors(true)
+			for dec.Next() {
+				c.Assert(multiDec.Next(), qt.IsTrue)
+				errs := dec.EntryErrors(Nanosecond)
+				multiErrs := multiDec.EntryErrors(Nanosecond)
+				c.Assert(len(errs) <= 1, qt.IsTrue)
+				if len(errs) == 0 {
+					continue
+				}
+				c.Assert(multiErrs, qt.Not(qt.HasLen), 0)
+				c.Assert(multiErrs[0].Error(), qt.Equals, errs[0].Error())
+				c.Assert(multiErrs[0].Offset, qt.Equals, errs[0].Offset)
+			}
+			c.Assert(multiDec.Next(), qt.IsFalse)
+		})
+	}
+}
+
+func TestDecoderMultipleErrorsWithDecodePoint(t *testing.T) {
+	c := qt.New(t)
+	// When Next is called after an error, the rest of the
+	// entry is skipped even when multiple errors are enabled.
+	dec := NewDecoderWithBytes([]byte("m,t f=1,g=x 1\nn f=2i 2\n"))
+	dec.SetMultipleErrors(true)
+	var p Point
+	c.Assert(dec.Next(), qt.IsTrue)
+	c.Assert(dec.DecodePoint(&p, Nanosecond, time.Time{}), qt.ErrorMatches, `at line 1:3: expected '=' after tag key "t", but got ' ' instead`)
+	c.Assert(dec.Next(), qt.IsTrue)
+	c.Assert(dec.DecodePoint(&p, Nanosecond, time.Time{}), qt.IsNil)
+	c.Assert(string(p.Measurement), qt.Equals, "n")
+	c.Assert(dec.Next(), qt.IsFalse)
+}
+
+func TestDecoderComments(t *testing.T) {
+	c := qt.New(t)
+	text := "# first\n" +
+		"m1 f=1i\n" +
+		"\n" +
+		"   #\r\n" +
+		"#" + strings.Repeat("a", 200) + "\n" +
+		"# bad\x01comment\n" +
+		"m2 f=2i\n" +
+		"#last"
+	type result struct {
+		comment     string
+		measurement string
+		err         string
+	}
+	expect := []result{
+		{comment: " first"},
+		{measurement: "m1"},
+		{comment: ""},
+		{err: `at line 5:1: line-protocol entry too long \(maximum 100 bytes\)`},
+		{err: `at line 6:1: invalid character found in comment line`},
+		{measurement: "m2"},
+		{comment: "last"},
+	}
+	for _, test := range decoderTakeTests {
+		if test.expectError != "" {
+			continue
+		}
+		c.Run(test.testName, func(c *qt.C) {
+			dec := test.newDecoder(text)
+			dec.SetComments(true)
+			limit := !dec.complete
+			if limit {
+				dec.SetMaxLineSize(100)
+			}
+			var results []result
+			for dec.Next() {
+				if comment := dec.Comment(); comment != nil {
+					results = append(results, result{
+						comment: string(comment),
+					})
+					// Other methods return nothing for a comment.
+					m, err := dec.Measurement()
+					c.Assert(err, qt.IsNil)
+					c.Assert(m, qt.IsNil)
+					continue
+				}
+				m, err := dec.Measurement()
+				if err != nil {
+					results = append(results, result{
+						err: err.Error(),
+					})
+					continue
+				}
+				results = append(results, result{
+					measurement: string(m),
+				})
+			}
+			c.Assert(dec.Err(), qt.IsNil)
+			expect := expect
+			if !limit {
+				expect = append(append(expect[:3:3], result{
+					comment: strings.Repeat("a", 200),
+				}), expect[4:]...)
+			}
+			c.Assert(results, qt.HasLen, len(expect))
+			for i, r := range results {
+				c.Check(r.comment, qt.Equals, expect[i].comment)
+				c.Check(r.measurement, qt.Equals, expect[i].measurement)
+				if expect[i].err == "" {
+					c.Check(r.err, qt.Equals, "")
+				} else {
+					c.Check(r.err, qt.Matches, expect[i].err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecoderCommentsDisabled(t *testing.T) {
+	c := qt.New(t)
+	dec := NewDecoderWithBytes([]byte("# comment\nm f=1\n"))
+	c.Assert(dec.Next(), qt.IsTrue)
+	c.Assert(dec.Comment(), qt.IsNil)
+	m, err := dec.Measurement()
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(m), qt.Equals, "m")
+	c.Assert(dec.Next(), qt.IsFalse)
+}
+
+func TestDecoderRawLine(t *testing.T) {
+	c := qt.New(t)
+	longTag := strings.Repeat("a", 200)
+	text := "m1,t\\ a=x f=1i 1234\n" +
+		"\n" +
+		"  m2 f=\"a\nb\"  \r\n" +
+		"# comment\n" +
+		"m3 f=x 1\n" +
+		"m4,t=" + longTag + " f=2i\n" +
+		"m5 f=1,g=2"
+	type result struct {
+		Raw  string
+		Line int64
+	}
+	expect := []result{
+		{Raw: "m1,t\\ a=x f=1i 1234", Line: 1},
+		{Raw: "m2 f=\"a\nb\"  ", Line: 3},
+		{Raw: "# comment", Line: 5},
+		{Raw: "m3 f=x 1", Line: 6},
+		{Raw: "m4,t=" + longTag + " f=2i", Line: 7},
+		{Raw: "m5 f=1,g=2", Line: 8},
+	}
+	for _, test := range decoderTakeTests {
+		if test.expectError != "" {
+			continue
+		}
+		c.Run(test.testName, func(c *qt.C) {
+			dec := test.newDecoder(text)
+			dec.SetComments(true)
+			limit := !dec.complete
+			if limit {
+				dec.SetMaxLineSize(100)
+			}
+			var results []result
+			for i := 0; dec.Next(); i++ {
+				// Decode varying amounts of the entry first.
+				switch i % 3 {
+				case 1:
+					dec.Measurement()
+				case 2:
+					dec.NextField()
+				}
+				results = append(results, result{
+					Raw:  string(dec.RawLine()),
+					Line: dec.EntryLine(),
+				})
+				// The rest of the entry has been consumed.
+				key, _, err := dec.NextField()
+				c.Assert(err, qt.IsNil)
+				c.Assert(key, qt.IsNil)
+			}
+			c.Assert(dec.Err(), qt.IsNil)
+			expect := expect
+			if limit {
+				// The entry is too long, so its text has been discarded.
+				expect = append([]result(nil), expect...)
+				expect[4].Raw = ""
+			}
+			c.Assert(results, qt.DeepEquals, expect)
+		})
+	}
+}
+
+var rawLineTooLongTests = []struct {
+	testName string
+	comments bool
+	data     string
+	expect   []string
+}{{
+	testName: "no-comments",
+	data:     "m1 f=1\nm2,t=" + strings.Repeat("a", 200) + " f=2i\nm3 f=1\n",
+	expect:   []string{"m1 f=1", "", "m3 f=1"},
+}, {
+	testName: "comments",
+	comments: true,
+	data:     "m1 f=1\nm2,t=" + strings.Repeat("a", 200) + " f=2i\nm3 f=1\n",
+	expect:   []string{"m1 f=1", "", "m3 f=1"},
+}, {
+	testName: "long-comment",
+	comments: true,
+	data:     "# a\n# " + strings.Repeat("a", 200) + "\nm3 f=1",
+	expect:   []string{"# a", "", "m3 f=1"},
+}}
+
+func TestDecoderRawLineTooLong(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range rawLineTooLongTests {
+		c.Run(test.testName, func(c *qt.C) {
+			dec := NewDecoder(strings.NewReader(test.data))
+			dec.SetComments(test.comments)
+			dec.SetMaxLineSize(100)
+			var lines []string
+			for dec.Next() {
+				line := dec.RawLine()
+				if len(line) == 0 {
+					// The text of an entry that's too long
+					// isn't available.
+					c.Assert(line, qt.IsNil)
+				}
+				lines = append(lines, string(line))
+			}
+			c.Assert(dec.Err(), qt.IsNil)
+			c.Assert(lines, qt.DeepEquals, test.expect)
+		})
+	}
+}
+
+func TestDecoderReset(t *testing.T) {
+	c := qt.New(t)
+	measurements := func(dec *Decoder) []string {
+		var ms []string
+		for dec.Next() {
+			m, err := dec.Measurement()
+			if err != nil {
+				ms = append(ms, err.Error())
+				continue
+			}
+			ms = append(ms, string(m))
+		}
+		c.Assert(dec.Err(), qt.IsNil)
+		return ms
+	}
+	dec := NewDecoder(strings.NewReader("m1 f=1\nm2 f=2\n"))
+	dec.SetMaxLineSize(20)
+	c.Assert(measurements(dec), qt.DeepEquals, []string{"m1", "m2"})
+	buf := dec.buf[:1]
+
+	// The buffer is reused and the settings are retained.
+	dec.Reset(strings.NewReader("m3 f=3\n,x f=1\nm4" + strings.Repeat("a", 30) + " f=1\n"))
+	c.Assert(measurements(dec), qt.DeepEquals, []string{
+		"m3",
+		`at line 2:1: invalid character ',' found at start of measurement name`,
+		"at line 3:1: line-protocol entry too long (maximum 20 bytes)",
+	})
+	c.Assert(&dec.buf[:1][0], qt.Equals, &buf[0])
+
+	// The caller's buffer is used by ResetBytes
+	// but is not reused by Reset.
+	data := []byte("m5 f=5\n")
+	dec.ResetBytes(data)
+	c.Assert(measurements(dec), qt.DeepEquals, []string{"m5"})
+	dec.Reset(strings.NewReader("m6 f=6\n"))
+	c.Assert(measurements(dec), qt.DeepEquals, []string{"m6"})
+	c.Assert(string(data), qt.Equals, "m5 f=5\n")
+}
+
+func TestDecoderResetDiscardsLargeBuffers(t *testing.T) {
+	c := qt.New(t)
+	dec := NewDecoder(strings.NewReader("m f=\"" + strings.Repeat("a", maxRetainedBuf*2) + "\"\n"))
+	c.Assert(dec.Next(), qt.IsTrue)
+	_, val, err := dec.NextField()
+	c.Assert(err, qt.IsNil)
+	c.Assert(val.StringV(), qt.HasLen, maxRetainedBuf*2)
+	c.Assert(cap(dec.buf) > maxRetainedBuf, qt.IsTrue)
+
+	dec.Reset(strings.NewReader("m f=1\n"))
+	c.Assert(cap(dec.buf), qt.Equals, 0)
+	c.Assert(cap(dec.escBuf), qt.Equals, initialEscBuf)
+	c.Assert(dec.Next(), qt.IsTrue)
+	m, err := dec.Measurement()
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(m), qt.Equals, "m")
+}
@@ -25,6 +25,8 @@ import (
 //	AddField (one or more times)
 //	EndLine (optional)
 //
+// AddComment may be called between entries to add a comment line.
+//
 // When an error is encountered encoding a point,
 // the Err method returns it, and the erroneous point
 // is omitted from the result.
@@ -43,13 +45,26 @@ type Encoder struct {
 	// on the current entry, in which case, no further data will be added
 	// until the next entry.
 	lineHasError bool
-	// err holds the most recent error encountered when encoding.
+	// err holds the first error encountered when encoding.
 	err error
+	// collectErrors holds whether all errors are
+	// recorded in the errors field.
+	collectErrors bool
+	// errors holds the errors encountered, one per omitted
+	// entry, when collectErrors is true.
+	errors []*EncodeError
 	// pointIndex holds the index of the current point being encoded.
 	pointIndex int
 	// precisionMultiplier holds the timestamp precision.
 	// Timestamps are divided by this when encoded.
 	precisionMultiplier int64
+	// sortedTags is used by EncodePoint to hold tags
+	// when they need sorting.
+	sortedTags []Tag
+	// stream holds the StreamEncoder that this Encoder is
+	// part of, if any. It is notified whenever an entry
+	// is completed.
+	stream *StreamEncoder
 }
 
 // Bytes returns the current line buffer.
@@ -66,6 +81,9 @@ func (e *Encoder) SetBuffer(buf []byte) {
 	e.pointIndex = 0
 	e.ClearErr()
 	e.section = measurementSection
+	if e.stream != nil {
+		e.stream.lines = 0
+	}
 }
 
 // SetPrecision sets the precision used to encode the time stamps
@@ -95,15 +113,38 @@ func (e *Encoder) SetLax(lax bool) {
 }
 
 // Err returns the first encoding error that's been encountered so far,
-// if any.
-// TODO define a type so that we can get access to the line where it happened.
+// if any. The error is always of type *EncodeError.
 func (e *Encoder) Err() error {
 	return e.err
 }
 
-// ClearErr clears any current encoding error.
+// ClearErr clears any current encoding error, including
+// any errors collected when SetCollectErrors has been enabled.
 func (e *Encoder) ClearErr() {
 	e.err = nil
+	e.errors = e.errors[:0]
+}
+
+// SetCollectErrors sets whether the Encoder records every
+// entry that fails to encode rather than only the first.
+// When it's enabled, the Errors method returns all the
+// recorded errors, one for each rejected entry.
+func (e *Encoder) SetCollectErrors(collect bool) {
+	e.collectErrors = collect
+}
+
+// Errors returns the errors that have been encountered
+// since the errors were last cleared, one for each entry that
+// was omitted. It always returns nil unless SetCollectErrors(true)
+// has been called.
+//
+// The returned slice is only valid until ClearErr
+// (or SetBuffer or Reset) is called.
+func (e *Encoder) Errors() []*EncodeError {
+	if len(e.errors) == 0 {
+		return nil
+	}
+	return e.errors
 }
 
 // StartLine starts writing a line with the given measurement name. If this
@@ -113,25 +154,31 @@ func (e *Encoder) ClearErr() {
 // Starting a new entry is always allowed when there's been an error
 // encoding the previous entry.
 func (e *Encoder) StartLine(measurement string) {
+	if e.stream != nil && e.section == fieldSection {
+		// Terminate the previous entry explicitly so that
+		// the stream can flush it as a complete line.
+		e.EndLine(time.Time{})
+	}
 	section := e.section
-	e.pointIndex++
-	e.section = tagSection
 	if section == tagSection {
 		// This error is unusual, because it indicates an error on the previous
 		// line, even though there's probably not an error on this line, so
-		// don't return here. This means that unfortunately, if you
+		// it's attributed to the fields of the previous entry and
+		// we don't return here. This means that unfortunately, if you
 		// add a line with an invalid measurement immediately after
 		// adding a line with no fields, you won't ever see the second
 		// of those two errors. Clients can avoid that possibility by making
 		// sure to call EndLine even if they don't wish to add a timestamp.
-		e.setErrorf("cannot start line without adding at least one field to previous line")
+		e.setErrorf(EncodeField, "", "cannot start line without adding at least one field to previous line")
 	}
+	e.pointIndex++
+	e.section = tagSection
 	e.prevTagKey = e.prevTagKey[:0]
 	e.lineStart = len(e.buf)
 	e.lineHasError = false
 	if !e.lax {
 		if !validMeasurementOrKey(measurement) {
-			e.setErrorf("invalid measurement %q", measurement)
+			e.setErrorf(EncodeMeasurement, "", "invalid measurement %q", measurement)
 			return
 		}
 	}
@@ -156,35 +203,66 @@ func (e *Encoder) StartLineRaw(name []byte) {
 // characters (0x00 to 0x1f and 0x7f) or invalid UTF-8 or
 // a trailing backslash character.
 func (e *Encoder) AddTag(key, value string) {
-	if e.section != tagSection {
-		e.setErrorf("tag must be added after adding a measurement and before adding fields")
+	if !e.startTag(key, value, true) {
 		return
 	}
+	e.buf = append(e.buf, ',')
+	e.buf = tagKeyEscapes.appendEscaped(e.buf, key)
+	e.buf = append(e.buf, '=')
+	e.buf = tagValEscapes.appendEscaped(e.buf, value)
+}
+
+// AddTagPreEscaped is like AddTag except that the key must
+// already be escaped, and it's added as is without being checked.
+// The value is checked and escaped as usual.
+// The caller is responsible for making sure that the key is valid and
+// that tags are added in lexical order of their unescaped keys.
+//
+// This is intended for code that knows its tag keys in advance,
+// such as the code generated by the lpgen command, and avoids
+// checking and escaping the keys each time they're used.
+func (e *Encoder) AddTagPreEscaped(key, value string) {
+	if !e.startTag(key, value, false) {
+		return
+	}
+	e.buf = append(e.buf, ',')
+	e.buf = append(e.buf, key...)
+	e.buf = append(e.buf, '=')
+	e.buf = tagValEscapes.appendEscaped(e.buf, value)
+}
+
+// startTag checks whether a tag can be added to the current line,
+// and reports whether it should be. If checkKey is false, the key
+// is assumed to be escaped and isn't checked for validity or order,
+// but it's still recorded so that later tags are checked against it.
+func (e *Encoder) startTag(key, value string, checkKey bool) bool {
+	if e.section != tagSection {
+		e.setErrorf(EncodeTag, key, "tag must be added after adding a measurement and before adding fields")
+		return false
+	}
 	if !e.lax {
-		if !validMeasurementOrKey(key) {
-			e.setErrorf("invalid tag key %q", key)
-			return
+		if checkKey && !validMeasurementOrKey(key) {
+			e.setErrorf(EncodeTag, key, "invalid tag key %q", key)
+			return false
 		}
 		if !validMeasurementOrKey(value) {
-			e.setErrorf("invalid tag value %s=%q", key, value)
-			return
+			e.setErrorf(EncodeTag, key, "invalid tag value %s=%q", key, value)
+			return false
 		}
-		if key <= string(e.prevTagKey) {
-			e.setErrorf("tag key %q out of order (previous key %q)", key, e.prevTagKey)
-			return
+		if checkKey {
+			if key <= string(e.prevTagKey) {
+				e.setErrorf(EncodeTag, key, "tag key %q out of order (previous key %q)", key, e.prevTagKey)
+				return false
+			}
+			// We need to copy the tag key because AddTag can be called
+			// by AddTagRaw with a slice of byte which might change from
+			// call to call.
+			e.prevTagKey = append(e.prevTagKey[:0], key...)
+		} else {
+			e.prevTagKey = tagKeyEscapes.appendUnescaped(e.prevTagKey[:0], key)
 		}
-		// We need to copy the tag key because AddTag can be called
-		// by AddTagRaw with a slice of byte which might change from
-		// call to call.
-		e.prevTagKey = append(e.prevTagKey[:0], key...)
 	}
-	if e.lineHasError {
-		return
-	}
-	e.buf = append(e.buf, ',')
-	e.buf = tagKeyEscapes.appendEscaped(e.buf, key)
-	e.buf = append(e.buf, '=')
-	e.buf = tagValEscapes.appendEscaped(e.buf, value)
+	return !e.lineHasError
 }
 
 // AddTagRaw is like AddTag except that it accepts byte slices
@@ -198,29 +276,51 @@ func (e *Encoder) AddTagRaw(key, value []byte) {
 // AddField adds a field to the line. AddField must be called after AddTag
 // or AddMeasurement. At least one field must be added to each line.
 func (e *Encoder) AddField(key string, value Value) {
-	if e.section != fieldSection && e.section != tagSection {
-		e.setErrorf("field must be added after tag or measurement section")
+	if !e.startField(key, true) {
 		return
 	}
+	e.buf = fieldKeyEscapes.appendEscaped(e.buf, key)
+	e.buf = append(e.buf, '=')
+	e.buf = value.AppendBytes(e.buf)
+}
+
+// AddFieldPreEscaped is like AddField except that the key must
+// already be escaped, and it's added as is without being checked.
+// See AddTagPreEscaped.
+func (e *Encoder) AddFieldPreEscaped(key string, value Value) {
+	if !e.startField(key, false) {
+		return
+	}
+	e.buf = append(e.buf, key...)
+	e.buf = append(e.buf, '=')
+	e.buf = value.AppendBytes(e.buf)
+}
+
+// startField checks whether a field can be added to the current line
+// and, if so, adds the separator before it and returns true.
+// If checkKey is false, the key isn't checked for validity.
+func (e *Encoder) startField(key string, checkKey bool) bool {
+	if e.section != fieldSection && e.section != tagSection {
+		e.setErrorf(EncodeField, key, "field must be added after tag or measurement section")
+		return false
+	}
 	section := e.section
 	e.section = fieldSection
-	if !e.lax {
+	if checkKey && !e.lax {
 		if !validMeasurementOrKey(key) {
-			e.setErrorf("invalid field key %q", key)
-			return
+			e.setErrorf(EncodeField, key, "invalid field key %q", key)
+			return false
 		}
 	}
 	if e.lineHasError {
-		return
+		return false
 	}
 	if section == tagSection {
 		e.buf = append(e.buf, ' ')
 	} else {
 		e.buf = append(e.buf, ',')
 	}
-	e.buf = fieldKeyEscapes.appendEscaped(e.buf, key)
-	e.buf = append(e.buf, '=')
-	e.buf = value.AppendBytes(e.buf)
+	return true
 }
 
 // AddFieldRaw is like AddField except that the key is represented
@@ -233,6 +333,33 @@ func (e *Encoder) AddFieldRaw(key []byte, value Value) {
 	e.AddField(unsafeBytesToString(key), value)
 }
 
+// AddComment adds a comment line holding the given text, which
+// will be preceded by a # character. It must be called between
+// entries: if the current entry has fields but hasn't been ended,
+// it's ended without a timestamp first.
+//
+// The text may not contain non-printable ASCII characters
+// (0x00 to 0x1f and 0x7f), including newlines, or invalid UTF-8.
+func (e *Encoder) AddComment(text string) {
+	switch e.section {
+	case tagSection:
+		e.setErrorf(EncodeComment, "", "cannot add comment without adding at least one field to previous line")
+	case fieldSection:
+		e.EndLine(time.Time{})
+	}
+	e.section = endSection
+	e.lineStart = len(e.buf)
+	e.lineHasError = false
+	if !e.lax && !validComment(text) {
+		e.setErrorf(EncodeComment, "", "invalid comment %q", text)
+		return
+	}
+	e.buf = append(e.buf, '#')
+	e.buf = append(e.buf, text...)
+	e.buf = append(e.buf, '\n')
+	e.lineEnded()
+}
+
 var (
 	minTime = time.Unix(0, math.MinInt64)
 	maxTime = time.Unix(0, math.MaxInt64)
@@ -244,7 +371,7 @@ var (
 // an ErrRange error will be returned.
 func (e *Encoder) EndLine(t time.Time) {
 	if e.section != fieldSection {
-		e.setErrorf("timestamp must be added after adding at least one field")
+		e.setErrorf(EncodeTime, "", "timestamp must be added after adding at least one field")
 		return
 	}
 	e.section = endSection
@@ -252,11 +379,12 @@ func (e *Encoder) EndLine(t time.Time) {
 		// Zero timestamp. All we need is a newline.
 		if !e.lineHasError {
 			e.buf = append(e.buf, '\n')
+			e.lineEnded()
 		}
 		return
 	}
 	if t.Before(minTime) || t.After(maxTime) {
-		e.setErrorf("timestamp %s: %w", t.Format(time.RFC3339), ErrValueOutOfRange)
+		e.setErrorf(EncodeTime, "", "timestamp %s: %w", t.Format(time.RFC3339), ErrValueOutOfRange)
 		return
 	}
 	if e.lineHasError {
@@ -269,15 +397,37 @@ func (e *Encoder) EndLine(t time.Time) {
 	}
 	e.buf = strconv.AppendInt(e.buf, timestamp, 10)
 	e.buf = append(e.buf, '\n')
+	e.lineEnded()
 }
 
-func (e *Encoder) setErrorf(format string, arg ...interface{}) {
+// lineEnded is called when an entry has been
+// successfully completed.
+func (e *Encoder) lineEnded() {
+	if e.stream != nil {
+		e.stream.lineEnded()
+	}
+}
+
+func (e *Encoder) setErrorf(section EncodeSection, key string, format string, arg ...interface{}) {
+	firstOnLine := !e.lineHasError
 	e.lineHasError = true
-	if e.err == nil {
-		if e.pointIndex <= 1 {
-			e.err = fmt.Errorf(format, arg...)
-		} else {
-			e.err = fmt.Errorf("encoding point %d: %w", e.pointIndex-1, fmt.Errorf(format, arg...))
+	if e.err == nil || (e.collectErrors && firstOnLine) {
+		err := &EncodeError{
+			PointIndex: e.pointIndex - 1,
+			Section:    section,
+			// Copy the key because it might refer to
+			// a byte slice passed to AddTagRaw or AddFieldRaw.
+			Key: string(append([]byte(nil), key...)),
+			Err: fmt.Errorf(format, arg...),
+		}
+		if err.PointIndex < 0 {
+			err.PointIndex = 0
+		}
+		if e.err == nil {
+			e.err = err
+		}
+		if e.collectErrors {
+			e.errors = append(e.errors, err)
 		}
 	}
 	// Remove the partially encoded part of the current line.
@@ -288,6 +438,70 @@ func (e *Encoder) setErrorf(format string, arg ...interface{}) {
 	}
 }
 
+// EncodeSection identifies the part of an entry
+// that was being encoded when an error occurred.
+type EncodeSection int
+
+const (
+	// EncodeMeasurement is the measurement name.
+	EncodeMeasurement EncodeSection = iota
+	// EncodeTag is the tag section.
+	EncodeTag
+	// EncodeField is the field section.
+	EncodeField
+	// EncodeTime is the timestamp.
+	EncodeTime
+	// EncodeComment is a comment line.
+	EncodeComment
+)
+
+// String implements fmt.Stringer.
+func (s EncodeSection) String() string {
+	switch s {
+	case EncodeMeasurement:
+		return "measurement"
+	case EncodeTag:
+		return "tag"
+	case EncodeField:
+		return "field"
+	case EncodeTime:
+		return "time"
+	case EncodeComment:
+		return "comment"
+	}
+	return fmt.Sprintf("EncodeSection(%d)", int(s))
+}
+
+// EncodeError represents an error encountered when encoding a
+// line-protocol entry.
+type EncodeError struct {
+	// PointIndex holds the zero-based index of the entry
+	// that the error was encountered on, counting from
+	// when the Encoder's buffer was last set.
+	PointIndex int
+	// Section holds the part of the entry that was being encoded.
+	Section EncodeSection
+	// Key holds the tag or field key that was being encoded,
+	// if any.
+	Key string
+	// Err holds the underlying error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *EncodeError) Error() string {
+	if e.PointIndex == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("encoding point %d: %v", e.PointIndex, e.Err)
+}
+
+// Unwrap implements error unwrapping so that the underlying
+// error can be retrieved.
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
 // validMeasurementOrKey reports whether s can be
 // encoded as a valid measurement or key.
 func validMeasurementOrKey(s string) bool {
@@ -309,3 +523,17 @@ func validMeasurementOrKey(s string) bool {
 	}
 	return true
 }
+
+// validComment reports whether s can be encoded
+// as the text of a comment.
+func validComment(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if nonPrintable.get(s[i]) {
+			return false
+		}
+	}
+	return true
+}
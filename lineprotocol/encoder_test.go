@@ -1,6 +1,7 @@
 package lineprotocol
 
 import (
+	"errors"
 	"sort"
 	"testing"
 	"time"
@@ -19,7 +20,7 @@ func TestEncoderWithDecoderTests(t *testing.T) {
 			c.Run(test.testName, func(c *qt.C) {
 				// Always use sorted tags even though they might not
 				// be sorted in the test case.
-				points := append([]Point(nil), test.expect...)
+				points := append([]TestPoint(nil), test.expect...)
 				for i := range points {
 					points[i] = pointWithSortedTags(points[i])
 				}
@@ -108,6 +109,58 @@ func TestEncoderEndLineWithNoTime(t *testing.T) {
 	c.Assert(string(e.Bytes()), qt.Equals, "m f=3i\n")
 }
 
+func TestEncoderAddComment(t *testing.T) {
+	c := qt.New(t)
+	var e Encoder
+	e.AddComment(" first")
+	e.StartLine("m")
+	e.AddField("f", MustNewValue(int64(1)))
+	// The entry is ended implicitly.
+	e.AddComment("")
+	e.StartLine("m")
+	e.AddField("f", MustNewValue(int64(2)))
+	e.EndLine(time.Unix(0, 1))
+	e.AddComment("last")
+	c.Assert(e.Err(), qt.IsNil)
+	c.Assert(string(e.Bytes()), qt.Equals, "# first\nm f=1i\n#\nm f=2i 1\n#last\n")
+
+	// Check that the result round-trips.
+	dec := NewDecoderWithBytes(e.Bytes())
+	dec.SetComments(true)
+	var comments []string
+	for dec.Next() {
+		if comment := dec.Comment(); comment != nil {
+			comments = append(comments, string(comment))
+		}
+	}
+	c.Assert(comments, qt.DeepEquals, []string{" first", "", "last"})
+}
+
+func TestEncoderAddInvalidComment(t *testing.T) {
+	c := qt.New(t)
+	var e Encoder
+	e.StartLine("m")
+	e.AddField("f", MustNewValue(int64(1)))
+	e.AddComment("a\nb")
+	c.Assert(e.Err(), qt.ErrorMatches, `invalid comment "a\\nb"`)
+	var eerr *EncodeError
+	c.Assert(errors.As(e.Err(), &eerr), qt.IsTrue)
+	c.Assert(eerr.Section, qt.Equals, EncodeComment)
+	e.StartLine("n")
+	e.AddField("f", MustNewValue(int64(2)))
+	e.EndLine(time.Time{})
+	c.Assert(string(e.Bytes()), qt.Equals, "m f=1i\nn f=2i\n")
+}
+
+func TestEncoderAddCommentWithNoFieldsOnPreviousLine(t *testing.T) {
+	c := qt.New(t)
+	var e Encoder
+	e.StartLine("m")
+	e.AddComment("x")
+	c.Assert(e.Err(), qt.ErrorMatches, `cannot add comment without adding at least one field to previous line`)
+	c.Assert(string(e.Bytes()), qt.Equals, "#x\n")
+}
+
 func TestEncoderAddTagBeforeStartLine(t *testing.T) {
 	c := qt.New(t)
 	var e Encoder
@@ -124,12 +177,51 @@ func TestEncoderAddTagAfterAddField(t *testing.T) {
 	c.Assert(e.Err(), qt.ErrorMatches, `tag must be added after adding a measurement and before adding fields`)
 }
 
+func TestEncoderPreEscapedKeys(t *testing.T) {
+	c := qt.New(t)
+	var e Encoder
+	e.StartLine("m")
+	e.AddTagPreEscaped(`a\ b`, "x y")
+	e.AddTag("c", "z")
+	e.AddFieldPreEscaped(`f\=1`, MustNewValue(int64(1)))
+	e.AddField("g", MustNewValue(true))
+	e.EndLine(time.Time{})
+	c.Assert(e.Err(), qt.IsNil)
+	c.Assert(string(e.Bytes()), qt.Equals, `m,a\ b=x\ y,c=z f\=1=1i,g=true`+"\n")
+
+	// Tag values are still checked.
+	e.Reset()
+	e.StartLine("m")
+	e.AddTagPreEscaped("a", "")
+	c.Assert(e.Err(), qt.ErrorMatches, `invalid tag value a=""`)
+
+	// The section is still checked.
+	e.Reset()
+	e.StartLine("m")
+	e.AddFieldPreEscaped("f", MustNewValue(int64(1)))
+	e.AddTagPreEscaped("a", "b")
+	c.Assert(e.Err(), qt.ErrorMatches, `tag must be added after adding a measurement and before adding fields`)
+
+	// Later tags are checked for order against the unescaped
+	// form of a pre-escaped key.
+	e.Reset()
+	e.StartLine("m")
+	e.AddTagPreEscaped(`b\ c`, "x")
+	e.AddTag("b c", "y")
+	c.Assert(e.Err(), qt.ErrorMatches, `tag key "b c" out of order \(previous key "b c"\)`)
+}
+
 func TestEncoderStartLineWithNoFieldsOnPreviousLine(t *testing.T) {
 	c := qt.New(t)
 	var e Encoder
 	e.StartLine("m")
 	e.StartLine("n")
-	c.Assert(e.Err(), qt.ErrorMatches, `encoding point 1: cannot start line without adding at least one field to previous line`)
+	c.Assert(e.Err(), qt.ErrorMatches, `cannot start line without adding at least one field to previous line`)
+	// The error is attributed to the previous entry.
+	var eerr *EncodeError
+	c.Assert(errors.As(e.Err(), &eerr), qt.IsTrue)
+	c.Assert(eerr.PointIndex, qt.Equals, 0)
+	c.Assert(eerr.Section, qt.Equals, EncodeField)
 }
 
 func TestEncoderStartLineWithInvalidMeasurementAndNoFieldsOnPreviousLine(t *testing.T) {
@@ -137,7 +229,7 @@ func TestEncoderStartLineWithInvalidMeasurementAndNoFieldsOnPreviousLine(t *test
 	var e Encoder
 	e.StartLine("m")
 	e.StartLine("")
-	c.Assert(e.Err(), qt.ErrorMatches, `encoding point 1: cannot start line without adding at least one field to previous line`)
+	c.Assert(e.Err(), qt.ErrorMatches, `cannot start line without adding at least one field to previous line`)
 
 	// The current line is now in error state, so fields won't be added.
 	e.AddField("f", MustNewValue(int64(1)))
@@ -168,11 +260,11 @@ func TestEncoderWithPrecision(t *testing.T) {
 
 var encoderDataErrorTests = []struct {
 	testName    string
-	point       Point
+	point       TestPoint
 	expectError string
 }{{
 	testName: "EmptyMeasurement",
-	point: Point{
+	point: TestPoint{
 		Measurement: "",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -182,7 +274,7 @@ var encoderDataErrorTests = []struct {
 	expectError: `invalid measurement ""`,
 }, {
 	testName: "NonPrintableMeasurement",
-	point: Point{
+	point: TestPoint{
 		Measurement: "\x01",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -192,7 +284,7 @@ var encoderDataErrorTests = []struct {
 	expectError: `invalid measurement "\\x01"`,
 }, {
 	testName: "NonUTF8Measurement",
-	point: Point{
+	point: TestPoint{
 		Measurement: "\xff",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -202,7 +294,7 @@ var encoderDataErrorTests = []struct {
 	expectError: `invalid measurement "\\xff"`,
 }, {
 	testName: "MeasurementWithTrailingBackslash",
-	point: Point{
+	point: TestPoint{
 		Measurement: "x\\",
 		Fields: []FieldKeyValue{{
 			Key:   "f",
@@ -212,7 +304,7 @@ var encoderDataErrorTests = []struct {
 	expectError: `invalid measurement "x\\\\"`,
 }, {
 	testName: "InvalidTagKey",
-	point: Point{
+	point: TestPoint{
 		Measurement: "m",
 		Tags: []TagKeyValue{{
 			Key:   "",
@@ -229,7 +321,7 @@ var encoderDataErrorTests = []struct {
 	expectError: `invalid tag key ""`,
 }, {
 	testName: "InvalidTagValue",
-	point: Point{
+	point: TestPoint{
 		Measurement: "m",
 		Tags: []TagKeyValue{{
 			Key:   "x",
@@ -243,7 +335,7 @@ var encoderDataErrorTests = []struct {
 	expectError: `invalid tag value x=""`,
 }, {
 	testName: "OutOfOrderTag",
-	point: Point{
+	point: TestPoint{
 		Measurement: "m",
 		Tags: []TagKeyValue{{
 			Key:   "x",
@@ -260,7 +352,7 @@ var encoderDataErrorTests = []struct {
 	expectError: `tag key "a" out of order \(previous key "x"\)`,
 }, {
 	testName: "InvalidFieldKey",
-	point: Point{
+	point: TestPoint{
 		Measurement: "m",
 		Fields: []FieldKeyValue{{
 			Key:   "",
@@ -273,7 +365,7 @@ var encoderDataErrorTests = []struct {
 	expectError: `invalid field key ""`,
 }, {
 	testName: "TimeStampTooEarly",
-	point: Point{
+	point: TestPoint{
 		Measurement: "m",
 		Fields: []FieldKeyValue{{
 			Key:   "x",
@@ -284,7 +376,7 @@ var encoderDataErrorTests = []struct {
 	expectError: `timestamp 1000-01-01T12:00:00Z: line-protocol value out of range`,
 }, {
 	testName: "TimeStampTooLate",
-	point: Point{
+	point: TestPoint{
 		Measurement: "m",
 		Fields: []FieldKeyValue{{
 			Key:   "x",
@@ -322,6 +414,91 @@ func TestEncoderDataError(t *testing.T) {
 	}
 }
 
+func TestEncodeErrorFields(t *testing.T) {
+	c := qt.New(t)
+	var e Encoder
+	e.StartLine("m")
+	e.AddField("f", MustNewValue(int64(1)))
+	key := []byte("g")
+	e.StartLine("m")
+	e.AddTag("a", "1")
+	e.AddFieldRaw(key, MustNewValue(int64(2)))
+	e.AddField("\xff", MustNewValue(int64(3)))
+	key[0] = 'x'
+	var err *EncodeError
+	c.Assert(errors.As(e.Err(), &err), qt.IsTrue)
+	c.Assert(err.PointIndex, qt.Equals, 1)
+	c.Assert(err.Section, qt.Equals, EncodeField)
+	c.Assert(err.Section.String(), qt.Equals, "field")
+	c.Assert(err.Key, qt.Equals, "\xff")
+	c.Assert(err.Err, qt.ErrorMatches, `invalid field key "\\xff"`)
+	c.Assert(err, qt.ErrorMatches, `encoding point 1: invalid field key "\\xff"`)
+
+	e.Reset()
+	e.StartLine("m")
+	e.AddField("f", MustNewValue(int64(1)))
+	e.EndLine(maxTime.Add(time.Second))
+	c.Assert(errors.As(e.Err(), &err), qt.IsTrue)
+	c.Assert(err.PointIndex, qt.Equals, 0)
+	c.Assert(err.Section, qt.Equals, EncodeTime)
+	c.Assert(err.Key, qt.Equals, "")
+	c.Assert(errors.Is(err, ErrValueOutOfRange), qt.IsTrue)
+}
+
+func TestEncoderCollectErrors(t *testing.T) {
+	c := qt.New(t)
+	var e Encoder
+	c.Assert(e.Errors(), qt.IsNil)
+	e.SetCollectErrors(true)
+	e.StartLine("m")
+	e.AddTag("b", "1")
+	e.AddTag("a", "1")
+	// A second error on the same line isn't recorded.
+	e.AddField("\xff", MustNewValue(int64(1)))
+	e.StartLine("m")
+	e.AddField("f", MustNewValue(int64(1)))
+	e.EndLine(time.Time{})
+	e.StartLine("")
+	e.AddField("f", MustNewValue(int64(1)))
+	e.EndLine(time.Time{})
+	e.StartLine("m")
+	e.AddTag("t", "\x00")
+	e.AddField("f", MustNewValue(int64(1)))
+	e.EndLine(time.Time{})
+	c.Assert(string(e.Bytes()), qt.Equals, "m f=1i\n")
+	c.Assert(e.Err(), qt.ErrorMatches, `tag key "a" out of order \(previous key "b"\)`)
+	errs := e.Errors()
+	c.Assert(errs, qt.HasLen, 3)
+	type errInfo struct {
+		PointIndex int
+		Section    EncodeSection
+		Key        string
+		Err        string
+	}
+	var infos []errInfo
+	for _, err := range errs {
+		infos = append(infos, errInfo{err.PointIndex, err.Section, err.Key, err.Err.Error()})
+	}
+	c.Assert(infos, qt.DeepEquals, []errInfo{{
+		PointIndex: 0,
+		Section:    EncodeTag,
+		Key:        "a",
+		Err:        `tag key "a" out of order (previous key "b")`,
+	}, {
+		PointIndex: 2,
+		Section:    EncodeMeasurement,
+		Err:        `invalid measurement ""`,
+	}, {
+		PointIndex: 3,
+		Section:    EncodeTag,
+		Key:        "t",
+		Err:        `invalid tag value t="\x00"`,
+	}})
+	e.ClearErr()
+	c.Assert(e.Err(), qt.IsNil)
+	c.Assert(e.Errors(), qt.IsNil)
+}
+
 func BenchmarkEncode(b *testing.B) {
 	ts := time.Now()
 	field1Val := []byte("ds;livjdsflvkfesdvljkdsnbvlkdfsjbldfsjhbdfklsjbvkdsjhbv")
@@ -396,7 +573,7 @@ func BenchmarkEncode(b *testing.B) {
 	runBench(b, true)
 }
 
-func encodePoint(e *Encoder, p Point) {
+func encodePoint(e *Encoder, p TestPoint) {
 	e.StartLine(p.Measurement)
 	for _, tag := range p.Tags {
 		e.AddTag(tag.Key, tag.Value)
@@ -407,7 +584,7 @@ func encodePoint(e *Encoder, p Point) {
 	e.EndLine(p.Time)
 }
 
-func pointsHaveError(ps []Point) bool {
+func pointsHaveError(ps []TestPoint) bool {
 	for _, p := range ps {
 		if p.MeasurementError != "" || p.TimeError != "" {
 			return true
@@ -426,7 +603,7 @@ func pointsHaveError(ps []Point) bool {
 	return false
 }
 
-func pointWithSortedTags(p Point) Point {
+func pointWithSortedTags(p TestPoint) TestPoint {
 	p.Tags = append([]TagKeyValue(nil), p.Tags...)
 	sort.Slice(p.Tags, func(i, j int) bool {
 		return p.Tags[i].Key < p.Tags[j].Key
@@ -88,3 +88,19 @@ func (e *escaper) _escape(buf []byte, s string, escIndex int) {
 		}
 	}
 }
+
+// appendUnescaped returns the unescaped form of s appended to buf.
+// It's the inverse of appendEscaped.
+func (e *escaper) appendUnescaped(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if b == '\\' && i+1 < len(s) {
+			if r := e.revTable[s[i+1]]; r != 0 {
+				b = r
+				i++
+			}
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
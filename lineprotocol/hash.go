@@ -0,0 +1,144 @@
+package lineprotocol
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// SeriesHash returns a 64-bit hash of key, which is
+// usually a series key as returned by SeriesKey.
+//
+// The hash is the XXH64 hash of key with a zero seed,
+// so it's the same as that computed by other xxHash
+// implementations, such as github.com/cespare/xxhash.
+func SeriesHash(key []byte) uint64 {
+	var d xxDigest
+	d.reset()
+	d.write(key)
+	return d.sum()
+}
+
+// xxDigest holds the state of an XXH64 hash with a zero seed,
+// which allows a hash to be computed from data that's
+// written in pieces.
+type xxDigest struct {
+	v1, v2, v3, v4 uint64
+	// total holds the total number of bytes written.
+	total uint64
+	// mem holds data that hasn't yet been used to
+	// update the state; only the first n bytes are valid.
+	mem [32]byte
+	n   int
+}
+
+// reset resets d to its initial state.
+func (d *xxDigest) reset() {
+	// Note: the initial values wrap around, so they
+	// can't be constant expressions.
+	d.v1, d.v2, d.v3, d.v4 = xxPrime1, xxPrime2, 0, 0
+	d.v1 += xxPrime2
+	d.v4 -= xxPrime1
+	d.total = 0
+	d.n = 0
+}
+
+// write adds data to the hash.
+func (d *xxDigest) write(data []byte) {
+	d.total += uint64(len(data))
+	if d.n+len(data) < 32 {
+		d.n += copy(d.mem[d.n:], data)
+		return
+	}
+	if d.n > 0 {
+		c := copy(d.mem[d.n:], data)
+		d.writeBlocks(d.mem[:])
+		data = data[c:]
+		d.n = 0
+	}
+	data = d.writeBlocks(data)
+	d.n = copy(d.mem[:], data)
+}
+
+// writeByte adds a single byte to the hash.
+func (d *xxDigest) writeByte(b byte) {
+	if d.n < len(d.mem)-1 {
+		d.mem[d.n] = b
+		d.n++
+		d.total++
+		return
+	}
+	d.write([]byte{b})
+}
+
+// writeBlocks updates the state from all the complete
+// 32-byte blocks in data and returns the remaining data.
+func (d *xxDigest) writeBlocks(data []byte) []byte {
+	v1, v2, v3, v4 := d.v1, d.v2, d.v3, d.v4
+	for len(data) >= 32 {
+		v1 = xxRound(v1, binary.LittleEndian.Uint64(data[0:8]))
+		v2 = xxRound(v2, binary.LittleEndian.Uint64(data[8:16]))
+		v3 = xxRound(v3, binary.LittleEndian.Uint64(data[16:24]))
+		v4 = xxRound(v4, binary.LittleEndian.Uint64(data[24:32]))
+		data = data[32:]
+	}
+	d.v1, d.v2, d.v3, d.v4 = v1, v2, v3, v4
+	return data
+}
+
+// sum returns the hash of all the data written so far.
+func (d *xxDigest) sum() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		v1, v2, v3, v4 := d.v1, d.v2, d.v3, d.v4
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = xxPrime5
+	}
+	h += d.total
+
+	key := d.mem[:d.n]
+	for ; len(key) >= 8; key = key[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(key))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(key) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(key)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		key = key[4:]
+	}
+	for _, b := range key {
+		h ^= uint64(b) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	val = xxRound(0, val)
+	acc ^= val
+	return acc*xxPrime1 + xxPrime4
+}
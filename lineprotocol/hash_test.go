@@ -0,0 +1,67 @@
+package lineprotocol
+
+import (
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// The expected values are taken from the reference
+// XXH64 implementation.
+var seriesHashTests = []struct {
+	data   string
+	expect uint64
+}{
+	{"", 0xef46db3751d8e999},
+	{"a", 0xd24ec4f1a98c6e5b},
+	{"as", 0x1c330fb2d66be179},
+	{"asd", 0x631c37ce72a97393},
+	{"asdf", 0x415872f599cea71e},
+	{"Call me Ishmael. Some years ago--never mind how long precisely-", 0x02a2e85470d6fd96},
+}
+
+func TestSeriesHash(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range seriesHashTests {
+		c.Check(SeriesHash([]byte(test.data)), qt.Equals, test.expect, qt.Commentf("data %q", test.data))
+	}
+}
+
+func TestSeriesHashLengths(t *testing.T) {
+	c := qt.New(t)
+	// Check that every tail length is handled by making
+	// sure that each length gives a different hash.
+	data := strings.Repeat("abcdefghijklmnopqrstuvwxyz", 4)
+	seen := make(map[uint64]int)
+	for i := 0; i <= len(data); i++ {
+		h := SeriesHash([]byte(data[:i]))
+		if j, ok := seen[h]; ok {
+			c.Fatalf("hash of length %d is the same as length %d", i, j)
+		}
+		seen[h] = i
+	}
+}
+
+func TestSeriesHashPieces(t *testing.T) {
+	c := qt.New(t)
+	// Check that writing the data in pieces gives the
+	// same hash as writing it all at once.
+	data := []byte(strings.Repeat("abcdefghijklmnopqrstuvwxyz", 4))
+	for _, size := range []int{1, 3, 7, 31, 32, 33, 50} {
+		var d xxDigest
+		d.reset()
+		for i := 0; i < len(data); i += size {
+			end := i + size
+			if end > len(data) {
+				end = len(data)
+			}
+			if size == 1 {
+				d.writeByte(data[i])
+			} else {
+				d.write(data[i:end])
+			}
+		}
+		c.Check(d.sum(), qt.Equals, SeriesHash(data), qt.Commentf("size %d", size))
+	}
+}
@@ -0,0 +1,347 @@
+// Package httpwrite provides an HTTP handler that implements the
+// InfluxDB v1 and v2 write endpoints, decoding the line-protocol
+// entries in each request and passing them to a callback.
+//
+// It is intended for use in stand-in servers, for example in
+// integration tests, and aims to respond in the same way
+// as InfluxDB itself.
+package httpwrite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+// DefaultMaxBodySize holds the default value for
+// HandlerOptions.MaxBodySize.
+const DefaultMaxBodySize = 32 * 1024 * 1024
+
+const (
+	v1Path = "/write"
+	v2Path = "/api/v2/write"
+)
+
+// HandlerOptions holds options for NewHandler.
+type HandlerOptions struct {
+	// MaxBodySize holds the maximum size of a request body
+	// after any decompression. Larger requests are rejected with
+	// a 413 (Request Entity Too Large) status.
+	// If this is zero, DefaultMaxBodySize is used.
+	MaxBodySize int64
+
+	// MaxLineSize holds the maximum size of a single line-protocol
+	// entry. See lineprotocol.Decoder.SetMaxLineSize.
+	// If this is zero, the size of an entry is only limited by
+	// MaxBodySize.
+	MaxLineSize int
+}
+
+// Request holds information about a write request.
+type Request struct {
+	// HTTPRequest holds the original HTTP request. Its
+	// body should not be read.
+	HTTPRequest *http.Request
+
+	// Version holds the version of the write API used
+	// by the request: 1 or 2.
+	Version int
+
+	// Database and RetentionPolicy hold the db and rp
+	// parameters of a v1 request. RetentionPolicy
+	// may be empty.
+	Database        string
+	RetentionPolicy string
+
+	// Org and Bucket hold the org and bucket parameters of
+	// a v2 request (or the orgID and bucketID parameters
+	// if those aren't present).
+	Org    string
+	Bucket string
+
+	// Precision holds the precision of the timestamps in the request.
+	Precision lineprotocol.Precision
+}
+
+// Error represents an error response from a write endpoint.
+// A write callback can return an *Error to control the
+// response to a request; any other error results in a
+// 500 (Internal Server Error) response.
+type Error struct {
+	// StatusCode holds the HTTP status code of the response.
+	StatusCode int
+	// Code holds the InfluxDB error code, for example "invalid".
+	// It is included in v2 responses only.
+	Code string
+	// Message holds the error message.
+	Message string
+	// Line holds the line number of the line-protocol error,
+	// if any. It is included in v2 responses only.
+	Line int64
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Handler is an http.Handler that serves the InfluxDB v1 (/write)
+// and v2 (/api/v2/write) write endpoints.
+//
+// Requests to other paths are rejected, so to serve the endpoints
+// under a path prefix, use http.StripPrefix.
+type Handler struct {
+	write       func(req *Request, p *lineprotocol.Point) error
+	maxBodySize int64
+	maxLineSize int
+}
+
+// NewHandler returns a handler that calls write for each
+// point in each write request. If opts is nil, the default
+// options are used.
+//
+// Points are passed to write as they're decoded, so when a request
+// holds an invalid entry, the points before it will already have been
+// written when the request fails, as happens with partial writes
+// in InfluxDB 1.x. Entries without a timestamp are given the
+// time that the request was received.
+//
+// As with lineprotocol.Decoder.DecodePoint, the point passed to write
+// is only valid for the duration of the call; use Point.Clone
+// to retain it. The write function may be called concurrently
+// for different requests.
+func NewHandler(write func(req *Request, p *lineprotocol.Point) error, opts *HandlerOptions) *Handler {
+	if opts == nil {
+		opts = &HandlerOptions{}
+	}
+	h := &Handler{
+		write:       write,
+		maxBodySize: opts.MaxBodySize,
+		maxLineSize: opts.MaxLineSize,
+	}
+	if h.maxBodySize <= 0 {
+		h.maxBodySize = DefaultMaxBodySize
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, httpReq *http.Request) {
+	now := time.Now()
+	req := &Request{
+		HTTPRequest: httpReq,
+	}
+	switch httpReq.URL.Path {
+	case v1Path:
+		req.Version = 1
+	case v2Path:
+		req.Version = 2
+	default:
+		// Use the v2 error format because there's
+		// no way of knowing which one the client expects.
+		writeError(w, 2, &Error{
+			StatusCode: http.StatusNotFound,
+			Code:       "not found",
+			Message:    "path not found",
+		})
+		return
+	}
+	if err := h.serve(req, now); err != nil {
+		var werr *Error
+		if !errors.As(err, &werr) {
+			werr = &Error{
+				StatusCode: http.StatusInternalServerError,
+				Code:       "internal error",
+				Message:    err.Error(),
+			}
+		}
+		writeError(w, req.Version, werr)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serve serves a write request, which was received at the given time.
+func (h *Handler) serve(req *Request, now time.Time) error {
+	httpReq := req.HTTPRequest
+	if httpReq.Method != http.MethodPost {
+		return &Error{
+			StatusCode: http.StatusMethodNotAllowed,
+			Code:       "method not allowed",
+			Message:    fmt.Sprintf("method %s not allowed", httpReq.Method),
+		}
+	}
+	if err := parseParams(req); err != nil {
+		return err
+	}
+	opts := &lineprotocol.CompressedDecoderOptions{
+		Compression: lineprotocol.Uncompressed,
+		MaxSize:     h.maxBodySize,
+	}
+	switch encoding := httpReq.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+		if httpReq.ContentLength > h.maxBodySize {
+			return tooLargeError(h.maxBodySize)
+		}
+	case "gzip":
+		opts.Compression = lineprotocol.Gzip
+	default:
+		return &Error{
+			StatusCode: http.StatusUnsupportedMediaType,
+			Code:       "invalid",
+			Message:    fmt.Sprintf("unsupported content encoding %q", encoding),
+		}
+	}
+	dec := lineprotocol.NewDecoderCompressed(httpReq.Body, opts)
+	dec.SetMaxLineSize(h.maxLineSize)
+	var p lineprotocol.Point
+	for dec.Next() {
+		if err := dec.DecodePoint(&p, req.Precision, now); err != nil {
+			if dec.Err() != nil {
+				// The error is probably a result of the read error.
+				break
+			}
+			return parseError(dec, err)
+		}
+		if dec.Err() != nil {
+			// The entry may have been truncated by the read
+			// error, so don't write it.
+			break
+		}
+		if err := h.write(req, &p); err != nil {
+			return err
+		}
+	}
+	if err := dec.Err(); err != nil {
+		if errors.Is(err, lineprotocol.ErrDecompressedTooLarge) {
+			return tooLargeError(h.maxBodySize)
+		}
+		return &Error{
+			StatusCode: http.StatusBadRequest,
+			Code:       "invalid",
+			Message:    fmt.Sprintf("cannot read request body: %v", err),
+		}
+	}
+	return nil
+}
+
+// parseParams parses the query parameters of the request
+// and fills out the relevant fields in req.
+func parseParams(req *Request) error {
+	query := req.HTTPRequest.URL.Query()
+	precision := query.Get("precision")
+	var ok bool
+	if req.Version == 1 {
+		req.Database = query.Get("db")
+		req.RetentionPolicy = query.Get("rp")
+		if req.Database == "" {
+			return invalidError("database is required")
+		}
+		req.Precision, ok = v1Precisions[precision]
+	} else {
+		req.Org = firstNonEmpty(query.Get("org"), query.Get("orgID"))
+		req.Bucket = firstNonEmpty(query.Get("bucket"), query.Get("bucketID"))
+		if req.Org == "" {
+			return invalidError("organization name \"\" not found")
+		}
+		if req.Bucket == "" {
+			return invalidError("bucket name \"\" not found")
+		}
+		req.Precision, ok = v2Precisions[precision]
+	}
+	if !ok {
+		return invalidError(fmt.Sprintf("invalid precision %q", precision))
+	}
+	return nil
+}
+
+var v1Precisions = map[string]lineprotocol.Precision{
+	"":   lineprotocol.Nanosecond,
+	"n":  lineprotocol.Nanosecond,
+	"ns": lineprotocol.Nanosecond,
+	"u":  lineprotocol.Microsecond,
+	"us": lineprotocol.Microsecond,
+	"ms": lineprotocol.Millisecond,
+	"s":  lineprotocol.Second,
+}
+
+var v2Precisions = map[string]lineprotocol.Precision{
+	"":   lineprotocol.Nanosecond,
+	"ns": lineprotocol.Nanosecond,
+	"us": lineprotocol.Microsecond,
+	"ms": lineprotocol.Millisecond,
+	"s":  lineprotocol.Second,
+}
+
+// parseError returns the error for a line-protocol
+// syntax error in the current entry in dec.
+func parseError(dec *lineprotocol.Decoder, err error) error {
+	werr := &Error{
+		StatusCode: http.StatusBadRequest,
+		Code:       "invalid",
+	}
+	var derr *lineprotocol.DecodeError
+	if errors.As(err, &derr) {
+		werr.Line = derr.Line
+		err = derr.Err
+	}
+	if line := dec.RawLine(); line != nil {
+		werr.Message = fmt.Sprintf("unable to parse '%s': %v", line, err)
+	} else {
+		werr.Message = fmt.Sprintf("unable to parse line %d: %v", werr.Line, err)
+	}
+	return werr
+}
+
+func tooLargeError(maxBodySize int64) *Error {
+	return &Error{
+		StatusCode: http.StatusRequestEntityTooLarge,
+		Code:       "request too large",
+		Message:    fmt.Sprintf("request body exceeds maximum size of %d bytes", maxBodySize),
+	}
+}
+
+func invalidError(msg string) *Error {
+	return &Error{
+		StatusCode: http.StatusBadRequest,
+		Code:       "invalid",
+		Message:    msg,
+	}
+}
+
+// writeError writes an error response in the format
+// used by the given version of the write API.
+func writeError(w http.ResponseWriter, version int, err *Error) {
+	var body interface{}
+	if version == 1 {
+		body = struct {
+			Error string `json:"error"`
+		}{err.Message}
+	} else {
+		body = struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Line    int64  `json:"line,omitempty"`
+		}{err.Code, err.Message, err.Line}
+	}
+	data, _ := json.Marshal(body)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err.StatusCode == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", http.MethodPost)
+	}
+	w.WriteHeader(err.StatusCode)
+	w.Write(data)
+}
+
+func firstNonEmpty(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,300 @@
+package httpwrite_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+	"github.com/influxdata/line-protocol/v2/lineprotocol/httpwrite"
+)
+
+func gzipData(s string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.String()
+}
+
+var handlerTests = []struct {
+	testName      string
+	method        string
+	url           string
+	header        http.Header
+	body          string
+	opts          *httpwrite.HandlerOptions
+	writeErr      error
+	expectStatus  int
+	expectBody    string
+	expectPoints  []string
+	expectRequest httpwrite.Request
+}{{
+	testName:     "v2",
+	url:          "/api/v2/write?org=myorg&bucket=mybucket&precision=s",
+	body:         "m1,t=x f=1 1\nm2 f=2i 2\n",
+	expectStatus: http.StatusNoContent,
+	expectPoints: []string{
+		"m1,t=x f=1 1000000000",
+		"m2 f=2i 2000000000",
+	},
+	expectRequest: httpwrite.Request{
+		Version:   2,
+		Org:       "myorg",
+		Bucket:    "mybucket",
+		Precision: lineprotocol.Second,
+	},
+}, {
+	testName:     "v2-ids",
+	url:          "/api/v2/write?orgID=1234&bucketID=5678",
+	body:         "m1 f=1 1\n",
+	expectStatus: http.StatusNoContent,
+	expectPoints: []string{
+		"m1 f=1 1",
+	},
+	expectRequest: httpwrite.Request{
+		Version:   2,
+		Org:       "1234",
+		Bucket:    "5678",
+		Precision: lineprotocol.Nanosecond,
+	},
+}, {
+	testName:     "v1",
+	url:          "/write?db=mydb&rp=myrp&precision=u",
+	body:         "m1 f=1 1\n",
+	expectStatus: http.StatusNoContent,
+	expectPoints: []string{
+		"m1 f=1 1000",
+	},
+	expectRequest: httpwrite.Request{
+		Version:         1,
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+		Precision:       lineprotocol.Microsecond,
+	},
+}, {
+	testName: "gzip",
+	url:      "/api/v2/write?org=o&bucket=b",
+	header: http.Header{
+		"Content-Encoding": {"gzip"},
+	},
+	body:         gzipData("m1 f=1 1\n"),
+	expectStatus: http.StatusNoContent,
+	expectPoints: []string{
+		"m1 f=1 1",
+	},
+	expectRequest: httpwrite.Request{
+		Version:   2,
+		Org:       "o",
+		Bucket:    "b",
+		Precision: lineprotocol.Nanosecond,
+	},
+}, {
+	testName:     "v2-parse-error",
+	url:          "/api/v2/write?org=o&bucket=b",
+	body:         "m1 f=1 1\nm2 f=x 2\nm3 f=3 3\n",
+	expectStatus: http.StatusBadRequest,
+	expectBody:   `{"code":"invalid","message":"unable to parse 'm2 f=x 2': value for field \"f\" (\"x\") has unrecognized type","line":2}`,
+	expectPoints: []string{
+		"m1 f=1 1",
+	},
+}, {
+	testName:     "v1-parse-error",
+	url:          "/write?db=x",
+	body:         "m1 f=1 1\nm2 f=x 2\nm3 f=3 3\n",
+	expectStatus: http.StatusBadRequest,
+	expectBody:   `{"error":"unable to parse 'm2 f=x 2': value for field \"f\" (\"x\") has unrecognized type"}`,
+	expectPoints: []string{
+		"m1 f=1 1",
+	},
+}, {
+	testName: "line-too-long",
+	url:      "/api/v2/write?org=o&bucket=b",
+	body:     "m1 f=1 1\nm2 f=" + strings.Repeat("1", 100) + "\n",
+	opts: &httpwrite.HandlerOptions{
+		MaxLineSize: 50,
+	},
+	expectStatus: http.StatusBadRequest,
+	expectBody:   `{"code":"invalid","message":"unable to parse line 2: line-protocol entry too long (maximum 50 bytes)","line":2}`,
+	expectPoints: []string{
+		"m1 f=1 1",
+	},
+}, {
+	testName: "body-too-large",
+	url:      "/api/v2/write?org=o&bucket=b",
+	body:     "m1 f=1 1\nm2 f=2 2\n",
+	opts: &httpwrite.HandlerOptions{
+		MaxBodySize: 10,
+	},
+	expectStatus: http.StatusRequestEntityTooLarge,
+	expectBody:   `{"code":"request too large","message":"request body exceeds maximum size of 10 bytes"}`,
+}, {
+	testName: "gzip-body-too-large",
+	url:      "/api/v2/write?org=o&bucket=b",
+	header: http.Header{
+		"Content-Encoding": {"gzip"},
+	},
+	body: gzipData("m1 f=1 1\nm2 f=2 2\n"),
+	opts: &httpwrite.HandlerOptions{
+		MaxBodySize: 13,
+	},
+	expectStatus: http.StatusRequestEntityTooLarge,
+	expectBody:   `{"code":"request too large","message":"request body exceeds maximum size of 13 bytes"}`,
+	// Note: no points are written because the first entry
+	// is read at the same time as the error is encountered.
+}, {
+	testName: "invalid-gzip",
+	url:      "/api/v2/write?org=o&bucket=b",
+	header: http.Header{
+		"Content-Encoding": {"gzip"},
+	},
+	body:         "m1 f=1 1\nm2 f=2 2\n",
+	expectStatus: http.StatusBadRequest,
+	expectBody:   `{"code":"invalid","message":"cannot read request body: cannot decompress gzip data: gzip: invalid header"}`,
+}, {
+	testName: "unsupported-encoding",
+	url:      "/api/v2/write?org=o&bucket=b",
+	header: http.Header{
+		"Content-Encoding": {"br"},
+	},
+	body:         "m1 f=1 1\n",
+	expectStatus: http.StatusUnsupportedMediaType,
+	expectBody:   `{"code":"invalid","message":"unsupported content encoding \"br\""}`,
+}, {
+	testName:     "v1-missing-db",
+	url:          "/write",
+	body:         "m1 f=1 1\n",
+	expectStatus: http.StatusBadRequest,
+	expectBody:   `{"error":"database is required"}`,
+}, {
+	testName:     "v2-missing-bucket",
+	url:          "/api/v2/write?org=o",
+	body:         "m1 f=1 1\n",
+	expectStatus: http.StatusBadRequest,
+	expectBody:   `{"code":"invalid","message":"bucket name \"\" not found"}`,
+}, {
+	testName:     "v1-invalid-precision",
+	url:          "/write?db=x&precision=ns1",
+	body:         "m1 f=1 1\n",
+	expectStatus: http.StatusBadRequest,
+	expectBody:   `{"error":"invalid precision \"ns1\""}`,
+}, {
+	testName:     "v2-invalid-precision",
+	url:          "/api/v2/write?org=o&bucket=b&precision=n",
+	body:         "m1 f=1 1\n",
+	expectStatus: http.StatusBadRequest,
+	expectBody:   `{"code":"invalid","message":"invalid precision \"n\""}`,
+}, {
+	testName:     "method-not-allowed",
+	method:       "GET",
+	url:          "/api/v2/write?org=o&bucket=b",
+	expectStatus: http.StatusMethodNotAllowed,
+	expectBody:   `{"code":"method not allowed","message":"method GET not allowed"}`,
+}, {
+	testName:     "not-found",
+	url:          "/api/v2/query",
+	expectStatus: http.StatusNotFound,
+	expectBody:   `{"code":"not found","message":"path not found"}`,
+}, {
+	testName: "write-error",
+	url:      "/api/v2/write?org=o&bucket=b",
+	body:     "m1 f=1 1\n",
+	writeErr: &httpwrite.Error{
+		StatusCode: http.StatusServiceUnavailable,
+		Code:       "unavailable",
+		Message:    "try again later",
+	},
+	expectStatus: http.StatusServiceUnavailable,
+	expectBody:   `{"code":"unavailable","message":"try again later"}`,
+	expectPoints: []string{
+		"m1 f=1 1",
+	},
+}, {
+	testName:     "internal-error",
+	url:          "/write?db=x",
+	body:         "m1 f=1 1\n",
+	writeErr:     fmt.Errorf("something went wrong"),
+	expectStatus: http.StatusInternalServerError,
+	expectBody:   `{"error":"something went wrong"}`,
+	expectPoints: []string{
+		"m1 f=1 1",
+	},
+}}
+
+func TestHandler(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range handlerTests {
+		c.Run(test.testName, func(c *qt.C) {
+			var points []string
+			var gotReq *httpwrite.Request
+			h := httpwrite.NewHandler(func(req *httpwrite.Request, p *lineprotocol.Point) error {
+				gotReq = req
+				var enc lineprotocol.Encoder
+				enc.EncodePoint(p)
+				c.Assert(enc.Err(), qt.IsNil)
+				points = append(points, strings.TrimSuffix(string(enc.Bytes()), "\n"))
+				return test.writeErr
+			}, test.opts)
+			srv := httptest.NewServer(h)
+			defer srv.Close()
+
+			method := test.method
+			if method == "" {
+				method = "POST"
+			}
+			req, err := http.NewRequest(method, srv.URL+test.url, strings.NewReader(test.body))
+			c.Assert(err, qt.IsNil)
+			for k, v := range test.header {
+				req.Header[k] = v
+			}
+			resp, err := http.DefaultClient.Do(req)
+			c.Assert(err, qt.IsNil)
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			c.Assert(err, qt.IsNil)
+			c.Check(resp.StatusCode, qt.Equals, test.expectStatus)
+			c.Check(string(body), qt.Equals, test.expectBody)
+			c.Check(points, qt.DeepEquals, test.expectPoints)
+			if test.expectRequest.Version != 0 {
+				c.Assert(gotReq, qt.Not(qt.IsNil))
+				gotReq1 := *gotReq
+				gotReq1.HTTPRequest = nil
+				c.Check(gotReq1, qt.DeepEquals, test.expectRequest)
+			}
+		})
+	}
+}
+
+func TestHandlerDefaultTime(t *testing.T) {
+	c := qt.New(t)
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+	h := httpwrite.NewHandler(func(req *httpwrite.Request, p *lineprotocol.Point) error {
+		mu.Lock()
+		defer mu.Unlock()
+		times = append(times, p.Time)
+		return nil
+	}, nil)
+	t0 := time.Now().Truncate(time.Second)
+	req := httptest.NewRequest("POST", "/api/v2/write?org=o&bucket=b&precision=s", strings.NewReader("m1 f=1\nm2 f=2\n"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	c.Assert(rec.Code, qt.Equals, http.StatusNoContent)
+	c.Assert(times, qt.HasLen, 2)
+	// Both points are given the same time, truncated
+	// to the request precision.
+	c.Assert(times[0], qt.Equals, times[1])
+	c.Assert(times[0].Before(t0), qt.IsFalse)
+	c.Assert(times[0], qt.Equals, times[0].Truncate(time.Second))
+}
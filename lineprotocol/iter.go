@@ -0,0 +1,108 @@
+//go:build go1.23
+// +build go1.23
+
+package lineprotocol
+
+import (
+	"iter"
+	"time"
+)
+
+// Points returns an iterator over all the remaining entries in d,
+// decoded as if by DecodePoint with the given precision and default time.
+//
+// Comment entries (see Decoder.SetComments) are skipped.
+// When an entry can't be decoded, the iterator yields a nil Point
+// and the *DecodeError, and iteration continues with the next entry.
+// If there's an I/O error, it is yielded at the end of the iteration.
+//
+// The same Point is yielded for each entry, and, as with DecodePoint,
+// its contents are only valid until the next iteration.
+// Use Point.Clone to retain a copy.
+func (d *Decoder) Points(prec Precision, defaultTime time.Time) iter.Seq2[*Point, error] {
+	return func(yield func(*Point, error) bool) {
+		var p Point
+		for d.Next() {
+			if d.Comment() != nil {
+				continue
+			}
+			if err := d.DecodePoint(&p, prec, defaultTime); err != nil {
+				if !yield(nil, err) {
+					return
+				}
+				continue
+			}
+			if !yield(&p, nil) {
+				return
+			}
+		}
+		if err := d.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// Tags returns an iterator over the tags in the current entry,
+// as returned by NextTag. It should be called after Next
+// and before Fields or Time.
+//
+// If there's an error, iteration stops and the error is
+// returned by IterErr. As with NextTag, the yielded byte
+// slices are only valid until the next call to a Decoder method.
+func (d *Decoder) Tags() iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		d.iterErr = nil
+		for {
+			key, val, err := d.NextTag()
+			if err != nil {
+				d.iterErr = err
+				return
+			}
+			if key == nil || !yield(key, val) {
+				return
+			}
+		}
+	}
+}
+
+// Fields returns an iterator over the fields in the current entry,
+// as returned by NextField. It should be called after Next
+// (and Tags, if the tags are required) and before Time.
+//
+// If there's an error, iteration stops and the error is
+// returned by IterErr. As with NextField, the yielded keys
+// and values are only valid until the next call to a Decoder method.
+func (d *Decoder) Fields() iter.Seq2[[]byte, Value] {
+	return func(yield func([]byte, Value) bool) {
+		d.iterErr = nil
+		for {
+			key, val, err := d.NextField()
+			if err != nil {
+				d.iterErr = err
+				return
+			}
+			if key == nil || !yield(key, val) {
+				return
+			}
+		}
+	}
+}
+
+// IterErr returns the error that terminated the most recent
+// iteration over Tags or Fields, if any. It is reset by Next.
+//
+// For example:
+//
+//	for d.Next() {
+//		for key, val := range d.Tags() {
+//			...
+//		}
+//		if err := d.IterErr(); err != nil {
+//			// The rest of the entry will be skipped.
+//			continue
+//		}
+//		...
+//	}
+func (d *Decoder) IterErr() error {
+	return d.iterErr
+}
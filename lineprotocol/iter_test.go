@@ -0,0 +1,164 @@
+//go:build go1.23
+// +build go1.23
+
+package lineprotocol
+
+import (
+	"bytes"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestPointsWithDecoderTests(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range decoderTests {
+		if pointsHaveError(test.expect) || !samePrecision(test.expect) {
+			continue
+		}
+		c.Run(test.testName, func(c *qt.C) {
+			_, text := makeErrPositions(test.text)
+			dec := NewDecoderWithBytes([]byte(text))
+			var prec Precision
+			var defaultTime time.Time
+			if len(test.expect) > 0 {
+				prec, defaultTime = test.expect[0].Precision, test.expect[0].DefaultTime
+			}
+			i := 0
+			for p, err := range dec.Points(prec, defaultTime) {
+				c.Assert(err, qt.IsNil)
+				c.Assert(i < len(test.expect), qt.IsTrue, qt.Commentf("too many points"))
+				got := pointToTestPoint(p)
+				got.Precision, got.DefaultTime = prec, defaultTime
+				c.Assert(got, qt.DeepEquals, test.expect[i])
+				i++
+			}
+			c.Assert(i, qt.Equals, len(test.expect))
+		})
+	}
+}
+
+func TestPointsWithError(t *testing.T) {
+	c := qt.New(t)
+	dec := NewDecoderWithBytes([]byte("m1 f=1\nm2 f=x\nm3 f=3\n"))
+	var names []string
+	var errs []error
+	for p, err := range dec.Points(Nanosecond, time.Time{}) {
+		if err != nil {
+			c.Assert(p, qt.IsNil)
+			errs = append(errs, err)
+			continue
+		}
+		names = append(names, string(p.Measurement))
+	}
+	c.Assert(names, qt.DeepEquals, []string{"m1", "m3"})
+	c.Assert(errs, qt.HasLen, 1)
+	c.Assert(errs[0], qt.Satisfies, isDecodeError)
+	c.Assert(errs[0], qt.ErrorMatches, `at line 2:6: value for field "f" \("x"\) has unrecognized type`)
+}
+
+// samePrecision reports whether all the points use the
+// same precision and default time.
+func samePrecision(ps []TestPoint) bool {
+	for _, p := range ps {
+		if p.Precision != ps[0].Precision || !p.DefaultTime.Equal(ps[0].DefaultTime) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPointsBreak(t *testing.T) {
+	c := qt.New(t)
+	dec := NewDecoderWithBytes([]byte("m1 f=1\nm2 f=2\nm3 f=3\n"))
+	var names []string
+	for p, err := range dec.Points(Nanosecond, time.Time{}) {
+		c.Assert(err, qt.IsNil)
+		names = append(names, string(p.Measurement))
+		if len(names) == 2 {
+			break
+		}
+	}
+	c.Assert(names, qt.DeepEquals, []string{"m1", "m2"})
+}
+
+func TestPointsIOError(t *testing.T) {
+	c := qt.New(t)
+	r := iotest.TimeoutReader(bytes.NewReader([]byte("m1 f=1\n")))
+	dec := NewDecoder(r)
+	var errs []error
+	n := 0
+	for p, err := range dec.Points(Nanosecond, time.Time{}) {
+		if err != nil {
+			c.Assert(p, qt.IsNil)
+			errs = append(errs, err)
+			continue
+		}
+		n++
+	}
+	c.Assert(n, qt.Equals, 1)
+	c.Assert(errs, qt.HasLen, 1)
+	c.Assert(errs[0], qt.Equals, iotest.ErrTimeout)
+}
+
+func TestTagsAndFields(t *testing.T) {
+	c := qt.New(t)
+	dec := NewDecoderWithBytes([]byte("m,a=1,b=2 x=1i,y=\"s\" 1000\nm,a=1,b x=1i\nm a=1,b\nm,a=1 x=2i\n"))
+	type entry struct {
+		Tags   []string
+		Fields []string
+		Err    string
+	}
+	var entries []entry
+	for dec.Next() {
+		var e entry
+		for key, val := range dec.Tags() {
+			e.Tags = append(e.Tags, string(key)+"="+string(val))
+		}
+		if err := dec.IterErr(); err != nil {
+			e.Err = err.Error()
+			entries = append(entries, e)
+			continue
+		}
+		for key, val := range dec.Fields() {
+			e.Fields = append(e.Fields, string(key)+"="+val.String())
+		}
+		if err := dec.IterErr(); err != nil {
+			e.Err = err.Error()
+		}
+		entries = append(entries, e)
+	}
+	c.Assert(entries, qt.DeepEquals, []entry{{
+		Tags:   []string{"a=1", "b=2"},
+		Fields: []string{"x=1i", `y="s"`},
+	}, {
+		Tags: []string{"a=1"},
+		Err:  `at line 2:7: expected '=' after tag key "b", but got ' ' instead`,
+	}, {
+		Fields: []string{"a=1"},
+		Err:    `at line 3:8: want '=' after field key "b", found '\n'`,
+	}, {
+		Tags:   []string{"a=1"},
+		Fields: []string{"x=2i"},
+	}})
+}
+
+func TestFieldsWithoutTags(t *testing.T) {
+	c := qt.New(t)
+	dec := NewDecoderWithBytes([]byte("m,a=1 x=1i,y=2i\n"))
+	c.Assert(dec.Next(), qt.IsTrue)
+	var keys []string
+	for key := range dec.Fields() {
+		keys = append(keys, string(key))
+		break
+	}
+	c.Assert(keys, qt.DeepEquals, []string{"x"})
+	// Breaking out of the iteration leaves the decoder
+	// positioned at the next field.
+	key, _, err := dec.NextField()
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(key), qt.Equals, "y")
+	c.Assert(dec.IterErr(), qt.IsNil)
+}
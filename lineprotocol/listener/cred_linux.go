@@ -0,0 +1,95 @@
+//go:build linux
+// +build linux
+
+package listener
+
+import (
+	"net"
+	"syscall"
+)
+
+// credOOBSize holds the size of the buffer used to receive
+// the credentials attached to each datagram.
+var credOOBSize = syscall.CmsgSpace(syscall.SizeofUcred)
+
+// packetControl returns the function used to configure a
+// datagram socket for the given network before it's bound.
+// For Unix datagram sockets, it asks the kernel to attach
+// the credentials of the sender to each datagram.
+func packetControl(network string) func(network, address string, c syscall.RawConn) error {
+	if network != "unixgram" {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if cerr := c.Control(func(fd uintptr) {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+		}); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+}
+
+// connCredentials returns the credentials of the peer
+// of a Unix stream connection, or nil if they're not available.
+func connCredentials(conn net.Conn) *Credentials {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+	rc, err := uc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	var ucred *syscall.Ucred
+	if cerr := rc.Control(func(fd uintptr) {
+		ucred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); cerr != nil || err != nil {
+		return nil
+	}
+	return &Credentials{
+		PID: int(ucred.Pid),
+		UID: int(ucred.Uid),
+		GID: int(ucred.Gid),
+	}
+}
+
+// readPacket reads a datagram from pc into buf, using oob to
+// receive the sender's credentials when pc is a Unix socket.
+// It also reports whether the datagram was truncated, when
+// that's known.
+func readPacket(pc net.PacketConn, buf, oob []byte) (int, net.Addr, *Credentials, bool, error) {
+	uc, ok := pc.(*net.UnixConn)
+	if !ok {
+		n, addr, err := pc.ReadFrom(buf)
+		return n, addr, nil, false, err
+	}
+	n, oobn, flags, uaddr, err := uc.ReadMsgUnix(buf, oob)
+	var addr net.Addr
+	if uaddr != nil {
+		addr = uaddr
+	}
+	return n, addr, parseCredentials(oob[:oobn]), flags&syscall.MSG_TRUNC != 0, err
+}
+
+// parseCredentials returns the credentials held in the
+// given socket control messages, or nil if there are none.
+func parseCredentials(oob []byte) *Credentials {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	for i := range msgs {
+		ucred, err := syscall.ParseUnixCredentials(&msgs[i])
+		if err != nil {
+			continue
+		}
+		return &Credentials{
+			PID: int(ucred.Pid),
+			UID: int(ucred.Uid),
+			GID: int(ucred.Gid),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+//go:build !linux
+// +build !linux
+
+package listener
+
+import (
+	"net"
+	"syscall"
+)
+
+// credOOBSize holds the size of the buffer used to receive
+// the credentials attached to each datagram. Credentials
+// aren't supported on this platform.
+var credOOBSize = 0
+
+// packetControl returns the function used to configure a
+// datagram socket for the given network before it's bound.
+func packetControl(network string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
+
+// connCredentials returns the credentials of the peer
+// of a stream connection, which aren't available on this platform.
+func connCredentials(conn net.Conn) *Credentials {
+	return nil
+}
+
+// readPacket reads a datagram from pc into buf. Truncation
+// isn't reported directly on this platform.
+func readPacket(pc net.PacketConn, buf, oob []byte) (int, net.Addr, *Credentials, bool, error) {
+	n, addr, err := pc.ReadFrom(buf)
+	return n, addr, nil, false, err
+}
@@ -0,0 +1,562 @@
+// Package listener implements servers that receive line-protocol
+// entries over raw sockets, as accepted by the InfluxDB 1.x UDP
+// service and Telegraf's socket_listener input.
+//
+// Each stream connection (TCP or Unix) is decoded as a single stream
+// of entries, and each datagram (UDP or Unix) is decoded independently
+// of any other.
+package listener
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+const (
+	// DefaultMaxLineSize holds the default value for Options.MaxLineSize.
+	DefaultMaxLineSize = 64 * 1024
+
+	// DefaultMaxDatagramSize holds the default value for Options.MaxDatagramSize.
+	DefaultMaxDatagramSize = 64 * 1024
+)
+
+// ErrDatagramTooLarge is wrapped by the error reported
+// for a datagram larger than Options.MaxDatagramSize.
+var ErrDatagramTooLarge = errors.New("datagram too large")
+
+// Options holds options for the Listen functions.
+type Options struct {
+	// Precision holds the precision of the timestamps in
+	// the received entries. The default is lineprotocol.Nanosecond.
+	Precision lineprotocol.Precision
+
+	// MaxLineSize holds the maximum size of a single entry
+	// received on a stream connection. Longer entries are
+	// counted as decode errors and skipped.
+	// If this is zero, DefaultMaxLineSize is used.
+	MaxLineSize int
+
+	// MaxDatagramSize holds the maximum size of a datagram.
+	// Larger datagrams are truncated: the complete entries
+	// before the truncation point are decoded as usual, and
+	// the rest of the datagram is counted as a decode error
+	// that wraps ErrDatagramTooLarge.
+	// If this is zero, DefaultMaxDatagramSize is used.
+	MaxDatagramSize int
+
+	// OnError, if non-nil, is called with each error encountered when
+	// decoding an entry or reading from a connection. Decoding
+	// errors are of type *lineprotocol.DecodeError.
+	// Errors accepting connections or reading datagrams are also
+	// reported; the server keeps going after them, backing off
+	// if they persist.
+	// It may be called concurrently.
+	OnError func(src *Source, err error)
+
+	// PIDTag and UIDTag hold tag keys for the process ID and user ID
+	// of the peer that sent each point. When the peer's credentials
+	// are known (see Source.Cred), and a key is non-empty, each point
+	// is given a tag with that key, replacing any existing tag with
+	// the same key.
+	PIDTag string
+	UIDTag string
+}
+
+// Source holds information about the origin of a point.
+type Source struct {
+	// Network holds the network that the point was received
+	// on, for example "tcp" or "udp".
+	Network string
+	// Addr holds the address of the peer that sent the point,
+	// if known.
+	Addr net.Addr
+	// Cred holds the credentials of the peer that sent the point,
+	// if known. Credentials are currently only available
+	// for Unix domain sockets on Linux.
+	Cred *Credentials
+}
+
+// Credentials holds the credentials of a peer process,
+// as reported by the operating system.
+type Credentials struct {
+	PID int
+	UID int
+	GID int
+}
+
+// Stats holds counters for a Server.
+type Stats struct {
+	// Points holds the number of points successfully decoded.
+	Points int64
+	// DecodeErrors holds the number of entries that
+	// could not be decoded.
+	DecodeErrors int64
+	// Connections holds the number of stream connections accepted.
+	Connections int64
+	// Datagrams holds the number of datagrams received.
+	Datagrams int64
+}
+
+// Server receives line-protocol entries on a socket
+// and passes the points to a handler function.
+type Server struct {
+	// Note: the counters are first so that they're
+	// 64-bit aligned, as required by sync/atomic.
+	points       int64
+	decodeErrors int64
+	connections  int64
+	datagrams    int64
+
+	network         string
+	handle          func(src *Source, p *lineprotocol.Point)
+	precision       lineprotocol.Precision
+	maxLineSize     int
+	maxDatagramSize int
+	onError         func(src *Source, err error)
+	pidTag          []byte
+	uidTag          []byte
+
+	// Exactly one of ln and pc is non-nil.
+	ln net.Listener
+	pc net.PacketConn
+	// removePath holds the path of a Unix datagram
+	// socket to remove when the server is stopped.
+	removePath string
+
+	// wg tracks the server's goroutines.
+	wg sync.WaitGroup
+	// closing is closed when the server starts to shut down.
+	closing   chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+
+	// mu guards the fields below it.
+	mu sync.Mutex
+	// conns holds the currently open stream connections.
+	conns map[net.Conn]struct{}
+	// forced holds whether the open connections have been
+	// closed, after which no more are accepted.
+	forced bool
+}
+
+// ListenTCP listens for TCP connections on the given address
+// and calls handle for each point received. The server runs until
+// Close or Shutdown is called, or until ctx is cancelled,
+// which is equivalent to calling Close.
+//
+// The point passed to handle is only valid for the duration of
+// the call; use Point.Clone to retain it. The handle function is
+// called concurrently for different connections.
+// If opts is nil, the default options are used.
+func ListenTCP(ctx context.Context, addr string, handle func(src *Source, p *lineprotocol.Point), opts *Options) (*Server, error) {
+	return listenStream(ctx, "tcp", addr, handle, opts)
+}
+
+// ListenUDP listens for UDP datagrams on the given address and
+// calls handle for each point received. Each datagram must hold
+// only complete entries. Entries without a timestamp are given
+// the time that their datagram was received.
+//
+// See ListenTCP for details of the server lifetime and the
+// handle function, which is not called concurrently by a UDP server.
+func ListenUDP(ctx context.Context, addr string, handle func(src *Source, p *lineprotocol.Point), opts *Options) (*Server, error) {
+	return listenPacket(ctx, "udp", addr, handle, opts)
+}
+
+// ListenUnix listens for connections on a Unix domain stream
+// socket at the given path, and calls handle for each point received.
+// The socket file is removed when the server is stopped.
+//
+// On Linux, the credentials of the peer process are
+// recorded in Source.Cred for each point.
+//
+// See ListenTCP for details of the server lifetime and the
+// handle function.
+func ListenUnix(ctx context.Context, path string, handle func(src *Source, p *lineprotocol.Point), opts *Options) (*Server, error) {
+	return listenStream(ctx, "unix", path, handle, opts)
+}
+
+// ListenUnixgram listens for datagrams on a Unix domain socket
+// at the given path, and calls handle for each point received.
+// The socket file is removed when the server is stopped.
+//
+// On Linux, the credentials of the sending process are
+// recorded in Source.Cred for each point.
+//
+// See ListenUDP for details of how datagrams are decoded.
+func ListenUnixgram(ctx context.Context, path string, handle func(src *Source, p *lineprotocol.Point), opts *Options) (*Server, error) {
+	return listenPacket(ctx, "unixgram", path, handle, opts)
+}
+
+func listenStream(ctx context.Context, network, addr string, handle func(src *Source, p *lineprotocol.Point), opts *Options) (*Server, error) {
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	s := newServer(network, handle, opts)
+	s.ln = ln
+	s.start(ctx, s.acceptLoop)
+	return s, nil
+}
+
+func listenPacket(ctx context.Context, network, addr string, handle func(src *Source, p *lineprotocol.Point), opts *Options) (*Server, error) {
+	lc := net.ListenConfig{
+		Control: packetControl(network),
+	}
+	pc, err := lc.ListenPacket(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	s := newServer(network, handle, opts)
+	s.pc = pc
+	if network == "unixgram" {
+		// Unlike a Unix stream listener, a Unix datagram
+		// socket doesn't remove its file when closed.
+		s.removePath = addr
+	}
+	s.start(ctx, s.readLoop)
+	return s, nil
+}
+
+func newServer(network string, handle func(src *Source, p *lineprotocol.Point), opts *Options) *Server {
+	if opts == nil {
+		opts = &Options{}
+	}
+	s := &Server{
+		network:         network,
+		handle:          handle,
+		precision:       opts.Precision,
+		maxLineSize:     opts.MaxLineSize,
+		maxDatagramSize: opts.MaxDatagramSize,
+		onError:         opts.OnError,
+		pidTag:          []byte(opts.PIDTag),
+		uidTag:          []byte(opts.UIDTag),
+		closing:         make(chan struct{}),
+		conns:           make(map[net.Conn]struct{}),
+	}
+	if s.maxLineSize <= 0 {
+		s.maxLineSize = DefaultMaxLineSize
+	}
+	if s.maxDatagramSize <= 0 {
+		s.maxDatagramSize = DefaultMaxDatagramSize
+	}
+	return s
+}
+
+// start starts the server running serve, closing
+// the server when ctx is done.
+func (s *Server) start(ctx context.Context, serve func()) {
+	s.wg.Add(1)
+	go serve()
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.closing:
+		}
+	}()
+}
+
+// Addr returns the address that the server is listening on.
+func (s *Server) Addr() net.Addr {
+	if s.ln != nil {
+		return s.ln.Addr()
+	}
+	return s.pc.LocalAddr()
+}
+
+// Stats returns the current values of the server's counters.
+func (s *Server) Stats() Stats {
+	return Stats{
+		Points:       atomic.LoadInt64(&s.points),
+		DecodeErrors: atomic.LoadInt64(&s.decodeErrors),
+		Connections:  atomic.LoadInt64(&s.connections),
+		Datagrams:    atomic.LoadInt64(&s.datagrams),
+	}
+}
+
+// Close stops the server immediately, closing any open
+// connections, and waits for all calls to the handler to return.
+// It returns any error from closing the listening socket.
+func (s *Server) Close() error {
+	err := s.stop()
+	s.closeConns()
+	s.wg.Wait()
+	return err
+}
+
+// Shutdown stops the server gracefully. It stops listening and then waits
+// for the peers of any open stream connections to close them, and
+// for all calls to the handler to return.
+//
+// If ctx is done before then, Shutdown closes the remaining connections,
+// waits for the handler calls to return and returns ctx.Err().
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.stop()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.closeConns()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// stop closes the listening socket, the first time it's called.
+func (s *Server) stop() error {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+		if s.ln != nil {
+			s.closeErr = s.ln.Close()
+		} else {
+			s.closeErr = s.pc.Close()
+		}
+		if s.removePath != "" {
+			os.Remove(s.removePath)
+		}
+	})
+	return s.closeErr
+}
+
+func (s *Server) isClosing() bool {
+	select {
+	case <-s.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeConns closes all the open stream connections.
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forced = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// addConn records conn as open. It reports false
+// if the server has already closed its connections.
+func (s *Server) addConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.forced {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) removeConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// acceptLoop accepts stream connections until the server is stopped.
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+	var delay time.Duration
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if s.isClosing() {
+				return
+			}
+			s.reportError(&Source{Network: s.network}, err)
+			// Avoid spinning when we're out of file
+			// descriptors or similar.
+			delay = backoff(delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		if !s.addConn(conn) {
+			conn.Close()
+			return
+		}
+		atomic.AddInt64(&s.connections, 1)
+		// Note: s.wg can't be zero here because
+		// acceptLoop itself is counted.
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn decodes the entries received on a stream connection.
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer s.removeConn(conn)
+	defer conn.Close()
+	src := &Source{
+		Network: s.network,
+		Addr:    conn.RemoteAddr(),
+		Cred:    connCredentials(conn),
+	}
+	dec := lineprotocol.NewDecoder(conn)
+	dec.SetMaxLineSize(s.maxLineSize)
+	s.decode(dec, src, time.Time{})
+	if err := dec.Err(); err != nil && !s.isClosing() {
+		s.reportError(src, err)
+	}
+}
+
+// readLoop decodes the entries in each datagram received
+// until the server is stopped.
+func (s *Server) readLoop() {
+	defer s.wg.Done()
+	// Read one more byte than the maximum so that
+	// we can tell when a datagram has been truncated.
+	buf := make([]byte, s.maxDatagramSize+1)
+	oob := make([]byte, credOOBSize)
+	dec := lineprotocol.NewDecoderWithBytes(nil)
+	var delay time.Duration
+	for {
+		n, addr, cred, truncated, err := readPacket(s.pc, buf, oob)
+		if n > s.maxDatagramSize {
+			n = s.maxDatagramSize
+			truncated = true
+		}
+		if n > 0 || truncated {
+			atomic.AddInt64(&s.datagrams, 1)
+			src := &Source{
+				Network: s.network,
+				Addr:    addr,
+				Cred:    cred,
+			}
+			data := buf[:n]
+			if truncated {
+				// Only the entries before the last newline are
+				// complete, so don't decode the rest.
+				data = data[:bytes.LastIndexByte(data, '\n')+1]
+			}
+			dec.ResetBytes(data)
+			s.decode(dec, src, time.Now())
+			if truncated {
+				atomic.AddInt64(&s.decodeErrors, 1)
+				s.reportError(src, &lineprotocol.DecodeError{
+					Line:   int64(bytes.Count(data, []byte("\n"))) + 1,
+					Column: 1,
+					Offset: int64(len(data)),
+					Err:    fmt.Errorf("entry truncated: %w (maximum %d bytes)", ErrDatagramTooLarge, s.maxDatagramSize),
+				})
+			}
+		}
+		if err != nil {
+			if s.isClosing() {
+				return
+			}
+			s.reportError(&Source{Network: s.network}, err)
+			// Errors such as ENOBUFS, or ECONNREFUSED caused
+			// by an ICMP message, are usually transient, so
+			// keep reading, but avoid spinning if they persist.
+			delay = backoff(delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+	}
+}
+
+// backoff returns the time to wait after an error
+// when the previous wait was delay.
+func backoff(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return 5 * time.Millisecond
+	}
+	if delay *= 2; delay > time.Second {
+		return time.Second
+	}
+	return delay
+}
+
+// decode passes all the points in dec to the handler. Entries without
+// a timestamp are given defaultTime, or the current time if that's zero.
+func (s *Server) decode(dec *lineprotocol.Decoder, src *Source, defaultTime time.Time) {
+	credTags := s.credTags(src.Cred)
+	var p lineprotocol.Point
+	for dec.Next() {
+		t := defaultTime
+		if t.IsZero() {
+			t = time.Now()
+		}
+		if err := dec.DecodePoint(&p, s.precision, t); err != nil {
+			if dec.Err() != nil {
+				// The error is probably a result of the read error.
+				return
+			}
+			atomic.AddInt64(&s.decodeErrors, 1)
+			s.reportError(src, err)
+			continue
+		}
+		if dec.Err() != nil {
+			// The entry may have been truncated by the read
+			// error, so don't pass it on.
+			return
+		}
+		for _, tag := range credTags {
+			setTag(&p, tag)
+		}
+		atomic.AddInt64(&s.points, 1)
+		s.handle(src, &p)
+	}
+}
+
+// credTags returns the tags to add to each point
+// sent by a peer with the given credentials.
+func (s *Server) credTags(cred *Credentials) []lineprotocol.Tag {
+	if cred == nil {
+		return nil
+	}
+	var tags []lineprotocol.Tag
+	if len(s.pidTag) > 0 {
+		tags = append(tags, lineprotocol.Tag{
+			Key:   s.pidTag,
+			Value: strconv.AppendInt(nil, int64(cred.PID), 10),
+		})
+	}
+	if len(s.uidTag) > 0 {
+		tags = append(tags, lineprotocol.Tag{
+			Key:   s.uidTag,
+			Value: strconv.AppendInt(nil, int64(cred.UID), 10),
+		})
+	}
+	return tags
+}
+
+// setTag sets a tag in p, replacing any
+// existing tag with the same key.
+func setTag(p *lineprotocol.Point, tag lineprotocol.Tag) {
+	for i := range p.Tags {
+		if bytes.Equal(p.Tags[i].Key, tag.Key) {
+			p.Tags[i].Value = tag.Value
+			return
+		}
+	}
+	p.Tags = append(p.Tags, tag)
+}
+
+func (s *Server) reportError(src *Source, err error) {
+	if s.onError != nil {
+		s.onError(src, err)
+	}
+}
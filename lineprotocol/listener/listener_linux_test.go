@@ -0,0 +1,115 @@
+//go:build linux
+// +build linux
+
+package listener_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+	"github.com/influxdata/line-protocol/v2/lineprotocol/listener"
+)
+
+func TestListenUnixCredentials(t *testing.T) {
+	c := qt.New(t)
+	tests := []struct {
+		network string
+		listen  func(ctx context.Context, path string, handle func(src *listener.Source, p *lineprotocol.Point), opts *listener.Options) (*listener.Server, error)
+	}{{
+		network: "unix",
+		listen:  listener.ListenUnix,
+	}, {
+		network: "unixgram",
+		listen:  listener.ListenUnixgram,
+	}}
+	for _, test := range tests {
+		c.Run(test.network, func(c *qt.C) {
+			path := filepath.Join(c.TempDir(), "sock")
+			var (
+				mu     sync.Mutex
+				points []string
+				creds  []listener.Credentials
+			)
+			s, err := test.listen(context.Background(), path, func(src *listener.Source, p *lineprotocol.Point) {
+				mu.Lock()
+				defer mu.Unlock()
+				var enc lineprotocol.Encoder
+				enc.EncodePoint(p)
+				points = append(points, strings.TrimSuffix(string(enc.Bytes()), "\n"))
+				c.Check(src.Network, qt.Equals, test.network)
+				c.Check(src.Cred, qt.Not(qt.IsNil))
+				if src.Cred != nil {
+					creds = append(creds, *src.Cred)
+				}
+			}, &listener.Options{
+				PIDTag: "pid",
+				UIDTag: "uid",
+			})
+			c.Assert(err, qt.IsNil)
+			defer s.Close()
+
+			conn, err := net.Dial(test.network, path)
+			c.Assert(err, qt.IsNil)
+			_, err = conn.Write([]byte("m1,a=x f=1 1\nm2,pid=1,z=y f=2 2\n"))
+			c.Assert(err, qt.IsNil)
+			waitStats(c, s, func(st listener.Stats) bool {
+				return st.Points == 2
+			})
+			conn.Close()
+			c.Assert(s.Close(), qt.IsNil)
+
+			// The socket file is removed when the server is closed.
+			_, err = os.Stat(path)
+			c.Assert(os.IsNotExist(err), qt.IsTrue)
+
+			pid, uid := os.Getpid(), os.Getuid()
+			c.Assert(points, qt.DeepEquals, []string{
+				fmt.Sprintf("m1,a=x,pid=%d,uid=%d f=1 1", pid, uid),
+				fmt.Sprintf("m2,pid=%d,uid=%d,z=y f=2 2", pid, uid),
+			})
+			cred := listener.Credentials{
+				PID: pid,
+				UID: uid,
+				GID: os.Getgid(),
+			}
+			c.Assert(creds, qt.DeepEquals, []listener.Credentials{cred, cred})
+		})
+	}
+}
+
+func TestListenUnixgramTruncated(t *testing.T) {
+	c := qt.New(t)
+	path := filepath.Join(c.TempDir(), "sock")
+	var rec recorder
+	opts := rec.options()
+	opts.MaxDatagramSize = 20
+	s, err := listener.ListenUnixgram(context.Background(), path, rec.handle, opts)
+	c.Assert(err, qt.IsNil)
+	defer s.Close()
+
+	conn, err := net.Dial("unixgram", path)
+	c.Assert(err, qt.IsNil)
+	defer conn.Close()
+	_, err = conn.Write([]byte("m f=1 1\ncpu v=123456789012345\n"))
+	c.Assert(err, qt.IsNil)
+	waitStats(c, s, func(st listener.Stats) bool {
+		return st.Datagrams == 1
+	})
+	c.Assert(s.Close(), qt.IsNil)
+
+	c.Assert(rec.points, qt.DeepEquals, []string{
+		"unixgram: m f=1 1000000000",
+	})
+	c.Assert(rec.errors, qt.HasLen, 1)
+	c.Assert(rec.errors[0], qt.Equals, `unixgram: at line 2:1: entry truncated: datagram too large (maximum 20 bytes)`)
+	c.Assert(s.Stats().DecodeErrors, qt.Equals, int64(1))
+}
@@ -0,0 +1,271 @@
+package listener_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+	"github.com/influxdata/line-protocol/v2/lineprotocol/listener"
+)
+
+// recorder records the points and errors from a Server.
+type recorder struct {
+	mu     sync.Mutex
+	points []string
+	errors []string
+}
+
+func (r *recorder) handle(src *listener.Source, p *lineprotocol.Point) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var enc lineprotocol.Encoder
+	enc.EncodePoint(p)
+	r.points = append(r.points, src.Network+": "+strings.TrimSuffix(string(enc.Bytes()), "\n"))
+}
+
+func (r *recorder) onError(src *listener.Source, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, src.Network+": "+err.Error())
+}
+
+func (r *recorder) options() *listener.Options {
+	return &listener.Options{
+		Precision:   lineprotocol.Second,
+		MaxLineSize: 50,
+		OnError:     r.onError,
+	}
+}
+
+// waitStats waits until the server's stats satisfy ok.
+func waitStats(c *qt.C, s *listener.Server, ok func(listener.Stats) bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok(s.Stats()) {
+		if time.Now().After(deadline) {
+			c.Fatalf("timed out waiting for stats; got %+v", s.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestListenTCP(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	s, err := listener.ListenTCP(context.Background(), "127.0.0.1:0", rec.handle, rec.options())
+	c.Assert(err, qt.IsNil)
+	defer s.Close()
+
+	conn1, err := net.Dial("tcp", s.Addr().String())
+	c.Assert(err, qt.IsNil)
+	_, err = conn1.Write([]byte("m1 f=1 1\nm2 f=x 2\nm3 f=" + strings.Repeat("1", 100) + " 3\nm4 f=4 4\n"))
+	c.Assert(err, qt.IsNil)
+	conn1.Close()
+
+	// Entries can be split across writes.
+	conn2, err := net.Dial("tcp", s.Addr().String())
+	c.Assert(err, qt.IsNil)
+	_, err = conn2.Write([]byte("m5 f="))
+	c.Assert(err, qt.IsNil)
+	waitStats(c, s, func(st listener.Stats) bool {
+		return st.Connections == 2 && st.Points == 2
+	})
+	_, err = conn2.Write([]byte("5 5\nm6 f=6 6"))
+	c.Assert(err, qt.IsNil)
+	conn2.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.Assert(s.Shutdown(ctx), qt.IsNil)
+
+	c.Assert(rec.points, qt.DeepEquals, []string{
+		"tcp: m1 f=1 1000000000",
+		"tcp: m4 f=4 4000000000",
+		"tcp: m5 f=5 5000000000",
+		"tcp: m6 f=6 6000000000",
+	})
+	c.Assert(rec.errors, qt.DeepEquals, []string{
+		`tcp: at line 2:6: value for field "f" ("x") has unrecognized type`,
+		`tcp: at line 3:1: line-protocol entry too long (maximum 50 bytes)`,
+	})
+	c.Assert(s.Stats(), qt.DeepEquals, listener.Stats{
+		Points:       4,
+		DecodeErrors: 2,
+		Connections:  2,
+	})
+}
+
+func TestListenUDP(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	s, err := listener.ListenUDP(context.Background(), "127.0.0.1:0", rec.handle, rec.options())
+	c.Assert(err, qt.IsNil)
+	defer s.Close()
+
+	conn, err := net.Dial("udp", s.Addr().String())
+	c.Assert(err, qt.IsNil)
+	defer conn.Close()
+	// Each datagram is decoded separately, so an unterminated
+	// entry at the end of one datagram doesn't affect the next.
+	for _, data := range []string{
+		"m1 f=1 1\nm2 f=2 2",
+		"m3 f=x 3\nm4 f=4 4\n",
+	} {
+		_, err := conn.Write([]byte(data))
+		c.Assert(err, qt.IsNil)
+		// Wait for each datagram to be processed so that
+		// the order of the results is predictable.
+		n := s.Stats().Datagrams
+		waitStats(c, s, func(st listener.Stats) bool {
+			return st.Datagrams > n
+		})
+	}
+	c.Assert(s.Close(), qt.IsNil)
+
+	c.Assert(rec.points, qt.DeepEquals, []string{
+		"udp: m1 f=1 1000000000",
+		"udp: m2 f=2 2000000000",
+		"udp: m4 f=4 4000000000",
+	})
+	c.Assert(rec.errors, qt.DeepEquals, []string{
+		`udp: at line 1:6: value for field "f" ("x") has unrecognized type`,
+	})
+	c.Assert(s.Stats(), qt.DeepEquals, listener.Stats{
+		Points:       3,
+		DecodeErrors: 1,
+		Datagrams:    2,
+	})
+}
+
+func TestListenUDPTruncated(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	opts := rec.options()
+	opts.MaxDatagramSize = 20
+	s, err := listener.ListenUDP(context.Background(), "127.0.0.1:0", rec.handle, opts)
+	c.Assert(err, qt.IsNil)
+	defer s.Close()
+
+	conn, err := net.Dial("udp", s.Addr().String())
+	c.Assert(err, qt.IsNil)
+	defer conn.Close()
+	_, err = conn.Write([]byte("m f=1 1\ncpu v=123456789012345\n"))
+	c.Assert(err, qt.IsNil)
+	waitStats(c, s, func(st listener.Stats) bool {
+		return st.Datagrams == 1
+	})
+	c.Assert(s.Close(), qt.IsNil)
+
+	// The truncated entry is reported as an error
+	// rather than being decoded.
+	c.Assert(rec.points, qt.DeepEquals, []string{
+		"udp: m f=1 1000000000",
+	})
+	c.Assert(rec.errors, qt.DeepEquals, []string{
+		`udp: at line 2:1: entry truncated: datagram too large (maximum 20 bytes)`,
+	})
+	c.Assert(s.Stats(), qt.DeepEquals, listener.Stats{
+		Points:       1,
+		DecodeErrors: 1,
+		Datagrams:    1,
+	})
+}
+
+func TestListenUDPDefaultTime(t *testing.T) {
+	c := qt.New(t)
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+	s, err := listener.ListenUDP(context.Background(), "127.0.0.1:0", func(src *listener.Source, p *lineprotocol.Point) {
+		mu.Lock()
+		defer mu.Unlock()
+		times = append(times, p.Time)
+	}, nil)
+	c.Assert(err, qt.IsNil)
+	defer s.Close()
+	t0 := time.Now()
+	conn, err := net.Dial("udp", s.Addr().String())
+	c.Assert(err, qt.IsNil)
+	defer conn.Close()
+	_, err = conn.Write([]byte("m1 f=1\nm2 f=2\n"))
+	c.Assert(err, qt.IsNil)
+	waitStats(c, s, func(st listener.Stats) bool {
+		return st.Points == 2
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	// Both points are given the time the datagram was received.
+	c.Assert(times, qt.HasLen, 2)
+	c.Assert(times[0], qt.Equals, times[1])
+	c.Assert(times[0].Before(t0), qt.IsFalse)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	s, err := listener.ListenTCP(context.Background(), "127.0.0.1:0", rec.handle, rec.options())
+	c.Assert(err, qt.IsNil)
+	defer s.Close()
+	conn, err := net.Dial("tcp", s.Addr().String())
+	c.Assert(err, qt.IsNil)
+	defer conn.Close()
+	_, err = conn.Write([]byte("m1 f=1 1\n"))
+	c.Assert(err, qt.IsNil)
+	waitStats(c, s, func(st listener.Stats) bool {
+		return st.Points == 1
+	})
+
+	// The connection is still open, so Shutdown must
+	// time out and close it.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = s.Shutdown(ctx)
+	c.Assert(errors.Is(err, context.DeadlineExceeded), qt.IsTrue)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	c.Assert(err, qt.Not(qt.IsNil))
+	c.Assert(rec.errors, qt.HasLen, 0)
+}
+
+func TestContextCancel(t *testing.T) {
+	c := qt.New(t)
+	var rec recorder
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := listener.ListenTCP(ctx, "127.0.0.1:0", rec.handle, rec.options())
+	c.Assert(err, qt.IsNil)
+	defer s.Close()
+	conn, err := net.Dial("tcp", s.Addr().String())
+	c.Assert(err, qt.IsNil)
+	defer conn.Close()
+	waitStats(c, s, func(st listener.Stats) bool {
+		return st.Connections == 1
+	})
+	cancel()
+
+	// Cancelling the context closes the open connection
+	// and stops the listener.
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	c.Assert(err, qt.Not(qt.IsNil))
+	c.Assert(errors.Is(err, context.DeadlineExceeded), qt.IsFalse)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", s.Addr().String())
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			c.Fatalf("listener still accepting connections")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
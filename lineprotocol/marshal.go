@@ -0,0 +1,756 @@
+package lineprotocol
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Marshal returns the line-protocol encoding of v, which must
+// be a struct, a pointer to a struct, or a slice or array
+// of structs or pointers to structs. Each struct is encoded
+// as a single line-protocol entry.
+//
+// The encoding of each struct field is determined by its "lp" struct tag,
+// which holds a name optionally followed by a comma-separated
+// list of options. Struct fields without an "lp" tag are ignored,
+// as are fields with the tag "-". The options are:
+//
+//	measurement - the field holds the measurement name.
+//	tag - the field is encoded as a tag.
+//	field - the field is encoded as a field (the default).
+//	timestamp - the field holds the timestamp of the entry.
+//	omitempty - a field is omitted when it holds the zero value.
+//
+// As a special case, the tag `lp:"measurement"` is
+// equivalent to `lp:",measurement"`. If the name is empty,
+// the Go field name is used.
+//
+// For example:
+//
+//	type CPU struct {
+//		Name  string    `lp:"measurement"`
+//		Host  string    `lp:"host,tag"`
+//		Usage float64   `lp:"usage,field"`
+//		Idle  float64   `lp:"idle,omitempty"`
+//		Time  time.Time `lp:",timestamp"`
+//	}
+//
+// Field values may be any integer, unsigned integer, float or
+// bool type, string or []byte, or a type that implements
+// encoding.TextMarshaler, which is encoded as a string.
+// Tag values and the measurement may be a string, []byte, or a
+// type that implements encoding.TextMarshaler; tag values may also
+// be of any integer, float or bool type, which are
+// formatted with the strconv package. The timestamp must be a time.Time
+// value; if it's zero, the entry is encoded without a timestamp.
+//
+// Pointers to any of the above are also allowed;
+// a nil pointer is omitted. Anonymous struct fields without an "lp"
+// tag are treated as if their fields were part of the outer struct.
+//
+// Tags are sorted into lexical order as required by the line-protocol
+// syntax. Tags with an empty value are always omitted, because
+// line-protocol cannot represent them.
+func Marshal(v interface{}) ([]byte, error) {
+	var e Encoder
+	if err := marshalValue(&e, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	if err := e.Err(); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// Unmarshal decodes the line-protocol entries in data into v,
+// which must be a pointer to a struct or a pointer to a slice of structs
+// or pointers to structs. The struct fields are interpreted as for Marshal.
+//
+// When v points to a struct, data must hold exactly one entry.
+// When v points to a slice, Unmarshal resets the slice length to
+// zero and then appends each entry to the slice.
+//
+// Tags and fields in the data that don't correspond to any struct
+// field are ignored. Timestamps are interpreted with Nanosecond precision.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cannot unmarshal into non-pointer %T", v)
+	}
+	rv = rv.Elem()
+	dec := NewDecoderWithBytes(data)
+	switch rv.Kind() {
+	case reflect.Struct:
+		plan, err := planForType(rv.Type())
+		if err != nil {
+			return err
+		}
+		if !dec.Next() {
+			return fmt.Errorf("no line-protocol entries found")
+		}
+		if err := plan.decode(dec, rv, 1); err != nil {
+			return err
+		}
+		if dec.Next() {
+			return fmt.Errorf("cannot unmarshal more than one entry into %v", rv.Type())
+		}
+		return nil
+	case reflect.Slice:
+		elemType := rv.Type().Elem()
+		structType := elemType
+		if structType.Kind() == reflect.Ptr {
+			structType = structType.Elem()
+		}
+		if structType.Kind() != reflect.Struct {
+			return fmt.Errorf("cannot unmarshal into %v", rv.Type())
+		}
+		plan, err := planForType(structType)
+		if err != nil {
+			return err
+		}
+		rv.SetLen(0)
+		for i := 1; dec.Next(); i++ {
+			sv := reflect.New(structType)
+			if err := plan.decode(dec, sv.Elem(), i); err != nil {
+				return err
+			}
+			if elemType.Kind() != reflect.Ptr {
+				sv = sv.Elem()
+			}
+			rv.Set(reflect.Append(rv, sv))
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot unmarshal into %v", rv.Type())
+}
+
+func marshalValue(e *Encoder, rv reflect.Value) error {
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return fmt.Errorf("cannot marshal nil %v", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+	var scratch []byte
+	switch rv.Kind() {
+	case reflect.Struct:
+		plan, err := planForType(rv.Type())
+		if err != nil {
+			return err
+		}
+		_, err = plan.encode(e, addressable(rv), scratch)
+		return err
+	case reflect.Slice, reflect.Array:
+		elemType := rv.Type().Elem()
+		structType := elemType
+		if structType.Kind() == reflect.Ptr {
+			structType = structType.Elem()
+		}
+		if structType.Kind() != reflect.Struct {
+			return fmt.Errorf("cannot marshal %v", rv.Type())
+		}
+		plan, err := planForType(structType)
+		if err != nil {
+			return err
+		}
+		rv = addressable(rv)
+		for i := 0; i < rv.Len(); i++ {
+			sv := rv.Index(i)
+			if sv.Kind() == reflect.Ptr {
+				if sv.IsNil() {
+					return fmt.Errorf("cannot marshal nil %v at index %d", elemType, i)
+				}
+				sv = sv.Elem()
+			}
+			scratch, err = plan.encode(e, sv, scratch)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot marshal %v", rv.Type())
+}
+
+// addressable returns an addressable copy of rv if it's not
+// already addressable, so that methods with pointer receivers
+// can be called on its fields.
+func addressable(rv reflect.Value) reflect.Value {
+	if rv.CanAddr() {
+		return rv
+	}
+	rv1 := reflect.New(rv.Type()).Elem()
+	rv1.Set(rv)
+	return rv1
+}
+
+// structPlan holds the information needed to encode or decode
+// a particular struct type.
+type structPlan struct {
+	typ         reflect.Type
+	measurement *fieldPlan
+	timestamp   *fieldPlan
+	// tags holds the tags sorted by key.
+	tags   []*fieldPlan
+	fields []*fieldPlan
+	// tagsByKey and fieldsByKey map from key to
+	// plan for the tags and fields respectively.
+	tagsByKey   map[string]*fieldPlan
+	fieldsByKey map[string]*fieldPlan
+}
+
+// fieldPlan holds information about a struct field.
+type fieldPlan struct {
+	// goName holds the Go name of the field.
+	goName string
+	// key holds the tag or field key.
+	key string
+	// index holds the index sequence for reflect.Value.FieldByIndex.
+	index []int
+	// typ holds the type of the field with any pointer removed.
+	typ reflect.Type
+	// isPtr holds whether the struct field is a pointer to typ.
+	isPtr     bool
+	omitEmpty bool
+	conv      conversion
+}
+
+// conversion specifies how a Go value is converted
+// to and from line-protocol.
+type conversion byte
+
+const (
+	convText conversion = iota + 1
+	convInt
+	convUint
+	convFloat
+	convBool
+	convString
+	convBytes
+	convTime
+)
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+// planCache holds an entry for each struct type
+// that has been marshaled or unmarshaled.
+var planCache sync.Map // map[reflect.Type]planCacheEntry
+
+type planCacheEntry struct {
+	plan *structPlan
+	err  error
+}
+
+// planForType returns the plan for the given struct type.
+func planForType(t reflect.Type) (*structPlan, error) {
+	if entry, ok := planCache.Load(t); ok {
+		entry := entry.(planCacheEntry)
+		return entry.plan, entry.err
+	}
+	plan, err := newStructPlan(t)
+	entry, _ := planCache.LoadOrStore(t, planCacheEntry{
+		plan: plan,
+		err:  err,
+	})
+	return entry.(planCacheEntry).plan, entry.(planCacheEntry).err
+}
+
+func newStructPlan(t reflect.Type) (*structPlan, error) {
+	plan := &structPlan{
+		typ:         t,
+		tagsByKey:   make(map[string]*fieldPlan),
+		fieldsByKey: make(map[string]*fieldPlan),
+	}
+	if err := plan.addFields(t, nil); err != nil {
+		return nil, fmt.Errorf("invalid type %v: %v", t, err)
+	}
+	sort.Slice(plan.tags, func(i, j int) bool {
+		return plan.tags[i].key < plan.tags[j].key
+	})
+	return plan, nil
+}
+
+// addFields adds all the fields in the struct type t
+// to the plan. The index holds the index of t within
+// the top level struct.
+func (plan *structPlan) addFields(t reflect.Type, index []int) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("lp")
+		if !ok && sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			if err := plan.addFields(sf.Type, append(index[:len(index):len(index)], i)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !ok || tag == "-" {
+			continue
+		}
+		if sf.PkgPath != "" {
+			return fmt.Errorf("field %s with lp tag is not exported", sf.Name)
+		}
+		fp := &fieldPlan{
+			goName: sf.Name,
+			index:  append(index[:len(index):len(index)], i),
+			typ:    sf.Type,
+		}
+		if fp.typ.Kind() == reflect.Ptr {
+			fp.typ = fp.typ.Elem()
+			fp.isPtr = true
+		}
+		parts := strings.Split(tag, ",")
+		fp.key = parts[0]
+		kind := ""
+		if len(parts) == 1 && parts[0] == "measurement" {
+			kind = "measurement"
+		}
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "omitempty":
+				fp.omitEmpty = true
+			case "measurement", "tag", "field", "timestamp":
+				if kind != "" {
+					return fmt.Errorf("field %s has more than one kind in lp tag %q", sf.Name, tag)
+				}
+				kind = opt
+			default:
+				return fmt.Errorf("unknown option %q in lp tag of field %s", opt, sf.Name)
+			}
+		}
+		if fp.key == "" || kind == "measurement" {
+			fp.key = sf.Name
+		}
+		if err := plan.add(fp, kind); err != nil {
+			return fmt.Errorf("field %s: %v", sf.Name, err)
+		}
+	}
+	return nil
+}
+
+func (plan *structPlan) add(fp *fieldPlan, kind string) error {
+	ptrType := reflect.PtrTo(fp.typ)
+	isText := ptrType.Implements(textMarshalerType) || ptrType.Implements(textUnmarshalerType)
+	switch kind {
+	case "measurement":
+		if plan.measurement != nil {
+			return fmt.Errorf("duplicate measurement field (previous field %s)", plan.measurement.goName)
+		}
+		if fp.conv = textConversion(fp.typ, isText); fp.conv == 0 {
+			return fmt.Errorf("invalid measurement type %v", fp.typ)
+		}
+		plan.measurement = fp
+	case "timestamp":
+		if plan.timestamp != nil {
+			return fmt.Errorf("duplicate timestamp field (previous field %s)", plan.timestamp.goName)
+		}
+		if fp.typ != timeType {
+			return fmt.Errorf("invalid timestamp type %v", fp.typ)
+		}
+		fp.conv = convTime
+		plan.timestamp = fp
+	case "tag":
+		if !validMeasurementOrKey(fp.key) {
+			return fmt.Errorf("invalid tag key %q", fp.key)
+		}
+		if plan.tagsByKey[fp.key] != nil {
+			return fmt.Errorf("duplicate tag key %q", fp.key)
+		}
+		fp.conv = textConversion(fp.typ, isText)
+		if fp.conv == 0 {
+			fp.conv = numericConversion(fp.typ)
+		}
+		if fp.conv == 0 {
+			return fmt.Errorf("invalid tag type %v", fp.typ)
+		}
+		plan.tags = append(plan.tags, fp)
+		plan.tagsByKey[fp.key] = fp
+	case "field", "":
+		if !validMeasurementOrKey(fp.key) {
+			return fmt.Errorf("invalid field key %q", fp.key)
+		}
+		if plan.fieldsByKey[fp.key] != nil {
+			return fmt.Errorf("duplicate field key %q", fp.key)
+		}
+		fp.conv = textConversion(fp.typ, isText)
+		if fp.conv == 0 {
+			fp.conv = numericConversion(fp.typ)
+		}
+		if fp.conv == 0 {
+			return fmt.Errorf("invalid field type %v", fp.typ)
+		}
+		plan.fields = append(plan.fields, fp)
+		plan.fieldsByKey[fp.key] = fp
+	}
+	return nil
+}
+
+// textConversion returns the conversion for a type that
+// can be represented as a string, or zero if there is none.
+func textConversion(t reflect.Type, isText bool) conversion {
+	switch {
+	case isText:
+		return convText
+	case t.Kind() == reflect.String:
+		return convString
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return convBytes
+	}
+	return 0
+}
+
+// numericConversion returns the conversion for a numeric or
+// boolean type, or zero if there is none.
+func numericConversion(t reflect.Type) conversion {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return convInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return convUint
+	case reflect.Float32, reflect.Float64:
+		return convFloat
+	case reflect.Bool:
+		return convBool
+	}
+	return 0
+}
+
+// encode encodes the struct value rv as a single entry. The scratch
+// buffer is used to hold temporary data and is returned so
+// that it can be reused.
+func (plan *structPlan) encode(e *Encoder, rv reflect.Value, scratch []byte) ([]byte, error) {
+	if plan.measurement == nil {
+		return scratch, fmt.Errorf("cannot marshal %v: no measurement field", plan.typ)
+	}
+	fv, ok := plan.measurement.value(rv)
+	if !ok {
+		return scratch, fmt.Errorf("cannot marshal %v: nil measurement", plan.typ)
+	}
+	scratch, err := plan.measurement.appendText(scratch[:0], fv)
+	if err != nil {
+		return scratch, err
+	}
+	e.StartLineRaw(scratch)
+	for _, fp := range plan.tags {
+		fv, ok := fp.value(rv)
+		if !ok || (fp.omitEmpty && fv.IsZero()) {
+			continue
+		}
+		scratch, err = fp.appendText(scratch[:0], fv)
+		if err != nil {
+			return scratch, err
+		}
+		if len(scratch) == 0 {
+			// Empty tag values can't be represented.
+			continue
+		}
+		e.AddTag(fp.key, unsafeBytesToString(scratch))
+	}
+	for _, fp := range plan.fields {
+		fv, ok := fp.value(rv)
+		if !ok || (fp.omitEmpty && fv.IsZero()) {
+			continue
+		}
+		var v Value
+		v, scratch, err = fp.fieldValue(scratch[:0], fv)
+		if err != nil {
+			return scratch, err
+		}
+		e.AddField(fp.key, v)
+	}
+	var t time.Time
+	if fp := plan.timestamp; fp != nil {
+		if fv, ok := fp.value(rv); ok {
+			t = fv.Interface().(time.Time)
+		}
+	}
+	e.EndLine(t)
+	return scratch, nil
+}
+
+// value returns the value of the field within the struct value rv,
+// dereferencing any pointer. It reports false if the field
+// is a nil pointer.
+func (fp *fieldPlan) value(rv reflect.Value) (reflect.Value, bool) {
+	fv := rv.FieldByIndex(fp.index)
+	if fp.isPtr {
+		if fv.IsNil() {
+			return reflect.Value{}, false
+		}
+		fv = fv.Elem()
+	}
+	return fv, true
+}
+
+// appendText appends the textual form of fv to dst.
+func (fp *fieldPlan) appendText(dst []byte, fv reflect.Value) ([]byte, error) {
+	switch fp.conv {
+	case convText:
+		m, ok := fv.Addr().Interface().(encoding.TextMarshaler)
+		if !ok {
+			return dst, fmt.Errorf("cannot marshal field %s: %v does not implement encoding.TextMarshaler", fp.goName, fp.typ)
+		}
+		data, err := m.MarshalText()
+		if err != nil {
+			return dst, fmt.Errorf("cannot marshal field %s: %v", fp.goName, err)
+		}
+		return append(dst, data...), nil
+	case convString:
+		return append(dst, fv.String()...), nil
+	case convBytes:
+		return append(dst, fv.Bytes()...), nil
+	case convInt:
+		return strconv.AppendInt(dst, fv.Int(), 10), nil
+	case convUint:
+		return strconv.AppendUint(dst, fv.Uint(), 10), nil
+	case convFloat:
+		return strconv.AppendFloat(dst, fv.Float(), 'g', -1, fv.Type().Bits()), nil
+	case convBool:
+		return strconv.AppendBool(dst, fv.Bool()), nil
+	}
+	panic("unreachable")
+}
+
+// fieldValue returns fv as a Value. The scratch buffer
+// may be used to hold the returned value's data.
+func (fp *fieldPlan) fieldValue(scratch []byte, fv reflect.Value) (Value, []byte, error) {
+	switch fp.conv {
+	case convInt:
+		return IntValue(fv.Int()), scratch, nil
+	case convUint:
+		return UintValue(fv.Uint()), scratch, nil
+	case convFloat:
+		v, ok := FloatValue(fv.Float())
+		if !ok {
+			return Value{}, scratch, fmt.Errorf("cannot marshal field %s: non-finite value %v", fp.goName, fv.Float())
+		}
+		return v, scratch, nil
+	case convBool:
+		return BoolValue(fv.Bool()), scratch, nil
+	}
+	scratch, err := fp.appendText(scratch, fv)
+	if err != nil {
+		return Value{}, scratch, err
+	}
+	v, err := NewValueFromBytes(String, scratch)
+	if err != nil {
+		return Value{}, scratch, fmt.Errorf("cannot marshal field %s: %v", fp.goName, err)
+	}
+	return v, scratch, nil
+}
+
+// decode decodes the current entry in dec into the struct value rv.
+// The index holds the one-based index of the entry, used in error messages.
+func (plan *structPlan) decode(dec *Decoder, rv reflect.Value, index int) error {
+	m, err := dec.Measurement()
+	if err != nil {
+		return err
+	}
+	if fp := plan.measurement; fp != nil {
+		if err := fp.setText(rv, m); err != nil {
+			return decodingError(index, err)
+		}
+	}
+	for {
+		key, val, err := dec.NextTag()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			break
+		}
+		if fp := plan.tagsByKey[string(key)]; fp != nil {
+			if err := fp.setText(rv, val); err != nil {
+				return decodingError(index, err)
+			}
+		}
+	}
+	for {
+		key, val, err := dec.NextField()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			break
+		}
+		if fp := plan.fieldsByKey[string(key)]; fp != nil {
+			if err := fp.setValue(rv, val); err != nil {
+				return decodingError(index, err)
+			}
+		}
+	}
+	t, err := dec.Time(Nanosecond, time.Time{})
+	if err != nil {
+		return err
+	}
+	if fp := plan.timestamp; fp != nil && !t.IsZero() {
+		fp.settable(rv).Set(reflect.ValueOf(t))
+	}
+	return nil
+}
+
+func decodingError(index int, err error) error {
+	if index <= 1 {
+		return err
+	}
+	return fmt.Errorf("decoding point %d: %w", index, err)
+}
+
+// settable returns the field within the struct value rv,
+// allocating a value if the field is a pointer.
+func (fp *fieldPlan) settable(rv reflect.Value) reflect.Value {
+	fv := rv.FieldByIndex(fp.index)
+	if !fp.isPtr {
+		return fv
+	}
+	if fv.IsNil() {
+		fv.Set(reflect.New(fp.typ))
+	}
+	return fv.Elem()
+}
+
+// setText sets the field within rv from the given text.
+func (fp *fieldPlan) setText(rv reflect.Value, data []byte) error {
+	fv := fp.settable(rv)
+	var err error
+	switch fp.conv {
+	case convText:
+		u, ok := fv.Addr().Interface().(encoding.TextUnmarshaler)
+		if !ok {
+			return fmt.Errorf("cannot unmarshal into field %s: %v does not implement encoding.TextUnmarshaler", fp.goName, fp.typ)
+		}
+		err = u.UnmarshalText(data)
+	case convString:
+		fv.SetString(string(data))
+	case convBytes:
+		fv.SetBytes(append([]byte(nil), data...))
+	case convInt:
+		var x int64
+		x, err = parseIntBytes(data, 10, fp.typ.Bits())
+		fv.SetInt(x)
+	case convUint:
+		var x uint64
+		x, err = parseUintBytes(data, 10, fp.typ.Bits())
+		fv.SetUint(x)
+	case convFloat:
+		var x float64
+		x, err = parseFloatBytes(data, fp.typ.Bits())
+		fv.SetFloat(x)
+	case convBool:
+		var x byte
+		x, err = parseBoolBytes(data)
+		fv.SetBool(x != 0)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal %q into field %s of type %v: %w", data, fp.goName, fp.typ, unwrapNumError(err))
+	}
+	return nil
+}
+
+// setValue sets the field within rv from the given field value.
+func (fp *fieldPlan) setValue(rv reflect.Value, v Value) error {
+	kind := v.Kind()
+	fv := fp.settable(rv)
+	var err error
+	switch fp.conv {
+	case convText, convString, convBytes:
+		if kind != String {
+			break
+		}
+		return fp.setText(rv, v.BytesV())
+	case convInt:
+		var x int64
+		switch kind {
+		case Int:
+			x = v.IntV()
+		case Uint:
+			if v.UintV() > math.MaxInt64 {
+				err = ErrValueOutOfRange
+			}
+			x = int64(v.UintV())
+		default:
+			return fp.kindError(kind)
+		}
+		if err == nil && fv.OverflowInt(x) {
+			err = ErrValueOutOfRange
+		}
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal %v into field %s of type %v: %w", v, fp.goName, fp.typ, err)
+		}
+		fv.SetInt(x)
+		return nil
+	case convUint:
+		var x uint64
+		switch kind {
+		case Uint:
+			x = v.UintV()
+		case Int:
+			if v.IntV() < 0 {
+				err = ErrValueOutOfRange
+			}
+			x = uint64(v.IntV())
+		default:
+			return fp.kindError(kind)
+		}
+		if err == nil && fv.OverflowUint(x) {
+			err = ErrValueOutOfRange
+		}
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal %v into field %s of type %v: %w", v, fp.goName, fp.typ, err)
+		}
+		fv.SetUint(x)
+		return nil
+	case convFloat:
+		var x float64
+		switch kind {
+		case Float:
+			x = v.FloatV()
+		case Int:
+			x = float64(v.IntV())
+		case Uint:
+			x = float64(v.UintV())
+		default:
+			return fp.kindError(kind)
+		}
+		if fv.OverflowFloat(x) {
+			return fmt.Errorf("cannot unmarshal %v into field %s of type %v: %w", v, fp.goName, fp.typ, ErrValueOutOfRange)
+		}
+		fv.SetFloat(x)
+		return nil
+	case convBool:
+		if kind != Bool {
+			break
+		}
+		fv.SetBool(v.BoolV())
+		return nil
+	}
+	return fp.kindError(kind)
+}
+
+func (fp *fieldPlan) kindError(kind ValueKind) error {
+	return fmt.Errorf("cannot unmarshal %v value into field %s of type %v", kind, fp.goName, fp.typ)
+}
+
+// unwrapNumError returns the underlying error from a *strconv.NumError
+// so that the error message doesn't repeat the value.
+func unwrapNumError(err error) error {
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		if numErr.Err == strconv.ErrRange {
+			return ErrValueOutOfRange
+		}
+		return numErr.Err
+	}
+	return err
+}
@@ -0,0 +1,327 @@
+package lineprotocol
+
+import (
+	"errors"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/google/go-cmp/cmp"
+)
+
+type marshalCPU struct {
+	Name   string    `lp:"measurement"`
+	Host   string    `lp:"host,tag"`
+	Region string    `lp:"region,tag,omitempty"`
+	CPU    int       `lp:"cpu,tag"`
+	Usage  float64   `lp:"usage,field"`
+	Idle   float64   `lp:"idle,omitempty"`
+	Count  int32     `lp:"count"`
+	Total  uint64    `lp:"total"`
+	OK     bool      `lp:"ok"`
+	Note   string    `lp:"note,omitempty"`
+	Raw    []byte    `lp:"raw,omitempty"`
+	Addr   net.IP    `lp:"addr,omitempty"`
+	Ptr    *int64    `lp:"ptr"`
+	Time   time.Time `lp:",timestamp"`
+	Other  string
+	Ignore string `lp:"-"`
+}
+
+type marshalEmbedded struct {
+	marshalCommon
+	Value float64 `lp:"value"`
+}
+
+type marshalCommon struct {
+	Name string `lp:"measurement"`
+	Zone string `lp:"zone,tag"`
+	Abc  string `lp:"abc,tag"`
+}
+
+var marshalTests = []struct {
+	testName string
+	val      interface{}
+	expect   string
+}{{
+	testName: "basic",
+	val: marshalCPU{
+		Name:  "cpu",
+		Host:  "h 1",
+		CPU:   3,
+		Usage: 0.5,
+		Count: -2,
+		Total: 99,
+		OK:    true,
+		Note:  "a \"note\"",
+		Raw:   []byte("raw"),
+		Addr:  net.IPv4(127, 0, 0, 1),
+		Time:  time.Unix(0, 1625823259000000000),
+	},
+	expect: `cpu,cpu=3,host=h\ 1 usage=0.5,count=-2i,total=99u,ok=true,note="a \"note\"",raw="raw",addr="127.0.0.1" 1625823259000000000` + "\n",
+}, {
+	testName: "pointer-and-empty-tag",
+	val: &marshalCPU{
+		Name:   "cpu",
+		Region: "eu",
+		Ptr:    newInt64(5),
+	},
+	expect: "cpu,cpu=0,region=eu usage=0,count=0i,total=0u,ok=false,ptr=5i\n",
+}, {
+	testName: "slice",
+	val: []*marshalEmbedded{{
+		marshalCommon: marshalCommon{
+			Name: "m",
+			Zone: "z",
+			Abc:  "a",
+		},
+		Value: 1,
+	}, {
+		marshalCommon: marshalCommon{
+			Name: "n",
+		},
+		Value: 2,
+	}},
+	expect: "m,abc=a,zone=z value=1\nn value=2\n",
+}, {
+	testName: "array",
+	val: [1]marshalEmbedded{{
+		marshalCommon: marshalCommon{
+			Name: "m",
+		},
+		Value: 1,
+	}},
+	expect: "m value=1\n",
+}}
+
+func TestMarshal(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range marshalTests {
+		c.Run(test.testName, func(c *qt.C) {
+			data, err := Marshal(test.val)
+			c.Assert(err, qt.IsNil)
+			c.Assert(string(data), qt.Equals, test.expect)
+		})
+	}
+}
+
+func TestUnmarshalRoundTrip(t *testing.T) {
+	c := qt.New(t)
+	var cpus []marshalCPU
+	in := []marshalCPU{{
+		Name:  "cpu",
+		Host:  "h 1",
+		CPU:   3,
+		Usage: 0.5,
+		Count: -2,
+		Total: 99,
+		OK:    true,
+		Note:  "a \"note\"\n",
+		Raw:   []byte("raw"),
+		Addr:  net.IPv4(127, 0, 0, 1).To4(),
+		Ptr:   newInt64(5),
+		Time:  time.Unix(0, 1625823259000000000),
+	}, {
+		Name:   "cpu2",
+		Region: "eu",
+		Usage:  1.5,
+		Idle:   2,
+	}}
+	data, err := Marshal(in)
+	c.Assert(err, qt.IsNil)
+	err = Unmarshal(data, &cpus)
+	c.Assert(err, qt.IsNil)
+	c.Assert(cpus, qt.DeepEquals, in)
+
+	var cpu marshalCPU
+	err = Unmarshal(data, &cpu)
+	c.Assert(err, qt.ErrorMatches, `cannot unmarshal more than one entry into lineprotocol.marshalCPU`)
+
+	var ptrs []*marshalEmbedded
+	err = Unmarshal([]byte("m,zone=z,abc=a,other=x value=1i,extra=3\nn value=2u 1"), &ptrs)
+	c.Assert(err, qt.IsNil)
+	c.Assert(ptrs, qt.CmpEquals(cmp.AllowUnexported(marshalEmbedded{})), []*marshalEmbedded{{
+		marshalCommon: marshalCommon{
+			Name: "m",
+			Zone: "z",
+			Abc:  "a",
+		},
+		Value: 1,
+	}, {
+		marshalCommon: marshalCommon{
+			Name: "n",
+		},
+		Value: 2,
+	}})
+}
+
+var unmarshalErrorTests = []struct {
+	testName    string
+	data        string
+	into        interface{}
+	expectError string
+}{{
+	testName:    "syntax-error",
+	data:        "m value=1\nm value=",
+	into:        &[]marshalEmbedded{},
+	expectError: `at line 2:9: expected value for field "value", found end of input`,
+}, {
+	testName:    "field-kind-mismatch",
+	data:        `m value="x"`,
+	into:        &marshalEmbedded{},
+	expectError: `cannot unmarshal string value into field Value of type float64`,
+}, {
+	testName:    "int-out-of-range",
+	data:        "m value=1\nm count=3000000000i",
+	into:        &[]marshalCPU{},
+	expectError: `decoding point 2: cannot unmarshal 3000000000i into field Count of type int32: line-protocol value out of range`,
+}, {
+	testName:    "negative-uint",
+	data:        "m total=-1i",
+	into:        &marshalCPU{},
+	expectError: `cannot unmarshal -1i into field Total of type uint64: line-protocol value out of range`,
+}, {
+	testName:    "bad-tag",
+	data:        "m,cpu=x usage=1",
+	into:        &marshalCPU{},
+	expectError: `cannot unmarshal "x" into field CPU of type int: invalid syntax`,
+}, {
+	testName:    "no-entries",
+	data:        "# comment\n",
+	into:        &marshalCPU{},
+	expectError: `no line-protocol entries found`,
+}, {
+	testName:    "non-pointer",
+	into:        marshalCPU{},
+	expectError: `cannot unmarshal into non-pointer lineprotocol.marshalCPU`,
+}, {
+	testName:    "bad-type",
+	into:        &[]int{},
+	expectError: `cannot unmarshal into \[\]int`,
+}}
+
+func TestUnmarshalError(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range unmarshalErrorTests {
+		c.Run(test.testName, func(c *qt.C) {
+			err := Unmarshal([]byte(test.data), test.into)
+			c.Assert(err, qt.ErrorMatches, test.expectError)
+		})
+	}
+	err := Unmarshal([]byte("m,cpu=99999999999999999999 usage=1"), &marshalCPU{})
+	c.Assert(errors.Is(err, ErrValueOutOfRange), qt.IsTrue)
+}
+
+var marshalErrorTests = []struct {
+	testName    string
+	val         interface{}
+	expectError string
+}{{
+	testName: "no-measurement",
+	val: struct {
+		X int `lp:"x"`
+	}{},
+	expectError: `cannot marshal struct { X int "lp:\\"x\\"" }: no measurement field`,
+}, {
+	testName: "duplicate-tag",
+	val: struct {
+		M string `lp:"measurement"`
+		X string `lp:"x,tag"`
+		Y string `lp:"x,tag"`
+	}{},
+	expectError: `invalid type .*: field Y: duplicate tag key "x"`,
+}, {
+	testName: "bad-field-type",
+	val: struct {
+		M string         `lp:"measurement"`
+		X map[string]int `lp:"x"`
+	}{},
+	expectError: `invalid type .*: field X: invalid field type map\[string\]int`,
+}, {
+	testName: "bad-timestamp-type",
+	val: struct {
+		M string `lp:"measurement"`
+		T int64  `lp:",timestamp"`
+	}{},
+	expectError: `invalid type .*: field T: invalid timestamp type int64`,
+}, {
+	testName: "unknown-option",
+	val: struct {
+		M string `lp:"measurement"`
+		X int    `lp:"x,foo"`
+	}{},
+	expectError: `invalid type .*: unknown option "foo" in lp tag of field X`,
+}, {
+	testName: "unexported",
+	val: struct {
+		M string `lp:"measurement"`
+		x int    `lp:"x"`
+	}{},
+	expectError: `invalid type .*: field x with lp tag is not exported`,
+}, {
+	testName: "non-finite-float",
+	val: []marshalEmbedded{{
+		marshalCommon: marshalCommon{
+			Name: "m",
+		},
+		Value: 1,
+	}, {
+		marshalCommon: marshalCommon{
+			Name: "m",
+		},
+		Value: math.Inf(1),
+	}},
+	expectError: `cannot marshal field Value: non-finite value \+Inf`,
+}, {
+	testName: "empty-measurement",
+	val: marshalEmbedded{
+		marshalCommon: marshalCommon{
+			Name: "",
+		},
+	},
+	expectError: `invalid measurement ""`,
+}, {
+	testName:    "nil-pointer",
+	val:         (*marshalCPU)(nil),
+	expectError: `cannot marshal nil \*lineprotocol.marshalCPU`,
+}, {
+	testName:    "non-struct",
+	val:         []int{1},
+	expectError: `cannot marshal \[\]int`,
+}}
+
+func TestMarshalError(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range marshalErrorTests {
+		c.Run(test.testName, func(c *qt.C) {
+			data, err := Marshal(test.val)
+			c.Assert(err, qt.ErrorMatches, test.expectError)
+			c.Assert(data, qt.IsNil)
+		})
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	cpus := make([]marshalCPU, 100)
+	for i := range cpus {
+		cpus[i] = marshalCPU{
+			Name:  "cpu",
+			Host:  "host",
+			CPU:   i,
+			Usage: float64(i),
+			Time:  time.Unix(0, int64(i)),
+		}
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(cpus); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func newInt64(x int64) *int64 {
+	return &x
+}
@@ -0,0 +1,276 @@
+package lineprotocol
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+)
+
+// ParallelDecode decodes the line-protocol entries in buf
+// concurrently. It splits buf into at most the given number of
+// chunks, each containing only complete entries, and calls fn
+// concurrently for each chunk, with a Decoder that reads
+// only that chunk. If workers is zero or negative, runtime.GOMAXPROCS(0)
+// is used.
+//
+// The line numbers and offsets in any *DecodeError returned by the
+// decoders are relative to the start of buf, not the start of the chunk.
+//
+// ParallelDecode returns when all calls to fn have returned.
+// If any call returns an error, ParallelDecode returns the error from
+// the earliest chunk in buf.
+//
+// The entry boundaries are found by jumping to evenly spaced offsets
+// in buf and scanning forward to the next newline, then checking
+// each chunk concurrently with a scan that only looks for quoted
+// string field values, so the cost of splitting is small compared to
+// decoding. String field values containing newlines are handled
+// correctly. Note that this scan does not otherwise check the syntax
+// of entries, so the way that decoding recovers from a malformed
+// entry that also has a string field value containing a newline
+// may differ from decoding buf sequentially.
+func ParallelDecode(buf []byte, workers int, fn func(*Decoder) error) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	chunks := splitEntries(buf, workers)
+	if len(chunks) == 1 {
+		return fn(NewDecoderWithBytes(buf))
+	}
+	errs := make([]error, len(chunks))
+	var wg sync.WaitGroup
+	for i, c := range chunks {
+		i, c := i, c
+		end := len(buf)
+		if i+1 < len(chunks) {
+			end = chunks[i+1].start
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dec := NewDecoderWithBytes(buf[c.start:end:end])
+			dec.line = c.line
+			dec.offset = int64(c.start)
+			errs[i] = fn(dec)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryChunk represents the start of a chunk of line-protocol
+// entries within a larger buffer.
+type entryChunk struct {
+	// start holds the byte offset of the start of the chunk.
+	start int
+	// line holds the line number of the start of the chunk.
+	line int64
+}
+
+// splitEntries splits buf into at most n chunks
+// of approximately equal size, each of which starts
+// at the beginning of an entry.
+func splitEntries(buf []byte, n int) []entryChunk {
+	chunks := []entryChunk{{
+		start: 0,
+		line:  1,
+	}}
+	if n <= 1 {
+		return chunks
+	}
+	// Guess the split points by starting at the beginning of
+	// the line containing each target offset. That line is usually
+	// the start of an entry, but it might not be if it's inside
+	// a multi-line string field value, so the guesses are checked
+	// below.
+	for i := 1; i < n; i++ {
+		start := entryStartAfter(buf, len(buf)/n*i)
+		if start >= len(buf) {
+			break
+		}
+		if start > chunks[len(chunks)-1].start {
+			chunks = append(chunks, entryChunk{
+				start: start,
+			})
+		}
+	}
+	if len(chunks) == 1 {
+		return chunks
+	}
+	// Scan each chunk concurrently to find where its last entry
+	// really ends, and count its lines.
+	ends := make([]int, len(chunks))
+	lines := make([]int64, len(chunks))
+	var wg sync.WaitGroup
+	for i := range chunks {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start, limit := chunks[i].start, chunkLimit(buf, chunks, i)
+			ends[i] = skipEntries(buf, start, limit)
+			lines[i] = int64(bytes.Count(buf[start:limit], newlineBytes))
+		}()
+	}
+	wg.Wait()
+	// Each chunk is known to start at an entry if the previous one
+	// did and the scan of the previous one finished exactly at its
+	// start. Merge any chunk that doesn't into the previous one.
+	result := chunks[:1]
+	end := ends[0]
+	line := int64(1) + lines[0]
+	for i := 1; i < len(chunks); i++ {
+		c := chunks[i]
+		if end == c.start {
+			c.line = line
+			result = append(result, c)
+			end = ends[i]
+		} else {
+			// The guessed start was inside an entry, so
+			// carry on scanning from the real end of the entry.
+			end = skipEntries(buf, end, chunkLimit(buf, chunks, i))
+		}
+		line += lines[i]
+	}
+	return result
+}
+
+// chunkLimit returns the offset of the end of the ith chunk.
+func chunkLimit(buf []byte, chunks []entryChunk, i int) int {
+	if i+1 < len(chunks) {
+		return chunks[i+1].start
+	}
+	return len(buf)
+}
+
+// entryStartAfter returns the offset of the first entry that starts
+// at or after offset i, assuming that the line containing i
+// starts with an entry.
+func entryStartAfter(buf []byte, i int) int {
+	return skipEntries(buf, bytes.LastIndexByte(buf[:i], '\n')+1, i)
+}
+
+// skipEntries skips entries from offset i, which must be
+// at the start of an entry, until reaching limit or beyond,
+// and returns the offset of the start of the next entry.
+func skipEntries(buf []byte, i, limit int) int {
+	for i < limit {
+		i = entryEnd(buf, i)
+	}
+	return i
+}
+
+// entryEnd returns the offset just past the newline at the end
+// of the entry that starts at offset i, or len(buf) if there is
+// no newline.
+//
+// It's a cheap approximation to the full syntax that only looks
+// for quoted string field values, which are the only place that
+// a newline doesn't end an entry.
+func entryEnd(buf []byte, i int) int {
+	nl := bytes.IndexByte(buf[i:], '\n')
+	if nl == -1 {
+		return len(buf)
+	}
+	if bytes.IndexByte(buf[i:i+nl], '"') == -1 {
+		// No quotes, so no string fields.
+		return i + nl + 1
+	}
+	i = skipByte(buf, i, ' ')
+	if i < len(buf) && buf[i] == '#' {
+		// Comments end at the first newline.
+		return lineEnd(buf, i)
+	}
+	// Skip the measurement and tags, up to the
+	// first unescaped space.
+	i = skipKey(buf, i, ' ')
+	if i >= len(buf) || buf[i] != ' ' {
+		return lineEnd(buf, i)
+	}
+	i = skipByte(buf, i, ' ')
+	for {
+		// Skip the field key, which can contain quotes and
+		// escaped newlines.
+		i = skipKey(buf, i, '=')
+		if i >= len(buf) || buf[i] != '=' {
+			return lineEnd(buf, i)
+		}
+		i++
+		if i < len(buf) && buf[i] == '"' {
+			i = stringEnd(buf, i+1)
+		}
+		// Skip the rest of the value.
+		for i < len(buf) && buf[i] != ',' && buf[i] != ' ' && buf[i] != '\n' {
+			i++
+		}
+		if i >= len(buf) || buf[i] != ',' {
+			// The timestamp, if any, can't contain quotes.
+			return lineEnd(buf, i)
+		}
+		i++
+	}
+}
+
+// skipKey returns the offset of the first unescaped
+// occurrence of c or newline at or after offset i.
+func skipKey(buf []byte, i int, c byte) int {
+	for ; i < len(buf); i++ {
+		switch buf[i] {
+		case c, '\n':
+			return i
+		case '\\':
+			if i+1 < len(buf) && buf[i+1] != '\n' {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+// stringEnd returns the offset just past the closing quote of the
+// quoted string whose contents start at offset i, or len(buf) if
+// the string isn't closed.
+func stringEnd(buf []byte, i int) int {
+	q := bytes.IndexByte(buf[i:], '"')
+	if q == -1 {
+		return len(buf)
+	}
+	if bytes.IndexByte(buf[i:i+q], '\\') == -1 {
+		// The common case: no escapes before the first quote.
+		return i + q + 1
+	}
+	for i < len(buf) {
+		switch buf[i] {
+		case '"':
+			return i + 1
+		case '\\':
+			i += 2
+		default:
+			i++
+		}
+	}
+	return len(buf)
+}
+
+// skipByte returns the offset of the first byte
+// that isn't c at or after offset i.
+func skipByte(buf []byte, i int, c byte) int {
+	for i < len(buf) && buf[i] == c {
+		i++
+	}
+	return i
+}
+
+// lineEnd returns the offset just past the first newline at
+// or after offset i, or len(buf) if there isn't one.
+func lineEnd(buf []byte, i int) int {
+	if nl := bytes.IndexByte(buf[i:], '\n'); nl >= 0 {
+		return i + nl + 1
+	}
+	return len(buf)
+}
@@ -0,0 +1,160 @@
+package lineprotocol
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// parallelTestEntries holds entries used to build the
+// input to TestParallelDecode. Some of them
+// span several lines and some of them are invalid.
+var parallelTestEntries = []string{
+	`cpu,host=a usage=0.5,idle=3i 1625823259000000000`,
+	`mem free=1u`,
+	`str s="multi` + "\n" + `line` + "\n" + `string",n=1i 10`,
+	`# a comment with a "quote`,
+	``,
+	`bad,t f=1`,
+	`esc\ aped,t\,a=x\"y s="a\"b\\",t=true`,
+	`quote"in"name f="x` + "\n" + `y"`,
+	`badval f=x,g=1i`,
+	`notime f=1 abc`,
+}
+
+func TestParallelDecode(t *testing.T) {
+	c := qt.New(t)
+	var lines []string
+	for i := 0; i < 500; i++ {
+		lines = append(lines, parallelTestEntries[i%len(parallelTestEntries)])
+	}
+	text := []byte(strings.Join(lines, "\n"))
+	expect := decodeSummary(c, NewDecoderWithBytes(text))
+	c.Assert(expect, qt.Not(qt.HasLen), 0)
+	for _, workers := range []int{0, 1, 2, 3, 7, 16, 1000} {
+		c.Run(fmt.Sprint(workers), func(c *qt.C) {
+			var (
+				mu      sync.Mutex
+				got     []string
+				nchunks int
+			)
+			err := ParallelDecode(text, workers, func(dec *Decoder) error {
+				summary := decodeSummary(c, dec)
+				mu.Lock()
+				defer mu.Unlock()
+				got = append(got, summary...)
+				nchunks++
+				return nil
+			})
+			c.Assert(err, qt.IsNil)
+			if workers > 0 {
+				c.Assert(nchunks <= workers, qt.IsTrue)
+			}
+			if workers > 1 {
+				c.Assert(nchunks > 1, qt.IsTrue)
+			}
+			sort.Strings(got)
+			c.Assert(got, qt.DeepEquals, expect)
+		})
+	}
+}
+
+func TestParallelDecodeError(t *testing.T) {
+	c := qt.New(t)
+	text := []byte(strings.Repeat("m f=1\n", 1000))
+	err := ParallelDecode(text, 4, func(dec *Decoder) error {
+		c.Check(dec.Next(), qt.IsTrue)
+		return fmt.Errorf("error at line %d", dec.line)
+	})
+	c.Assert(err, qt.ErrorMatches, `error at line 1`)
+}
+
+func TestParallelDecodeLineNumbers(t *testing.T) {
+	c := qt.New(t)
+	text := []byte(strings.Repeat("m f=1\n", 999) + "m f=\n")
+	var derr *DecodeError
+	err := ParallelDecode(text, 4, func(dec *Decoder) error {
+		for dec.Next() {
+			if _, _, err := dec.NextField(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	c.Assert(errors.As(err, &derr), qt.IsTrue)
+	c.Assert(derr.Line, qt.Equals, int64(1000))
+	c.Assert(derr.Column, qt.Equals, 5)
+	c.Assert(derr.Offset, qt.Equals, int64(999*len("m f=1\n")+len("m f=")))
+}
+
+func TestParallelDecodeEmpty(t *testing.T) {
+	c := qt.New(t)
+	called := 0
+	err := ParallelDecode(nil, 4, func(dec *Decoder) error {
+		called++
+		c.Assert(dec.Next(), qt.IsFalse)
+		return nil
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(called, qt.Equals, 1)
+}
+
+func TestSplitEntries(t *testing.T) {
+	c := qt.New(t)
+	// The lines inside the multi-line string look like entries
+	// but must never be chosen as split points.
+	text := []byte("a s=\"x\nb f=1\nc f=2\ny\" 1\nd f=3\ne f=4\n")
+	for n := 1; n <= 10; n++ {
+		chunks := splitEntries(text, n)
+		c.Assert(chunks[0], qt.Equals, entryChunk{start: 0, line: 1})
+		c.Assert(len(chunks) <= n, qt.IsTrue)
+		for _, chunk := range chunks[1:] {
+			switch chunk {
+			case entryChunk{start: 24, line: 5}, entryChunk{start: 30, line: 6}:
+			default:
+				c.Errorf("unexpected chunk %+v with n=%d", chunk, n)
+			}
+		}
+	}
+}
+
+func BenchmarkSplitEntries(b *testing.B) {
+	for _, bench := range scanEntriesBenchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			data, _ := bench.makeData()
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				splitEntries(data, 8)
+			}
+		})
+	}
+}
+
+// decodeSummary decodes all the entries in dec and returns a
+// sorted summary of them, including any errors.
+func decodeSummary(c *qt.C, dec *Decoder) []string {
+	var summary []string
+	var p Point
+	for dec.Next() {
+		line := dec.line
+		err := dec.DecodePoint(&p, Nanosecond, time.Time{})
+		if err != nil {
+			summary = append(summary, fmt.Sprintf("%06d error %v", line, err))
+			continue
+		}
+		summary = append(summary, fmt.Sprintf("%06d %#v", line, pointToTestPoint(&p)))
+	}
+	// Use Check rather than Assert because this
+	// is called from other goroutines.
+	c.Check(dec.Err(), qt.IsNil)
+	sort.Strings(summary)
+	return summary
+}
@@ -0,0 +1,204 @@
+package lineprotocol
+
+import (
+	"bytes"
+	"sort"
+	"time"
+)
+
+// Point holds all the components of a single line-protocol entry.
+//
+// When a Point has been filled in by Decoder.DecodePoint, its byte
+// slices refer to data held by the Decoder and are only valid until
+// the next call to Decoder.Next. Use Point.Clone to obtain a copy
+// that outlives that.
+type Point struct {
+	// Measurement holds the measurement name.
+	Measurement []byte
+	// Tags holds the tags in the order they appear in the entry.
+	Tags []Tag
+	// Fields holds the fields in the order they appear in the entry.
+	Fields []Field
+	// Time holds the timestamp of the entry.
+	Time time.Time
+}
+
+// Tag holds a tag key and its value.
+type Tag struct {
+	Key   []byte
+	Value []byte
+}
+
+// Field holds a field key and its value.
+type Field struct {
+	Key   []byte
+	Value Value
+}
+
+// Reset clears p, retaining the tag and field slices
+// so that they can be reused.
+func (p *Point) Reset() {
+	p.Measurement = nil
+	p.Tags = p.Tags[:0]
+	p.Fields = p.Fields[:0]
+	p.Time = time.Time{}
+}
+
+// Clone returns a deep copy of p that does not share
+// any data with p.
+func (p *Point) Clone() *Point {
+	// Allocate all the byte slices in one go.
+	n := len(p.Measurement)
+	for _, tag := range p.Tags {
+		n += len(tag.Key) + len(tag.Value)
+	}
+	for _, field := range p.Fields {
+		n += len(field.Key)
+		if field.Value.Kind() == String {
+			n += len(field.Value.bytes)
+		}
+	}
+	buf := make([]byte, 0, n)
+	dup := func(b []byte) []byte {
+		if b == nil {
+			return nil
+		}
+		start := len(buf)
+		buf = append(buf, b...)
+		// Use a full slice expression so that appending to
+		// the result can't overwrite its neighbours.
+		return buf[start:len(buf):len(buf)]
+	}
+	p1 := &Point{
+		Measurement: dup(p.Measurement),
+		Time:        p.Time,
+	}
+	if p.Tags != nil {
+		p1.Tags = make([]Tag, len(p.Tags))
+		for i, tag := range p.Tags {
+			p1.Tags[i] = Tag{
+				Key:   dup(tag.Key),
+				Value: dup(tag.Value),
+			}
+		}
+	}
+	if p.Fields != nil {
+		p1.Fields = make([]Field, len(p.Fields))
+		for i, field := range p.Fields {
+			v := field.Value
+			if v.Kind() == String {
+				v.bytes = dup(v.bytes)
+			}
+			p1.Fields[i] = Field{
+				Key:   dup(field.Key),
+				Value: v,
+			}
+		}
+	}
+	return p1
+}
+
+// DecodePoint decodes all of the current entry into p, which
+// is reset first. The Tags and Fields slices in p are reused
+// when they have sufficient capacity, so decoding into the same
+// Point for each entry avoids allocation.
+//
+// DecodePoint should be called directly after Next.
+// The precision and default time are interpreted as for Decoder.Time.
+//
+// Note that the byte slices in p (including the bytes
+// of any String field values) are only valid until the next
+// call to Next. Use Point.Clone to make a copy that can be retained.
+//
+// If an error is returned, p may hold a partially decoded entry.
+func (d *Decoder) DecodePoint(p *Point, prec Precision, defaultTime time.Time) error {
+	p.Reset()
+	m, err := d.Measurement()
+	if err != nil {
+		return err
+	}
+	p.Measurement = m
+	for {
+		key, val, err := d.NextTag()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			break
+		}
+		p.Tags = append(p.Tags, Tag{
+			Key:   key,
+			Value: val,
+		})
+	}
+	for {
+		key, val, err := d.NextField()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			break
+		}
+		p.Fields = append(p.Fields, Field{
+			Key:   key,
+			Value: val,
+		})
+	}
+	t, err := d.Time(prec, defaultTime)
+	if err != nil {
+		return err
+	}
+	p.Time = t
+	return nil
+}
+
+// EncodePoint encodes p as a complete entry, including the
+// timestamp, which is encoded using e's precision.
+// If p.Time is zero, no timestamp is encoded.
+//
+// Unlike AddTag, the tags in p do not need to be in lexical
+// order: they will be sorted if necessary (p itself is not changed).
+// Duplicate tag keys are still considered to be an error.
+func (e *Encoder) EncodePoint(p *Point) {
+	e.StartLineRaw(p.Measurement)
+	tags := p.Tags
+	if !tagsAreSorted(tags) {
+		e.sortedTags = append(e.sortedTags[:0], tags...)
+		sort.Stable(tagsByKey(e.sortedTags))
+		tags = e.sortedTags
+	}
+	for _, tag := range tags {
+		e.AddTagRaw(tag.Key, tag.Value)
+	}
+	for _, field := range p.Fields {
+		e.AddFieldRaw(field.Key, field.Value)
+	}
+	e.EndLine(p.Time)
+}
+
+// tagsAreSorted reports whether tags are in strictly
+// ascending order of key.
+func tagsAreSorted(tags []Tag) bool {
+	for i := 1; i < len(tags); i++ {
+		if bytes.Compare(tags[i-1].Key, tags[i].Key) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// tagsByKey implements sort.Interface by sorting
+// tags in order of key.
+type tagsByKey []Tag
+
+func (t tagsByKey) Len() int {
+	return len(t)
+}
+
+func (t tagsByKey) Less(i, j int) bool {
+	return bytes.Compare(t[i].Key, t[j].Key) < 0
+}
+
+func (t tagsByKey) Swap(i, j int) {
+	t[i], t[j] = t[j], t[i]
+}
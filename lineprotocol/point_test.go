@@ -0,0 +1,205 @@
+package lineprotocol
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDecodePointWithDecoderTests(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range decoderTests {
+		if pointsHaveError(test.expect) {
+			continue
+		}
+		c.Run(test.testName, func(c *qt.C) {
+			_, text := makeErrPositions(test.text)
+			dec := NewDecoderWithBytes([]byte(text))
+			var p Point
+			i := 0
+			for dec.Next() {
+				c.Assert(i < len(test.expect), qt.IsTrue, qt.Commentf("too many points"))
+				expect := test.expect[i]
+				err := dec.DecodePoint(&p, expect.Precision, expect.DefaultTime)
+				c.Assert(err, qt.IsNil)
+				got := pointToTestPoint(&p)
+				got.Precision, got.DefaultTime = expect.Precision, expect.DefaultTime
+				c.Assert(got, qt.DeepEquals, expect)
+				i++
+			}
+			c.Assert(i, qt.Equals, len(test.expect))
+		})
+	}
+}
+
+func TestDecodePointError(t *testing.T) {
+	c := qt.New(t)
+	dec := NewDecoderWithBytes([]byte("m,t=1 f=1i,g=x 1\nn f=2i 2"))
+	var p Point
+	c.Assert(dec.Next(), qt.IsTrue)
+	err := dec.DecodePoint(&p, Nanosecond, time.Time{})
+	c.Assert(err, qt.ErrorMatches, `at line 1:14: value for field "g" \("x"\) has unrecognized type`)
+	c.Assert(err, qt.Satisfies, isDecodeError)
+
+	c.Assert(dec.Next(), qt.IsTrue)
+	err = dec.DecodePoint(&p, Nanosecond, time.Time{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(pointToTestPoint(&p), qt.DeepEquals, TestPoint{
+		Measurement: "n",
+		Fields: []FieldKeyValue{{
+			Key:   "f",
+			Value: int64(2),
+		}},
+		Time: time.Unix(0, 2),
+	})
+	c.Assert(p.Tags, qt.HasLen, 0)
+	c.Assert(dec.Next(), qt.IsFalse)
+}
+
+func TestPointClone(t *testing.T) {
+	c := qt.New(t)
+	// Use a one-byte reader so that the decoder buffer is
+	// reused between entries.
+	text := `m\ 1,t\=1=a f="x\"y",g=1i 1` + "\n" + `m2,t2=b f2="zzzzzz",g2=2i 2`
+	dec := NewDecoder(&nbyteReader{
+		buf:  []byte(text),
+		next: []int{len(text)},
+	})
+	var p Point
+	c.Assert(dec.Next(), qt.IsTrue)
+	c.Assert(dec.DecodePoint(&p, Nanosecond, time.Time{}), qt.IsNil)
+	p1 := p.Clone()
+	expect := TestPoint{
+		Measurement: "m 1",
+		Tags: []TagKeyValue{{
+			Key:   "t=1",
+			Value: "a",
+		}},
+		Fields: []FieldKeyValue{{
+			Key:   "f",
+			Value: `x"y`,
+		}, {
+			Key:   "g",
+			Value: int64(1),
+		}},
+		Time: time.Unix(0, 1),
+	}
+	c.Assert(pointToTestPoint(p1), qt.DeepEquals, expect)
+
+	c.Assert(dec.Next(), qt.IsTrue)
+	c.Assert(dec.DecodePoint(&p, Nanosecond, time.Time{}), qt.IsNil)
+	c.Assert(string(p.Measurement), qt.Equals, "m2")
+	// The clone should be unaffected by decoding more data.
+	c.Assert(pointToTestPoint(p1), qt.DeepEquals, expect)
+
+	// Appending to a cloned slice shouldn't affect any other.
+	_ = append(p1.Measurement, "xxxxxxx"...)
+	c.Assert(pointToTestPoint(p1), qt.DeepEquals, expect)
+}
+
+func TestDecodePointAllocs(t *testing.T) {
+	c := qt.New(t)
+	data := []byte(strings.Repeat("m,t1=a,t2=b f1=1i,f2=\"hello\",f3=true 1234\n", 200))
+	dec := NewDecoderWithBytes(data)
+	var p Point
+	allocs := testing.AllocsPerRun(100, func() {
+		if !dec.Next() {
+			panic("unexpected end of input")
+		}
+		if err := dec.DecodePoint(&p, Nanosecond, time.Time{}); err != nil {
+			panic(err)
+		}
+	})
+	c.Assert(allocs, qt.Equals, 0.0)
+}
+
+// pointToTestPoint converts p to the representation used
+// in the decoder tests.
+func pointToTestPoint(p *Point) TestPoint {
+	tp := TestPoint{
+		Measurement: string(p.Measurement),
+		Time:        p.Time,
+	}
+	for _, tag := range p.Tags {
+		tp.Tags = append(tp.Tags, TagKeyValue{
+			Key:   string(tag.Key),
+			Value: string(tag.Value),
+		})
+	}
+	for _, field := range p.Fields {
+		tp.Fields = append(tp.Fields, FieldKeyValue{
+			Key:   string(field.Key),
+			Value: field.Value.Interface(),
+		})
+	}
+	return tp
+}
+
+func TestEncodePointWithDecoderTests(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range decoderTests {
+		if pointsHaveError(test.expect) {
+			continue
+		}
+		c.Run(test.testName, func(c *qt.C) {
+			// Decode all the points, then encode them again
+			// and check that they round trip.
+			_, text := makeErrPositions(test.text)
+			dec := NewDecoderWithBytes([]byte(text))
+			var e Encoder
+			var p Point
+			for i := 0; dec.Next(); i++ {
+				expect := test.expect[i]
+				err := dec.DecodePoint(&p, expect.Precision, expect.DefaultTime)
+				c.Assert(err, qt.IsNil)
+				e.EncodePoint(&p)
+			}
+			c.Assert(e.Err(), qt.IsNil)
+			points := append([]TestPoint(nil), test.expect...)
+			for i := range points {
+				points[i] = pointWithSortedTags(points[i])
+				// The default time has been resolved by the decoding.
+				points[i].DefaultTime = time.Time{}
+				points[i].Precision = Nanosecond
+			}
+			assertDecodeResult(c, NewDecoderWithBytes(e.Bytes()), points, false, errPositions{})
+		})
+	}
+}
+
+func TestEncodePointSortsTags(t *testing.T) {
+	c := qt.New(t)
+	p := &Point{
+		Measurement: []byte("m"),
+		Tags: []Tag{{
+			Key:   []byte("c"),
+			Value: []byte("1"),
+		}, {
+			Key:   []byte("a"),
+			Value: []byte("2"),
+		}, {
+			Key:   []byte("b"),
+			Value: []byte("3"),
+		}},
+		Fields: []Field{{
+			Key:   []byte("f"),
+			Value: MustNewValue(int64(1)),
+		}},
+		Time: time.Unix(0, 1615196563_299_053_942),
+	}
+	var e Encoder
+	e.SetPrecision(Millisecond)
+	e.EncodePoint(p)
+	c.Assert(e.Err(), qt.IsNil)
+	c.Assert(string(e.Bytes()), qt.Equals, "m,a=2,b=3,c=1 f=1i 1615196563299\n")
+	// The original point should not have been changed.
+	c.Assert(string(p.Tags[0].Key), qt.Equals, "c")
+
+	// Duplicate keys are an error.
+	p.Tags[1].Key = []byte("c")
+	e.EncodePoint(p)
+	c.Assert(e.Err(), qt.ErrorMatches, `encoding point 1: tag key "c" out of order \(previous key "c"\)`)
+	c.Assert(string(e.Bytes()), qt.Equals, "m,a=2,b=3,c=1 f=1i 1615196563299\n")
+}
@@ -62,3 +62,19 @@ func (p Precision) String() string {
 	}
 	panic(fmt.Errorf("unknown precision %d", p))
 }
+
+// ParsePrecision parses a precision as used in the InfluxDB
+// write API: one of ns, us (or µs), ms or s.
+func ParsePrecision(s string) (Precision, error) {
+	switch s {
+	case "ns":
+		return Nanosecond, nil
+	case "us", "µs":
+		return Microsecond, nil
+	case "ms":
+		return Millisecond, nil
+	case "s":
+		return Second, nil
+	}
+	return 0, fmt.Errorf("unknown precision %q", s)
+}
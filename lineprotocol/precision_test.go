@@ -0,0 +1,52 @@
+package lineprotocol
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+var parsePrecisionTests = []struct {
+	s           string
+	expect      Precision
+	expectError string
+}{{
+	s:      "ns",
+	expect: Nanosecond,
+}, {
+	s:      "us",
+	expect: Microsecond,
+}, {
+	s:      "µs",
+	expect: Microsecond,
+}, {
+	s:      "ms",
+	expect: Millisecond,
+}, {
+	s:      "s",
+	expect: Second,
+}, {
+	s:           "m",
+	expectError: `unknown precision "m"`,
+}, {
+	s:           "",
+	expectError: `unknown precision ""`,
+}}
+
+func TestParsePrecision(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range parsePrecisionTests {
+		c.Run(test.s, func(c *qt.C) {
+			p, err := ParsePrecision(test.s)
+			if test.expectError != "" {
+				c.Assert(err, qt.ErrorMatches, test.expectError)
+				return
+			}
+			c.Assert(err, qt.IsNil)
+			c.Assert(p, qt.Equals, test.expect)
+			if test.s != "us" {
+				c.Assert(p.String(), qt.Equals, test.s)
+			}
+		})
+	}
+}
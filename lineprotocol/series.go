@@ -0,0 +1,171 @@
+package lineprotocol
+
+import (
+	"bytes"
+)
+
+// SeriesKey appends the canonical series key of p to dst and returns
+// the result. The series key is the measurement followed by the tags
+// sorted in order of key, escaped in the same way as in a line-protocol
+// entry, for example:
+//
+//	cpu,host=server\ 1,region=eu
+//
+// This is the form that InfluxDB uses to identify a series, so
+// points with the same measurement and tags have the same series
+// key regardless of the order of their tags. Tags with duplicate
+// keys are retained in their original relative order.
+//
+// Use SeriesHash to obtain a hash of the key.
+func (p *Point) SeriesKey(dst []byte) []byte {
+	dst = measurementEscapes.appendEscaped(dst, unsafeBytesToString(p.Measurement))
+	if tagsAreSorted(p.Tags) {
+		for _, tag := range p.Tags {
+			dst = appendSeriesTag(dst, tag)
+		}
+		return dst
+	}
+	// The tags must not be changed, so repeatedly find the next tag in
+	// order, comparing indexes to order tags with the same key. This is
+	// quadratic, but avoids allocation and tags are usually few.
+	prev := -1
+	for range p.Tags {
+		next := -1
+		for i := range p.Tags {
+			if prev >= 0 && !tagIndexLess(p.Tags, prev, i) {
+				continue
+			}
+			if next < 0 || tagIndexLess(p.Tags, i, next) {
+				next = i
+			}
+		}
+		dst = appendSeriesTag(dst, p.Tags[next])
+		prev = next
+	}
+	return dst
+}
+
+// tagIndexLess reports whether tags[i] is ordered before
+// tags[j] in a series key.
+func tagIndexLess(tags []Tag, i, j int) bool {
+	if c := bytes.Compare(tags[i].Key, tags[j].Key); c != 0 {
+		return c < 0
+	}
+	return i < j
+}
+
+// SeriesKey decodes the measurement and tags of the current entry
+// and returns its canonical series key, as described in Point.SeriesKey.
+// The returned data is owned by the Decoder and is only valid
+// until the next call to SeriesKey or Next.
+//
+// SeriesKey must be called directly after Next; like Measurement, it
+// returns nil if it's called later. NextField and Time may be called
+// afterwards to decode the rest of the entry.
+//
+// SeriesKey does not allocate once its buffers have grown large enough.
+// Use SeriesHash to obtain only the hash of the key.
+func (d *Decoder) SeriesKey() ([]byte, error) {
+	m, tags, err := d.sortedSeriesTags()
+	if m == nil {
+		return nil, err
+	}
+	key := measurementEscapes.appendEscaped(d.seriesKey[:0], unsafeBytesToString(m))
+	for _, tag := range tags {
+		key = appendSeriesTag(key, tag)
+	}
+	d.seriesKey = key
+	return key, nil
+}
+
+// SeriesHash decodes the measurement and tags of the current entry
+// and returns the hash of its series key. The result is the same as
+// that of SeriesHash(key) where key is the result of SeriesKey, but the
+// hash is computed as the escaped key is produced, so the key
+// itself is never built. For example, to find the series hash of
+// each entry:
+//
+//	for dec.Next() {
+//		hash, err := dec.SeriesHash()
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// As with SeriesKey, SeriesHash must be called directly after Next;
+// it returns zero and a nil error if it's called later.
+func (d *Decoder) SeriesHash() (uint64, error) {
+	m, tags, err := d.sortedSeriesTags()
+	if m == nil {
+		return 0, err
+	}
+	var h xxDigest
+	h.reset()
+	writeEscapedHash(&h, measurementEscapes, m)
+	for _, tag := range tags {
+		h.writeByte(',')
+		writeEscapedHash(&h, tagKeyEscapes, tag.Key)
+		h.writeByte('=')
+		writeEscapedHash(&h, tagValEscapes, tag.Value)
+	}
+	return h.sum(), nil
+}
+
+// sortedSeriesTags decodes the measurement and tags of the current
+// entry and returns them with the tags sorted in series key order.
+// It returns a nil measurement if there's an error or the
+// measurement has already been decoded.
+func (d *Decoder) sortedSeriesTags() ([]byte, []Tag, error) {
+	m, err := d.Measurement()
+	if err != nil || m == nil {
+		return nil, nil, err
+	}
+	d.seriesTags = d.seriesTags[:0]
+	for {
+		key, val, err := d.NextTag()
+		if err != nil {
+			return nil, nil, err
+		}
+		if key == nil {
+			break
+		}
+		d.seriesTags = append(d.seriesTags, Tag{
+			Key:   key,
+			Value: val,
+		})
+	}
+	// Sort the tags in place with an insertion sort, which is
+	// stable, doesn't allocate and is fast for the small
+	// number of tags that entries usually have.
+	tags := d.seriesTags
+	for i := 1; i < len(tags); i++ {
+		for j := i; j > 0 && bytes.Compare(tags[j-1].Key, tags[j].Key) > 0; j-- {
+			tags[j-1], tags[j] = tags[j], tags[j-1]
+		}
+	}
+	return m, tags, nil
+}
+
+// writeEscapedHash writes the escaped form of s to h.
+func writeEscapedHash(h *xxDigest, e *escaper, s []byte) {
+	start := 0
+	for i, b := range s {
+		if r := e.table[b]; r != 0 {
+			h.write(s[start:i])
+			h.writeByte('\\')
+			h.writeByte(r)
+			start = i + 1
+		}
+	}
+	h.write(s[start:])
+}
+
+// appendSeriesTag appends the escaped form of
+// tag to a series key.
+func appendSeriesTag(dst []byte, tag Tag) []byte {
+	dst = append(dst, ',')
+	dst = tagKeyEscapes.appendEscaped(dst, unsafeBytesToString(tag.Key))
+	dst = append(dst, '=')
+	return tagValEscapes.appendEscaped(dst, unsafeBytesToString(tag.Value))
+}
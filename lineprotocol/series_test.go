@@ -0,0 +1,156 @@
+package lineprotocol
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+var seriesKeyTests = []struct {
+	testName  string
+	entry     string
+	expectKey string
+}{{
+	testName:  "no-tags",
+	entry:     "cpu f=1",
+	expectKey: "cpu",
+}, {
+	testName:  "sorted-tags",
+	entry:     "cpu,a=1,b=2 f=1",
+	expectKey: "cpu,a=1,b=2",
+}, {
+	testName:  "unsorted-tags",
+	entry:     "cpu,region=eu,host=h1,az=2 f=1 1234",
+	expectKey: "cpu,az=2,host=h1,region=eu",
+}, {
+	testName:  "duplicate-tags",
+	entry:     "cpu,b=2,a=x,b=1,a=y f=1",
+	expectKey: "cpu,a=x,a=y,b=2,b=1",
+}, {
+	testName:  "escapes",
+	entry:     `c\ p\,u,t\=\ 2=a\,b,t\,1=a\ b\=c f=1`,
+	expectKey: `c\ p\,u,t\,1=a\ b\=c,t\=\ 2=a\,b`,
+}, {
+	testName:  "literal-backslashes",
+	entry:     `c\=pu,t\x=a\\b f=1`,
+	expectKey: `c\=pu,t\x=a\\b`,
+}, {
+	testName:  "long-key",
+	entry:     `measurement\ name,region=europe-west,host=server\ 0001,datacenter=dc\,1 f=1`,
+	expectKey: `measurement\ name,datacenter=dc\,1,host=server\ 0001,region=europe-west`,
+}}
+
+func TestSeriesKey(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range seriesKeyTests {
+		c.Run(test.testName, func(c *qt.C) {
+			dec := NewDecoderWithBytes([]byte(test.entry))
+			c.Assert(dec.Next(), qt.IsTrue)
+			key, err := dec.SeriesKey()
+			c.Assert(err, qt.IsNil)
+			c.Assert(string(key), qt.Equals, test.expectKey)
+
+			// The rest of the entry can still be decoded.
+			fkey, val, err := dec.NextField()
+			c.Assert(err, qt.IsNil)
+			c.Assert(string(fkey), qt.Equals, "f")
+			c.Assert(val, qt.DeepEquals, MustNewValue(1.0))
+
+			dec = NewDecoderWithBytes([]byte(test.entry))
+			c.Assert(dec.Next(), qt.IsTrue)
+			hash, err := dec.SeriesHash()
+			c.Assert(err, qt.IsNil)
+			c.Assert(hash, qt.Equals, SeriesHash([]byte(test.expectKey)))
+
+			dec = NewDecoderWithBytes([]byte(test.entry))
+			c.Assert(dec.Next(), qt.IsTrue)
+			var p Point
+			err = dec.DecodePoint(&p, Nanosecond, time.Time{})
+			c.Assert(err, qt.IsNil)
+			tags := append([]Tag(nil), p.Tags...)
+			key = p.SeriesKey([]byte("prefix:"))
+			c.Assert(string(key), qt.Equals, "prefix:"+test.expectKey)
+			// The point's tags must be unchanged.
+			c.Assert(p.Tags, qt.DeepEquals, tags)
+		})
+	}
+}
+
+func TestDecoderSeriesKeyError(t *testing.T) {
+	c := qt.New(t)
+	dec := NewDecoderWithBytes([]byte("cpu,a=1,b f=1\nmem,x=1 f=1\n"))
+	c.Assert(dec.Next(), qt.IsTrue)
+	key, err := dec.SeriesKey()
+	c.Assert(err, qt.ErrorMatches, `at line 1:9: expected '=' after tag key "b", but got ' ' instead`)
+	c.Assert(key, qt.IsNil)
+	c.Assert(dec.Next(), qt.IsTrue)
+	key, err = dec.SeriesKey()
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(key), qt.Equals, "mem,x=1")
+	// Calling SeriesKey again is out of order.
+	key, err = dec.SeriesKey()
+	c.Assert(err, qt.IsNil)
+	c.Assert(key, qt.IsNil)
+}
+
+func TestDecoderSeriesHashError(t *testing.T) {
+	c := qt.New(t)
+	dec := NewDecoderWithBytes([]byte("cpu,a=1,b f=1\nmem,x=1 f=1\n"))
+	c.Assert(dec.Next(), qt.IsTrue)
+	hash, err := dec.SeriesHash()
+	c.Assert(err, qt.ErrorMatches, `at line 1:9: expected '=' after tag key "b", but got ' ' instead`)
+	c.Assert(hash, qt.Equals, uint64(0))
+	c.Assert(dec.Next(), qt.IsTrue)
+	hash, err = dec.SeriesHash()
+	c.Assert(err, qt.IsNil)
+	c.Assert(hash, qt.Equals, SeriesHash([]byte("mem,x=1")))
+	// Calling SeriesHash again is out of order.
+	hash, err = dec.SeriesHash()
+	c.Assert(err, qt.IsNil)
+	c.Assert(hash, qt.Equals, uint64(0))
+}
+
+func TestSeriesKeyAllocs(t *testing.T) {
+	c := qt.New(t)
+	data := []byte(strings.Repeat("m,t2=b,t1=a f1=1i,f2=\"hello\",f3=true 1234\n", 400))
+	dec := NewDecoderWithBytes(data)
+	// Warm up the buffers.
+	dec.Next()
+	dec.SeriesKey()
+	allocs := testing.AllocsPerRun(100, func() {
+		if !dec.Next() {
+			panic("unexpected end of input")
+		}
+		key, err := dec.SeriesKey()
+		if err != nil {
+			panic(err)
+		}
+		SeriesHash(key)
+	})
+	c.Assert(allocs, qt.Equals, 0.0)
+
+	allocs = testing.AllocsPerRun(100, func() {
+		if !dec.Next() {
+			panic("unexpected end of input")
+		}
+		if _, err := dec.SeriesHash(); err != nil {
+			panic(err)
+		}
+	})
+	c.Assert(allocs, qt.Equals, 0.0)
+
+	p := &Point{
+		Measurement: []byte("m"),
+		Tags: []Tag{
+			{Key: []byte("t2"), Value: []byte("b")},
+			{Key: []byte("t1"), Value: []byte("a")},
+		},
+	}
+	buf := make([]byte, 0, 100)
+	allocs = testing.AllocsPerRun(100, func() {
+		p.SeriesKey(buf[:0])
+	})
+	c.Assert(allocs, qt.Equals, 0.0)
+}
@@ -0,0 +1,63 @@
+package lineprotocol
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Shard reads entries from dec and calls fn for each one with the
+// index of the shard that it belongs to, in the range [0, n),
+// and the text of the entry without a trailing newline.
+//
+// The shard is chosen by the series hash of the entry (see
+// SeriesKey and SeriesHash), so all entries in a given series
+// are sent to the same shard. When an entry is already in canonical
+// form (the form produced by Encoder.EncodePoint, with its tags
+// sorted), its original text is passed to fn; otherwise the
+// entry is re-encoded in canonical form.
+//
+// As with RawLine, the line passed to fn is only valid
+// for the duration of the call. Comments are ignored.
+//
+// If an entry can't be decoded, Shard returns its error without
+// calling fn. The Decoder moves on to the next entry, so Shard
+// can be called again to continue with the rest of the input.
+// Shard also returns any error from dec.Err.
+// It panics if n is not positive.
+func Shard(dec *Decoder, n int, fn func(shard int, line []byte)) error {
+	if n <= 0 {
+		panic(fmt.Errorf("invalid shard count %d", n))
+	}
+	var (
+		p   Point
+		enc Encoder
+		key []byte
+	)
+	for dec.Next() {
+		if dec.Comment() != nil {
+			continue
+		}
+		if err := dec.DecodePoint(&p, Nanosecond, time.Time{}); err != nil {
+			return err
+		}
+		key = p.SeriesKey(key[:0])
+		shard := int(SeriesHash(key) % uint64(n))
+		enc.Reset()
+		enc.EncodePoint(&p)
+		if enc.Err() != nil {
+			// The Encoder is stricter than the Decoder in some
+			// respects (for example it rejects duplicate tag keys),
+			// so there's no canonical form for the entry.
+			fn(shard, dec.RawLine())
+			continue
+		}
+		canonical := bytes.TrimSuffix(enc.Bytes(), newlineBytes)
+		if line := dec.RawLine(); bytes.Equal(line, canonical) {
+			fn(shard, line)
+		} else {
+			fn(shard, canonical)
+		}
+	}
+	return dec.Err()
+}
@@ -0,0 +1,96 @@
+package lineprotocol
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestShard(t *testing.T) {
+	c := qt.New(t)
+	const n = 4
+	shardOf := func(key string) int {
+		return int(SeriesHash([]byte(key)) % n)
+	}
+	input := []byte(`cpu,host=a,region=eu f=1 1
+cpu,region=eu,host=a f=2 2
+# comment
+mem,host=b f=1.0,g="x\"y"
+mem,host=b  f=3i   3
+disk f=4u 4
+`)
+	var lines []string
+	dec := NewDecoderWithBytes(input)
+	dec.SetComments(true)
+	err := Shard(dec, n, func(shard int, line []byte) {
+		lines = append(lines, fmt.Sprintf("%d %s", shard, line))
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(lines, qt.DeepEquals, []string{
+		fmt.Sprintf("%d cpu,host=a,region=eu f=1 1", shardOf("cpu,host=a,region=eu")),
+		fmt.Sprintf("%d cpu,host=a,region=eu f=2 2", shardOf("cpu,host=a,region=eu")),
+		fmt.Sprintf("%d mem,host=b f=1,g=\"x\\\"y\"", shardOf("mem,host=b")),
+		fmt.Sprintf("%d mem,host=b f=3i 3", shardOf("mem,host=b")),
+		fmt.Sprintf("%d disk f=4u 4", shardOf("disk")),
+	})
+}
+
+func TestShardPreservesOriginalBytes(t *testing.T) {
+	c := qt.New(t)
+	input := []byte("cpu,host=a f=1 1\ncpu,host=a f=1.5 2\n")
+	dec := NewDecoderWithBytes(input)
+	n := 0
+	err := Shard(dec, 3, func(shard int, line []byte) {
+		// Canonical entries are passed through from
+		// the input without being copied.
+		c.Assert(&line[0], qt.Equals, &input[bytes.Index(input, line)])
+		n++
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 2)
+}
+
+func TestShardDuplicateTags(t *testing.T) {
+	c := qt.New(t)
+	// The encoder rejects duplicate tag keys, so the
+	// original text is used.
+	dec := NewDecoderWithBytes([]byte("cpu,b=1,a=1,b=2 f=1\n"))
+	var lines []string
+	err := Shard(dec, 2, func(shard int, line []byte) {
+		lines = append(lines, string(line))
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(lines, qt.DeepEquals, []string{"cpu,b=1,a=1,b=2 f=1"})
+}
+
+func TestShardError(t *testing.T) {
+	c := qt.New(t)
+	dec := NewDecoderWithBytes([]byte("m1 f=1\nm2 f=x\nm3 f=3\n"))
+	var lines []string
+	fn := func(shard int, line []byte) {
+		lines = append(lines, string(line))
+	}
+	err := Shard(dec, 2, fn)
+	c.Assert(err, qt.ErrorMatches, `at line 2:6: value for field "f" \("x"\) has unrecognized type`)
+	c.Assert(lines, qt.DeepEquals, []string{"m1 f=1"})
+
+	// Calling Shard again continues after the erroneous entry.
+	err = Shard(dec, 2, fn)
+	c.Assert(err, qt.IsNil)
+	c.Assert(lines, qt.DeepEquals, []string{"m1 f=1", "m3 f=3"})
+}
+
+func TestShardAllocs(t *testing.T) {
+	c := qt.New(t)
+	data := []byte(strings.Repeat("m,t1=a,t2=b f1=1i,f2=\"hello\",f3=true 1234\n", 200))
+	allocs := testing.AllocsPerRun(10, func() {
+		dec := NewDecoderWithBytes(data)
+		Shard(dec, 8, func(shard int, line []byte) {})
+	})
+	// Allow for the initial allocation of the Decoder and
+	// the buffers used by Shard but nothing per entry.
+	c.Assert(allocs < 20, qt.IsTrue, qt.Commentf("allocs %v", allocs))
+}
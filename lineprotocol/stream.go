@@ -0,0 +1,197 @@
+package lineprotocol
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// DefaultStreamFlushBytes holds the default value for
+// StreamEncoderOptions.FlushBytes.
+const DefaultStreamFlushBytes = 64 * 1024
+
+// StreamEncoderOptions holds options for NewStreamEncoder.
+type StreamEncoderOptions struct {
+	// FlushBytes holds the number of buffered bytes at which
+	// the buffered entries are written to the underlying writer.
+	// If this is zero, DefaultStreamFlushBytes is used.
+	FlushBytes int
+
+	// FlushLines holds the number of buffered entries
+	// at which the buffered entries are written to the underlying
+	// writer. If this is zero, only FlushBytes is taken into account.
+	FlushLines int
+
+	// Compressor, if non-nil, is used to compress the entries
+	// written to the underlying writer. For example, to write gzip-compressed
+	// data, this can be set to the result of gzip.NewWriter(nil).
+	//
+	// Each call to the underlying writer's Write method is passed
+	// a complete compressed stream (for example, a gzip member)
+	// holding one or more complete entries, so each one can be
+	// decompressed independently. For gzip, the concatenated result
+	// can also be decompressed as a single stream.
+	//
+	// Note that the FlushBytes threshold applies to the
+	// uncompressed data.
+	Compressor Compressor
+}
+
+// Compressor is implemented by compressing writers such as
+// *gzip.Writer. The Zstandard and Snappy writers in
+// github.com/klauspost/compress also implement it.
+type Compressor interface {
+	io.WriteCloser
+	// Reset discards any state and makes the
+	// compressor write a new compressed stream to w.
+	Reset(w io.Writer)
+}
+
+// StreamEncoder is an Encoder that writes the encoded entries
+// to an io.Writer.
+//
+// Entries are buffered and written when either of the thresholds
+// in StreamEncoderOptions is reached, or when Flush or Close
+// is called. An entry is never split across calls to Write:
+// each Write call is passed one or more complete newline-terminated
+// entries (compressed, if StreamEncoderOptions.Compressor is set).
+// An entry that is as large as the FlushBytes threshold on its own
+// is written in a separate call, after any entries buffered before it.
+//
+// The embedded Encoder can be used to encode entries as usual
+// (including by passing a pointer to it to functions that
+// take an *Encoder). Note that calling Reset or SetBuffer on it
+// discards any buffered entries.
+//
+// A StreamEncoder must not be copied after first use.
+type StreamEncoder struct {
+	Encoder
+
+	w          io.Writer
+	flushBytes int
+	flushLines int
+
+	compressor Compressor
+	// compressed holds the compressed data when
+	// compressor is non-nil.
+	compressed bytes.Buffer
+
+	// lines holds the number of complete entries in the buffer.
+	lines int
+	// writeErr holds the first error returned by w.
+	writeErr error
+}
+
+// NewStreamEncoder returns a StreamEncoder that writes entries to w.
+// If opts is nil, the default options are used.
+func NewStreamEncoder(w io.Writer, opts *StreamEncoderOptions) *StreamEncoder {
+	if opts == nil {
+		opts = &StreamEncoderOptions{}
+	}
+	s := &StreamEncoder{
+		w:          w,
+		flushBytes: opts.FlushBytes,
+		flushLines: opts.FlushLines,
+		compressor: opts.Compressor,
+	}
+	if s.flushBytes <= 0 {
+		s.flushBytes = DefaultStreamFlushBytes
+	}
+	s.Encoder.stream = s
+	return s
+}
+
+// Err returns the first error encountered writing to the
+// underlying writer, if any, or otherwise the first encoding
+// error, as returned by Encoder.Err.
+//
+// Note that ClearErr only clears encoding errors: once a write has failed,
+// all subsequent writes will fail with the same error.
+func (s *StreamEncoder) Err() error {
+	if s.writeErr != nil {
+		return s.writeErr
+	}
+	return s.Encoder.Err()
+}
+
+// Flush writes all the complete buffered entries to the underlying writer.
+// An entry that's currently being encoded is retained in the buffer.
+// It returns any error encountered writing. It does not return encoding errors.
+func (s *StreamEncoder) Flush() error {
+	e := &s.Encoder
+	n := len(e.buf)
+	if e.section == tagSection || e.section == fieldSection {
+		n = e.lineStart
+	}
+	s.write(n)
+	return s.writeErr
+}
+
+// Close completes the current entry if necessary, without
+// adding a timestamp, and then flushes all buffered
+// entries. It does not close the underlying writer.
+//
+// It returns the same error as Err.
+func (s *StreamEncoder) Close() error {
+	e := &s.Encoder
+	switch e.section {
+	case fieldSection:
+		e.EndLine(time.Time{})
+	case tagSection:
+		e.setErrorf(EncodeTag, "", "cannot close without adding at least one field to final line")
+	}
+	s.Flush()
+	return s.Err()
+}
+
+// lineEnded is called by the Encoder when an entry has been completed.
+func (s *StreamEncoder) lineEnded() {
+	if start := s.lineStart; start > 0 && len(s.buf)-start >= s.flushBytes {
+		// The entry is too large to share a write, so write
+		// the entries before it first.
+		s.write(start)
+	}
+	s.lines++
+	if len(s.buf) >= s.flushBytes || (s.flushLines > 0 && s.lines >= s.flushLines) {
+		s.write(len(s.buf))
+	}
+}
+
+// write writes the first n bytes of the buffer, which must
+// hold complete entries, to the underlying writer, and removes them
+// from the buffer.
+func (s *StreamEncoder) write(n int) {
+	e := &s.Encoder
+	if n > 0 && s.writeErr == nil {
+		if s.compressor != nil {
+			s.writeCompressed(e.buf[:n])
+		} else {
+			_, s.writeErr = s.w.Write(e.buf[:n])
+		}
+	}
+	// Note: when there's been a write error, the data is
+	// discarded so that the buffer doesn't grow indefinitely.
+	rest := copy(e.buf, e.buf[n:])
+	e.buf = e.buf[:rest]
+	e.lineStart -= n
+	if e.lineStart < 0 {
+		e.lineStart = 0
+	}
+	s.lines = 0
+}
+
+// writeCompressed writes data to the underlying writer
+// as a single complete compressed stream.
+func (s *StreamEncoder) writeCompressed(data []byte) {
+	s.compressed.Reset()
+	s.compressor.Reset(&s.compressed)
+	if _, err := s.compressor.Write(data); err != nil {
+		s.writeErr = err
+		return
+	}
+	if err := s.compressor.Close(); err != nil {
+		s.writeErr = err
+		return
+	}
+	_, s.writeErr = s.w.Write(s.compressed.Bytes())
+}
@@ -0,0 +1,270 @@
+package lineprotocol
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// recordWriter records each Write call.
+type recordWriter struct {
+	writes []string
+	// failAfter holds the number of writes after
+	// which writes will fail.
+	failAfter int
+}
+
+func (w *recordWriter) Write(buf []byte) (int, error) {
+	if w.failAfter > 0 && len(w.writes) >= w.failAfter {
+		return 0, errors.New("write failed")
+	}
+	w.writes = append(w.writes, string(buf))
+	return len(buf), nil
+}
+
+var streamEncoderTests = []struct {
+	testName     string
+	opts         *StreamEncoderOptions
+	expectWrites []string
+}{{
+	testName: "default-options",
+	opts:     nil,
+	expectWrites: []string{
+		"m0 f=0i 1000\nm1 f=1i 1000\nm2 f=2i 1000\nm3 f=3i 1000\nm4 f=4i 1000\n",
+	},
+}, {
+	testName: "flush-lines",
+	opts: &StreamEncoderOptions{
+		FlushLines: 2,
+	},
+	expectWrites: []string{
+		"m0 f=0i 1000\nm1 f=1i 1000\n",
+		"m2 f=2i 1000\nm3 f=3i 1000\n",
+		"m4 f=4i 1000\n",
+	},
+}, {
+	testName: "flush-bytes",
+	opts: &StreamEncoderOptions{
+		FlushBytes: 20,
+	},
+	expectWrites: []string{
+		"m0 f=0i 1000\nm1 f=1i 1000\n",
+		"m2 f=2i 1000\nm3 f=3i 1000\n",
+		"m4 f=4i 1000\n",
+	},
+}, {
+	testName: "flush-bytes-smaller-than-line",
+	opts: &StreamEncoderOptions{
+		FlushBytes: 1,
+		FlushLines: 100,
+	},
+	expectWrites: []string{
+		"m0 f=0i 1000\n",
+		"m1 f=1i 1000\n",
+		"m2 f=2i 1000\n",
+		"m3 f=3i 1000\n",
+		"m4 f=4i 1000\n",
+	},
+}}
+
+func TestStreamEncoder(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range streamEncoderTests {
+		c.Run(test.testName, func(c *qt.C) {
+			var w recordWriter
+			e := NewStreamEncoder(&w, test.opts)
+			for i := 0; i < 5; i++ {
+				e.StartLine("m" + string(rune('0'+i)))
+				e.AddField("f", IntValue(int64(i)))
+				e.EndLine(time.Unix(0, 1000))
+			}
+			c.Assert(e.Close(), qt.IsNil)
+			c.Assert(w.writes, qt.DeepEquals, test.expectWrites)
+			c.Assert(e.Bytes(), qt.HasLen, 0)
+		})
+	}
+}
+
+func TestStreamEncoderLargeEntry(t *testing.T) {
+	c := qt.New(t)
+	var w recordWriter
+	e := NewStreamEncoder(&w, &StreamEncoderOptions{
+		FlushBytes: 20,
+	})
+	e.StartLine("m")
+	e.AddField("f", IntValue(1))
+	e.EndLine(time.Time{})
+	c.Assert(w.writes, qt.HasLen, 0)
+	// The large entry is written on its own, after
+	// the entry that was already buffered.
+	e.StartLine("m")
+	e.AddField("s", MustNewValue(strings.Repeat("x", 50)))
+	e.EndLine(time.Time{})
+	e.StartLine("m")
+	e.AddField("f", IntValue(2))
+	c.Assert(e.Close(), qt.IsNil)
+	c.Assert(w.writes, qt.DeepEquals, []string{
+		"m f=1i\n",
+		`m s="` + strings.Repeat("x", 50) + `"` + "\n",
+		"m f=2i\n",
+	})
+}
+
+func TestStreamEncoderWithoutEndLine(t *testing.T) {
+	c := qt.New(t)
+	var w recordWriter
+	e := NewStreamEncoder(&w, &StreamEncoderOptions{
+		FlushLines: 1,
+	})
+	e.StartLine("m1")
+	e.AddField("f", IntValue(1))
+	c.Assert(w.writes, qt.HasLen, 0)
+	// Starting the next line completes the previous one.
+	e.StartLine("m2")
+	c.Assert(w.writes, qt.DeepEquals, []string{"m1 f=1i\n"})
+	e.AddField("f", IntValue(2))
+	c.Assert(e.Close(), qt.IsNil)
+	c.Assert(w.writes, qt.DeepEquals, []string{"m1 f=1i\n", "m2 f=2i\n"})
+}
+
+func TestStreamEncoderFlushRetainsPartialLine(t *testing.T) {
+	c := qt.New(t)
+	var w recordWriter
+	e := NewStreamEncoder(&w, nil)
+	e.StartLine("m1")
+	e.AddField("f", IntValue(1))
+	e.EndLine(time.Time{})
+	e.StartLine("m2")
+	e.AddTag("t", "v")
+	c.Assert(e.Flush(), qt.IsNil)
+	c.Assert(w.writes, qt.DeepEquals, []string{"m1 f=1i\n"})
+	c.Assert(string(e.Bytes()), qt.Equals, "m2,t=v")
+
+	// An error on the partial line should remove only that line.
+	e.AddField("\xff", IntValue(2))
+	c.Assert(e.Err(), qt.ErrorMatches, `encoding point 1: invalid field key "\\xff"`)
+	c.Assert(e.Bytes(), qt.HasLen, 0)
+
+	e.StartLine("m3")
+	e.AddField("f", IntValue(3))
+	c.Assert(e.Close(), qt.ErrorMatches, `encoding point 1: invalid field key "\\xff"`)
+	c.Assert(w.writes, qt.DeepEquals, []string{"m1 f=1i\n", "m3 f=3i\n"})
+}
+
+func TestStreamEncoderCloseWithNoFields(t *testing.T) {
+	c := qt.New(t)
+	var w recordWriter
+	e := NewStreamEncoder(&w, nil)
+	e.StartLine("m1")
+	c.Assert(e.Close(), qt.ErrorMatches, `cannot close without adding at least one field to final line`)
+	c.Assert(w.writes, qt.HasLen, 0)
+}
+
+func TestStreamEncoderWriteError(t *testing.T) {
+	c := qt.New(t)
+	w := &recordWriter{
+		failAfter: 1,
+	}
+	e := NewStreamEncoder(w, &StreamEncoderOptions{
+		FlushLines: 1,
+	})
+	e.StartLine("m1")
+	e.AddField("f", IntValue(1))
+	e.EndLine(time.Time{})
+	c.Assert(e.Err(), qt.IsNil)
+	e.StartLine("m2")
+	e.AddField("f", IntValue(2))
+	e.EndLine(time.Time{})
+	c.Assert(e.Err(), qt.ErrorMatches, `write failed`)
+	c.Assert(e.Bytes(), qt.HasLen, 0)
+
+	// The write error takes precedence over encoding errors and
+	// isn't cleared by ClearErr.
+	e.StartLine("\xff")
+	c.Assert(e.Err(), qt.ErrorMatches, `write failed`)
+	e.ClearErr()
+	c.Assert(e.Err(), qt.ErrorMatches, `write failed`)
+	c.Assert(e.Flush(), qt.ErrorMatches, `write failed`)
+	c.Assert(e.Close(), qt.ErrorMatches, `write failed`)
+	c.Assert(w.writes, qt.DeepEquals, []string{"m1 f=1i\n"})
+}
+
+func TestStreamEncoderEncodePoint(t *testing.T) {
+	c := qt.New(t)
+	var w recordWriter
+	e := NewStreamEncoder(&w, &StreamEncoderOptions{
+		FlushLines: 1,
+	})
+	e.EncodePoint(&Point{
+		Measurement: []byte("m"),
+		Tags:        []Tag{{Key: []byte("b"), Value: []byte("1")}, {Key: []byte("a"), Value: []byte("2")}},
+		Fields:      []Field{{Key: []byte("f"), Value: IntValue(1)}},
+	})
+	c.Assert(w.writes, qt.DeepEquals, []string{"m,a=2,b=1 f=1i\n"})
+}
+
+func TestStreamEncoderCompressed(t *testing.T) {
+	c := qt.New(t)
+	var w recordWriter
+	e := NewStreamEncoder(&w, &StreamEncoderOptions{
+		FlushLines: 2,
+		Compressor: gzip.NewWriter(nil),
+	})
+	for i := 0; i < 5; i++ {
+		e.StartLine("m" + string(rune('0'+i)))
+		e.AddField("f", IntValue(int64(i)))
+		e.EndLine(time.Unix(0, 1000))
+	}
+	c.Assert(e.Close(), qt.IsNil)
+	c.Assert(w.writes, qt.HasLen, 3)
+
+	// Each write can be decompressed independently.
+	var decompressed []string
+	for _, data := range w.writes {
+		zr, err := gzip.NewReader(strings.NewReader(data))
+		c.Assert(err, qt.IsNil)
+		zr.Multistream(false)
+		text, err := ioutil.ReadAll(zr)
+		c.Assert(err, qt.IsNil)
+		decompressed = append(decompressed, string(text))
+	}
+	c.Assert(decompressed, qt.DeepEquals, []string{
+		"m0 f=0i 1000\nm1 f=1i 1000\n",
+		"m2 f=2i 1000\nm3 f=3i 1000\n",
+		"m4 f=4i 1000\n",
+	})
+
+	// The concatenated writes can be decoded as a single stream.
+	dec := NewDecoderCompressed(strings.NewReader(strings.Join(w.writes, "")), nil)
+	var measurements []string
+	for dec.Next() {
+		m, err := dec.Measurement()
+		c.Assert(err, qt.IsNil)
+		measurements = append(measurements, string(m))
+	}
+	c.Assert(dec.Err(), qt.IsNil)
+	c.Assert(measurements, qt.DeepEquals, []string{"m0", "m1", "m2", "m3", "m4"})
+}
+
+func TestStreamEncoderCompressedAllocations(t *testing.T) {
+	c := qt.New(t)
+	e := NewStreamEncoder(ioutil.Discard, &StreamEncoderOptions{
+		FlushLines: 1,
+		Compressor: gzip.NewWriter(nil),
+	})
+	encode := func() {
+		e.StartLine("m")
+		e.AddField("f", IntValue(1))
+		e.EndLine(time.Unix(0, 1000))
+	}
+	// Warm up the buffers.
+	encode()
+	allocs := testing.AllocsPerRun(100, encode)
+	c.Assert(allocs, qt.Equals, 0.0)
+	c.Assert(e.Close(), qt.IsNil)
+}